@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// 输入来源
+const (
+	SourceConsole   = "console"    // 本地控制台
+	SourceWeb       = "web"        // Web界面
+	SourceAPI       = "api"        // HTTP API
+	SourceResponder = "responder"  // 自动应答规则
+	SourceQueue     = "queue"      // 任务队列
+	SourceRateLimit = "rate_limit" // 用量重置后自动继续
+)
+
+// AuditEntry 审计日志条目，Hash = sha256(PrevHash + 不含Hash字段的JSON)
+type AuditEntry struct {
+	Seq        int64     `json:"seq"`
+	Time       time.Time `json:"time"`
+	Source     string    `json:"source"`         // console / web / api
+	Transport  string    `json:"transport"`      // console / http / https / unix
+	User       string    `json:"user,omitempty"` // 认证用户
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Data       []byte    `json:"data"`                  // 写入PTY的原始字节（base64）
+	Text       string    `json:"text,omitempty"`        // 可读文本（仅当Data为合法UTF-8）
+	Decision   string    `json:"decision,omitempty"`    // 策略决策，为空表示直接写入
+	Rule       string    `json:"rule,omitempty"`        // 命中的策略规则
+	ApprovedBy string    `json:"approved_by,omitempty"` // 审批人
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `json:"hash,omitempty"`
+}
+
+// computeHash 计算条目哈希
+func (e AuditEntry) computeHash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(append([]byte(e.PrevHash), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+// auditLog 追加写入的防篡改审计日志
+type auditLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	seq      int64
+	lastHash string
+
+	consoleBuf   []byte      // 尚未落盘的控制台输入
+	consoleTimer *time.Timer // 控制台输入超时落盘
+}
+
+// consoleFlushDelay 控制台输入在无回车时的落盘延迟
+const consoleFlushDelay = time.Second
+
+// openAuditLog 打开审计日志，从最后一条记录继续哈希链
+func openAuditLog(path string) (*auditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("创建审计日志目录失败: %v", err)
+	}
+
+	a := &auditLog{}
+	if f, err := os.Open(path); err == nil {
+		last, err := lastAuditEntry(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取审计日志失败: %v", err)
+		}
+		if last != nil {
+			a.seq = last.Seq
+			a.lastHash = last.Hash
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("打开审计日志失败: %v", err)
+	}
+	a.file = f
+	return a, nil
+}
+
+// lastAuditEntry 返回日志中的最后一条记录
+func lastAuditEntry(r io.Reader) (*AuditEntry, error) {
+	var last *AuditEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		last = &e
+	}
+	return last, scanner.Err()
+}
+
+// Record 追加一条审计记录
+func (a *auditLog) Record(e AuditEntry) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.recordLocked(e)
+}
+
+func (a *auditLog) recordLocked(e AuditEntry) error {
+	a.seq++
+	e.Seq = a.seq
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if utf8.Valid(e.Data) {
+		e.Text = string(e.Data)
+	}
+	e.PrevHash = a.lastHash
+	e.Hash = e.computeHash()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("写入审计日志失败: %v", err)
+	}
+	a.lastHash = e.Hash
+	return nil
+}
+
+// RecordConsole 记录控制台输入，按行（或静默一段时间后）合并为一条记录
+func (a *auditLog) RecordConsole(p []byte) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.consoleBuf = append(a.consoleBuf, p...)
+	for _, b := range p {
+		if b == '\r' || b == '\n' {
+			a.flushConsoleLocked()
+			return
+		}
+	}
+	if a.consoleTimer == nil {
+		a.consoleTimer = time.AfterFunc(consoleFlushDelay, func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			a.flushConsoleLocked()
+		})
+	}
+}
+
+func (a *auditLog) flushConsoleLocked() {
+	if a.consoleTimer != nil {
+		a.consoleTimer.Stop()
+		a.consoleTimer = nil
+	}
+	if len(a.consoleBuf) == 0 {
+		return
+	}
+	a.recordLocked(AuditEntry{
+		Source:    SourceConsole,
+		Transport: SourceConsole,
+		User:      consoleUser(),
+		Data:      a.consoleBuf,
+	})
+	a.consoleBuf = nil
+}
+
+// Close 落盘未完成的控制台输入并关闭文件
+func (a *auditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.flushConsoleLocked()
+	return a.file.Close()
+}
+
+// consoleUser 本地控制台用户
+func consoleUser() string {
+	if u := os.Getenv("USER"); u != "" {
+		return u
+	}
+	return fmt.Sprintf("uid:%d", os.Getuid())
+}
+
+// verifyAuditLog 校验审计日志哈希链，返回记录条数
+func verifyAuditLog(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	count := 0
+	line := 0
+	prevHash := ""
+	var prevSeq int64
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return count, fmt.Errorf("第%d行无法解析: %v", line, err)
+		}
+		if e.PrevHash != prevHash {
+			return count, fmt.Errorf("第%d行（seq=%d）前序哈希不匹配，记录可能被删除或重排", line, e.Seq)
+		}
+		if e.Hash != e.computeHash() {
+			return count, fmt.Errorf("第%d行（seq=%d）哈希不匹配，记录内容被修改", line, e.Seq)
+		}
+		if count > 0 && e.Seq != prevSeq+1 {
+			return count, fmt.Errorf("第%d行序号不连续: %d 之后为 %d", line, prevSeq, e.Seq)
+		}
+		prevHash = e.Hash
+		prevSeq = e.Seq
+		count++
+	}
+	return count, scanner.Err()
+}
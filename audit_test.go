@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// auditLines 写入几条审计记录，返回日志的各行
+func auditLines(t *testing.T) []string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{"ls\n", "git status\n", "exit\n"} {
+		if err := a.Record(AuditEntry{Source: SourceWeb, Transport: "http", Data: []byte(data)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.Close()
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+}
+
+// rewriteEntry 修改某一行的记录；rehash为true时重新计算该行哈希，模拟伪造单条记录
+func rewriteEntry(t *testing.T, line string, rehash bool, edit func(e *AuditEntry)) string {
+	t.Helper()
+	var e AuditEntry
+	if err := json.Unmarshal([]byte(line), &e); err != nil {
+		t.Fatal(err)
+	}
+	edit(&e)
+	if rehash {
+		e.Hash = e.computeHash()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		tamper    func(t *testing.T, lines []string) []string
+		wantCount int
+		wantErr   string
+	}{
+		{
+			name:      "intact",
+			tamper:    func(t *testing.T, lines []string) []string { return lines },
+			wantCount: 3,
+		},
+		{
+			name: "blank lines ignored",
+			tamper: func(t *testing.T, lines []string) []string {
+				return []string{lines[0], "", lines[1], lines[2], ""}
+			},
+			wantCount: 3,
+		},
+		{
+			name: "modified data",
+			tamper: func(t *testing.T, lines []string) []string {
+				lines[1] = rewriteEntry(t, lines[1], false, func(e *AuditEntry) {
+					e.Data, e.Text = []byte("rm -rf /\n"), "rm -rf /\n"
+				})
+				return lines
+			},
+			wantCount: 1,
+			wantErr:   "记录内容被修改",
+		},
+		{
+			name: "modified and rehashed",
+			tamper: func(t *testing.T, lines []string) []string {
+				lines[1] = rewriteEntry(t, lines[1], true, func(e *AuditEntry) {
+					e.User = "mallory"
+				})
+				return lines
+			},
+			wantCount: 2,
+			wantErr:   "前序哈希不匹配",
+		},
+		{
+			name: "deleted entry",
+			tamper: func(t *testing.T, lines []string) []string {
+				return []string{lines[0], lines[2]}
+			},
+			wantCount: 1,
+			wantErr:   "前序哈希不匹配",
+		},
+		{
+			name: "deleted first entry",
+			tamper: func(t *testing.T, lines []string) []string {
+				return lines[1:]
+			},
+			wantErr: "前序哈希不匹配",
+		},
+		{
+			name: "reordered entries",
+			tamper: func(t *testing.T, lines []string) []string {
+				return []string{lines[0], lines[2], lines[1]}
+			},
+			wantCount: 1,
+			wantErr:   "前序哈希不匹配",
+		},
+		{
+			name: "sequence gap",
+			tamper: func(t *testing.T, lines []string) []string {
+				lines[1] = rewriteEntry(t, lines[1], true, func(e *AuditEntry) { e.Seq = 5 })
+				return lines[:2]
+			},
+			wantCount: 1,
+			wantErr:   "序号不连续",
+		},
+		{
+			name: "corrupt line",
+			tamper: func(t *testing.T, lines []string) []string {
+				lines[2] = lines[2][:len(lines[2])/2]
+				return lines
+			},
+			wantCount: 2,
+			wantErr:   "无法解析",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := tt.tamper(t, auditLines(t))
+			count, err := verifyAuditLog(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+			if count != tt.wantCount {
+				t.Errorf("count = %d, want %d", count, tt.wantCount)
+			}
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
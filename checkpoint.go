@@ -0,0 +1,541 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+const (
+	checkpointRefPrefix   = "refs/claudewarp/checkpoints/" // 检查点提交所在的隐藏ref前缀，后接会话名
+	checkpointPromptLimit = 500                            // 记录的提示最大字节数
+)
+
+// Checkpoint 提交提示前的工作目录快照
+type Checkpoint = protocol.Checkpoint
+
+// errCheckpointNotFound 检查点不存在
+var errCheckpointNotFound = errors.New("检查点不存在")
+
+// checkpointIdentity 快照提交的作者信息，不依赖仓库的 user.name 配置
+var checkpointIdentity = []string{
+	"GIT_AUTHOR_NAME=claudewarp", "GIT_AUTHOR_EMAIL=claudewarp@localhost",
+	"GIT_COMMITTER_NAME=claudewarp", "GIT_COMMITTER_EMAIL=claudewarp@localhost",
+}
+
+// CheckpointConfig 工作目录检查点配置
+type CheckpointConfig struct {
+	Enabled bool `json:"enabled"` // 每次提交提示前保存快照，默认开启
+	Limit   int  `json:"limit"`   // 列表中保留的检查点数，默认100
+}
+
+// validate 校验检查点配置
+func (c CheckpointConfig) validate() []error {
+	if c.Limit <= 0 {
+		return []error{fmt.Errorf("checkpoints.limit 必须大于0")}
+	}
+	return nil
+}
+
+// checkpointFile 检查点列表的持久化格式
+type checkpointFile struct {
+	NextID int          `json:"next_id"`
+	Items  []Checkpoint `json:"items"`
+}
+
+// checkpoints 检查点列表，持久化到 <state_dir>/checkpoints/<session>.json；
+// 快照提交串在 refs/claudewarp/checkpoints/<session> 上，不会被gc回收
+type checkpoints struct {
+	mu   sync.Mutex
+	path string
+	ref  string
+	data checkpointFile
+}
+
+// openCheckpoints 读取检查点列表
+func openCheckpoints(path, session string) (*checkpoints, error) {
+	c := &checkpoints{path: path, ref: checkpointRefPrefix + session}
+	if err := readJSONFile(path, &c.data); err != nil {
+		return nil, fmt.Errorf("读取检查点列表失败: %v", err)
+	}
+	if c.data.NextID == 0 {
+		c.data.NextID = 1
+	}
+	return c, nil
+}
+
+// list 返回检查点列表，按创建时间排序
+func (c *checkpoints) list() []Checkpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Checkpoint{}, c.data.Items...)
+}
+
+// find 按ID查找检查点，同时返回其后一个检查点（没有时为nil）
+func (c *checkpoints) find(id int) (Checkpoint, *Checkpoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, cp := range c.data.Items {
+		if cp.ID != id {
+			continue
+		}
+		if i+1 < len(c.data.Items) {
+			next := c.data.Items[i+1]
+			return cp, &next, nil
+		}
+		return cp, nil, nil
+	}
+	return Checkpoint{}, nil, errCheckpointNotFound
+}
+
+// withTempIndex 在仓库index的临时副本上执行fn，不改动真实的暂存区
+func withTempIndex(root string, fn func(env []string) error) error {
+	dir, err := os.MkdirTemp("", "claudewarp-index-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	index := filepath.Join(dir, "index")
+	if real, err := gitLine(root, "rev-parse", "--git-path", "index"); err == nil {
+		if !filepath.IsAbs(real) {
+			real = filepath.Join(root, real)
+		}
+		// 复制真实index以复用其中的文件状态缓存，新仓库没有index时从空开始
+		if data, err := os.ReadFile(real); err == nil {
+			if err := os.WriteFile(index, data, 0600); err != nil {
+				return err
+			}
+		}
+	}
+	return fn(append([]string{"GIT_INDEX_FILE=" + index}, checkpointIdentity...))
+}
+
+// worktreeTree 把工作目录（遵循 .gitignore）写入临时index，返回对应的tree
+func worktreeTree(root string, env []string) (string, error) {
+	if _, err := runGitEnv(root, env, "add", "-A"); err != nil {
+		return "", err
+	}
+	return gitLineEnv(root, env, "write-tree")
+}
+
+// gitLineEnv 以额外的环境变量执行git命令并返回去掉首尾空白的输出
+func gitLineEnv(dir string, env []string, args ...string) (string, error) {
+	out, err := runGitEnv(dir, env, args...)
+	return strings.TrimSpace(string(out)), err
+}
+
+// create 为cwd所在仓库的工作目录保存快照，不在git仓库中时返回nil
+func (c *checkpoints) create(cwd, prompt, source, user string, limit int) (*Checkpoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	root, err := gitLine(cwd, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, nil
+	}
+	cp := Checkpoint{
+		ID:        c.data.NextID,
+		Root:      root,
+		Prompt:    truncateText(prompt, checkpointPromptLimit),
+		Source:    source,
+		User:      user,
+		CreatedAt: time.Now(),
+	}
+	cp.Head, _ = gitLine(root, "rev-parse", "--verify", "-q", "HEAD")
+	cp.Branch, _ = gitLine(root, "symbolic-ref", "--short", "-q", "HEAD")
+
+	err = withTempIndex(root, func(env []string) error {
+		tree, err := worktreeTree(root, env)
+		if err != nil {
+			return err
+		}
+		parent, _ := gitLine(root, "rev-parse", "--verify", "-q", c.ref)
+		if parent != "" {
+			// 工作目录与上一个快照相同时复用该提交
+			if parentTree, _ := gitLine(root, "rev-parse", parent+"^{tree}"); parentTree == tree {
+				cp.Commit = parent
+				return nil
+			}
+		}
+		args := []string{"commit-tree", tree, "-m", checkpointMessage(cp)}
+		if parent != "" {
+			args = append(args, "-p", parent)
+		}
+		if cp.Commit, err = gitLineEnv(root, env, args...); err != nil {
+			return err
+		}
+		_, err = runGit(root, "update-ref", "-m", "claudewarp checkpoint", c.ref, cp.Commit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("保存检查点失败: %v", err)
+	}
+
+	c.data.NextID++
+	c.data.Items = append(c.data.Items, cp)
+	if over := len(c.data.Items) - limit; over > 0 {
+		c.data.Items = append([]Checkpoint{}, c.data.Items[over:]...)
+	}
+	pruneErr := c.pruneLocked(root, limit)
+	if err := writeJSONFile(c.path, c.data); err != nil {
+		return &cp, fmt.Errorf("保存检查点列表失败: %v", err)
+	}
+	if pruneErr != nil {
+		return &cp, fmt.Errorf("清理检查点提交失败: %v", pruneErr)
+	}
+	return &cp, nil
+}
+
+// checkpointMessage 快照提交的说明
+func checkpointMessage(cp Checkpoint) string {
+	return fmt.Sprintf("claudewarp checkpoint #%d\n\n%s", cp.ID, cp.Prompt)
+}
+
+// pruneLocked 仓库中的快照提交链超过保留数的两倍时，以列表中最早的检查点为起点重写提交链，
+// 使移出列表的快照不再被ref引用、可以被gc回收。重写后检查点的提交ID会变化
+func (c *checkpoints) pruneLocked(root string, limit int) error {
+	n, err := gitLine(root, "rev-list", "--count", c.ref)
+	if err != nil {
+		return err
+	}
+	if count, _ := strconv.Atoi(n); count <= 2*limit {
+		return nil
+	}
+
+	items := append([]Checkpoint{}, c.data.Items...)
+	rewritten := map[string]string{}
+	parent := ""
+	for i, cp := range items {
+		if cp.Root != root {
+			continue
+		}
+		// 工作目录未变化的检查点共用同一个提交
+		if commit, ok := rewritten[cp.Commit]; ok {
+			items[i].Commit = commit
+			continue
+		}
+		args := []string{"commit-tree", cp.Commit + "^{tree}", "-m", checkpointMessage(cp)}
+		if parent != "" {
+			args = append(args, "-p", parent)
+		}
+		commit, err := gitLineEnv(root, checkpointIdentity, args...)
+		if err != nil {
+			return err
+		}
+		rewritten[cp.Commit] = commit
+		items[i].Commit = commit
+		parent = commit
+	}
+	if parent == "" {
+		return nil
+	}
+	if _, err := runGit(root, "update-ref", "-m", "claudewarp checkpoint prune", c.ref, parent); err != nil {
+		return err
+	}
+	c.data.Items = items
+	return nil
+}
+
+// restore 把工作目录恢复到ID对应的检查点：删除检查点之后新增的文件，还原修改和删除的文件。
+// HEAD和暂存区保持不变，被 .gitignore 忽略的文件不受影响。
+// 检查点在加锁后按ID重新查找，保存快照时重写提交链不会让它指向已不被引用的提交
+func (c *checkpoints) restore(id int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var cp *Checkpoint
+	for i := range c.data.Items {
+		if c.data.Items[i].ID == id {
+			cp = &c.data.Items[i]
+		}
+	}
+	if cp == nil {
+		return errCheckpointNotFound
+	}
+	return withTempIndex(cp.Root, func(env []string) error {
+		current, err := worktreeTree(cp.Root, env)
+		if err != nil {
+			return err
+		}
+		// 临时index与当前工作目录一致，两树合并会按差异更新工作目录
+		_, err = runGitEnv(cp.Root, env, "read-tree", "-m", "-u", current, cp.Commit+"^{tree}")
+		return err
+	})
+}
+
+// diff 返回检查点from到to之间的diff，to为nil时与当前工作目录比较
+func (c *checkpoints) diff(from Checkpoint, to *Checkpoint) (string, bool, error) {
+	target := ""
+	if to != nil {
+		target = to.Commit
+	} else {
+		c.mu.Lock()
+		err := withTempIndex(from.Root, func(env []string) error {
+			var err error
+			target, err = worktreeTree(from.Root, env)
+			return err
+		})
+		c.mu.Unlock()
+		if err != nil {
+			return "", false, err
+		}
+	}
+	out, err := runGit(from.Root, "diff", "--no-color", "--no-ext-diff", "--no-renames", from.Commit, target)
+	if err != nil {
+		return "", false, err
+	}
+	if len(out) > workspaceDiffLimit {
+		return truncateText(string(out), workspaceDiffLimit), true, nil
+	}
+	return string(out), false, nil
+}
+
+// promptText 判断远程输入是否为提交给Claude的提示，返回提示文本。
+// 控制键和空行不算提示。
+func promptText(in WebInput) (string, bool) {
+	if in.Source == SourceResponder || strings.HasPrefix(in.Content, "\x1b") {
+		return "", false
+	}
+	if !in.AddNewline && !strings.HasSuffix(in.Content, "\n") && !strings.HasSuffix(in.Content, "\r") {
+		return "", false
+	}
+	text := strings.TrimSpace(in.Content)
+	return text, text != ""
+}
+
+// checkpointPrompt 提交提示前为工作目录保存快照
+func (w *ClaudeWarp) checkpointPrompt(prompt, source, user string) {
+	if w.wantCheckpoint() {
+		w.saveCheckpoint(prompt, source, user)
+	}
+}
+
+// wantCheckpoint 判断此时提交的输入是否需要保存快照；Claude正在等待确认时输入的是选项，不保存
+func (w *ClaudeWarp) wantCheckpoint() bool {
+	if !w.config().Checkpoints.Enabled {
+		return false
+	}
+	state, _ := w.tracker.Current()
+	return state != StateAwaitingApproval && state != StateExited
+}
+
+// saveCheckpoint 为Claude当前的工作目录保存快照
+func (w *ClaudeWarp) saveCheckpoint(prompt, source, user string) {
+	w.childMux.RLock()
+	cwd := w.child.Cwd
+	w.childMux.RUnlock()
+
+	cp, err := w.checkpoints.create(cwd, w.redactor.Redact(prompt), source, user, w.config().Checkpoints.Limit)
+	if err != nil {
+		w.addMessage("error", err.Error())
+	}
+	if cp != nil {
+		w.broadcastCheckpoints()
+	}
+}
+
+// broadcastCheckpoints 向Web客户端推送检查点列表
+func (w *ClaudeWarp) broadcastCheckpoints() {
+	w.broadcastEvent(protocol.CheckpointsEvent{Type: protocol.EventCheckpoints, Checkpoints: w.checkpoints.list()})
+}
+
+// consoleLine 跟踪控制台当前输入行，用于识别提交提示的回车。
+// 方向键、历史记录等编辑不会反映在这里，提示文本优先从屏幕上的输入框读取
+type consoleLine struct {
+	buf []byte
+	esc int // 0: 普通字符；1: 刚读到ESC；2: 在CSI序列中
+}
+
+// feed 处理一个输入字节，按下回车时返回true和键入的内容（可能为空）
+func (l *consoleLine) feed(b byte) (string, bool) {
+	switch {
+	case l.esc == 1:
+		l.esc = 0
+		if b == '[' {
+			l.esc = 2
+		}
+	case l.esc == 2:
+		// CSI序列以 0x40-0x7e 结束，如方向键、括号粘贴标记
+		if b >= 0x40 && b <= 0x7e {
+			l.esc = 0
+		}
+	case b == 0x1b:
+		l.esc = 1
+	case b == '\r':
+		line := strings.TrimSpace(string(l.buf))
+		l.buf = l.buf[:0]
+		return line, true
+	case b == 0x7f || b == 0x08:
+		// 退格删除最后一个UTF-8字符
+		i := len(l.buf) - 1
+		for i > 0 && l.buf[i]&0xc0 == 0x80 {
+			i--
+		}
+		if i >= 0 {
+			l.buf = l.buf[:i]
+		}
+	case b == 0x15 || b == 0x03:
+		l.buf = l.buf[:0]
+	case b >= 0x20 || b == '\n' || b == '\t':
+		l.buf = append(l.buf, b)
+	}
+	return "", false
+}
+
+// 屏幕上Claude的输入框：提示所在行以 ">" 开头，多行提示延续到输入框下边框
+var (
+	promptLinePattern   = regexp.MustCompile(`^\s*│?\s*>\s?(.*)$`)
+	promptBorderPattern = regexp.MustCompile(`^\s*[╰─━]`)
+)
+
+// screenPrompt 从屏幕尾部读取输入框中的提示文本，找不到输入框时返回空串
+func screenPrompt(tail string) string {
+	lines := strings.Split(tail, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		m := promptLinePattern.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		parts := []string{m[1]}
+		for _, line := range lines[i+1:] {
+			if promptBorderPattern.MatchString(line) {
+				break
+			}
+			parts = append(parts, line)
+		}
+		for j, part := range parts {
+			parts[j] = strings.TrimSpace(strings.Trim(strings.TrimSpace(part), "│"))
+		}
+		return strings.TrimSpace(strings.Join(parts, "\n"))
+	}
+	return ""
+}
+
+// consolePrompt 返回控制台回车提交的提示：优先取屏幕输入框中的文本，读不到时使用键入的内容
+func consolePrompt(tail, typed string) string {
+	if prompt := screenPrompt(tail); prompt != "" {
+		return prompt
+	}
+	return typed
+}
+
+// handleCheckpoints 处理检查点API：
+// GET /api/checkpoints，GET /api/checkpoints/<id>/diff[?to=<id>|current]，POST /api/checkpoints/<id>/restore
+func (w *ClaudeWarp) handleCheckpoints(wr http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/checkpoints"), "/")
+	if rest == "" {
+		if r.Method != "GET" {
+			http.Error(wr, "仅支持GET方法", http.StatusMethodNotAllowed)
+			return
+		}
+		data, _ := json.Marshal(w.checkpoints.list())
+		wr.Header().Set("Content-Type", "application/json")
+		wr.Write(data)
+		return
+	}
+
+	idText, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		http.NotFound(wr, r)
+		return
+	}
+	cp, next, err := w.checkpoints.find(id)
+	if err != nil {
+		http.Error(wr, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case action == "diff" && r.Method == "GET":
+		w.serveCheckpointDiff(wr, r, cp, next)
+	case action == "restore" && r.Method == "POST":
+		w.restoreCheckpoint(wr, r, cp)
+	case action == "diff" || action == "restore":
+		http.Error(wr, "请求方法不支持", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(wr, r)
+	}
+}
+
+// serveCheckpointDiff 返回检查点到下一个检查点的diff，最新的检查点与当前工作目录比较
+func (w *ClaudeWarp) serveCheckpointDiff(wr http.ResponseWriter, r *http.Request, cp Checkpoint, next *Checkpoint) {
+	switch to := r.URL.Query().Get("to"); to {
+	case "":
+	case "current":
+		next = nil
+	default:
+		id, err := strconv.Atoi(to)
+		if err != nil {
+			http.Error(wr, "to 必须是检查点ID或 current", http.StatusBadRequest)
+			return
+		}
+		target, _, err := w.checkpoints.find(id)
+		if err != nil {
+			http.Error(wr, err.Error(), http.StatusNotFound)
+			return
+		}
+		if target.Root != cp.Root {
+			http.Error(wr, "两个检查点不在同一个仓库中", http.StatusBadRequest)
+			return
+		}
+		next = &target
+	}
+
+	result := protocol.CheckpointDiff{From: cp.ID}
+	if next != nil {
+		result.To = next.ID
+	}
+	diff, truncated, err := w.checkpoints.diff(cp, next)
+	if err != nil {
+		http.Error(wr, err.Error(), http.StatusConflict)
+		return
+	}
+	result.Diff, result.Truncated = w.redactor.Redact(diff), truncated
+
+	data, _ := json.Marshal(result)
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
+
+// restoreCheckpoint 把工作目录恢复到检查点，恢复前先保存当前状态以便撤销
+func (w *ClaudeWarp) restoreCheckpoint(wr http.ResponseWriter, r *http.Request, cp Checkpoint) {
+	user, ok := w.requireController(wr, r)
+	if !ok {
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(r.Body, 1024))
+	if state, _ := w.tracker.Current(); state == StateRunning {
+		http.Error(wr, "Claude正在运行，请等待空闲或先中断后再恢复", http.StatusConflict)
+		return
+	}
+
+	who := requestIdentity(user, r.RemoteAddr)
+	backup, err := w.checkpoints.create(cp.Root, fmt.Sprintf("恢复到检查点 #%d 之前的状态", cp.ID), SourceAPI, who, w.config().Checkpoints.Limit)
+	if err != nil || backup == nil {
+		http.Error(wr, fmt.Sprintf("恢复前保存当前状态失败，未做任何改动: %v", err), http.StatusConflict)
+		return
+	}
+	if err := w.checkpoints.restore(cp.ID); err != nil {
+		w.broadcastCheckpoints()
+		http.Error(wr, fmt.Sprintf("恢复检查点失败: %v", err), http.StatusConflict)
+		return
+	}
+	w.addMessage("output", fmt.Sprintf("⏪ %s 将工作目录恢复到检查点 #%d（恢复前的状态已保存为 #%d）", who, cp.ID, backup.ID))
+	w.broadcastCheckpoints()
+
+	data, _ := json.Marshal(backup)
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
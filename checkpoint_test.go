@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCheckpointRestoreAfterPrune 保存快照重写提交链并gc后，仍能按ID恢复列表中的检查点
+func TestCheckpointRestoreAfterPrune(t *testing.T) {
+	const limit = 3
+	tests := []struct {
+		name    string
+		saves   int // 恢复前保存的快照数
+		restore int // 要恢复的检查点ID
+		want    string
+		wantErr error
+	}{
+		{name: "before prune", saves: 3, restore: 2, want: "v2"},
+		{name: "after prune", saves: 8, restore: 7, want: "v7"},
+		{name: "oldest kept", saves: 8, restore: 6, want: "v6"},
+		{name: "trimmed", saves: 8, restore: 2, wantErr: errCheckpointNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testRepo(t, map[string]string{"f.txt": "v0"})
+			c, err := openCheckpoints(filepath.Join(t.TempDir(), "checkpoints.json"), "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i <= tt.saves; i++ {
+				writeTestFile(t, dir, "f.txt", fmt.Sprintf("v%d", i))
+				if _, err := c.create(dir, "prompt", SourceConsole, "", limit); err != nil {
+					t.Fatal(err)
+				}
+			}
+			runGit(dir, "reflog", "expire", "--expire=now", "--all")
+			if _, err := runGit(dir, "gc", "-q", "--prune=now"); err != nil {
+				t.Fatal(err)
+			}
+
+			writeTestFile(t, dir, "f.txt", "current")
+			err = c.restore(tt.restore)
+			if err != tt.wantErr {
+				t.Fatalf("restore(%d) error = %v, want %v", tt.restore, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, err := os.ReadFile(filepath.Join(dir, "f.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("f.txt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+const (
+	claudeSessionInterval = 5 * time.Second  // 扫描Claude对话记录的间隔
+	resumeTimeout         = 15 * time.Second // 恢复会话时等待旧进程退出的时间
+	resumeKillAfter       = 5 * time.Second  // 旧进程收到SIGTERM后多久强制结束
+	transcriptSlack       = 2 * time.Second  // 对话记录修改时间的容差（启动时间在pty.Start之后记录，部分文件系统时间精度为秒）
+)
+
+// ClaudeSession Claude自身的会话ID
+type ClaudeSession = protocol.ClaudeSession
+
+// claudeSessionIDPattern Claude会话ID（UUID），拼接到启动命令前必须校验
+var claudeSessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,127}$`)
+
+// claudeProjectNamePattern Claude按工作目录命名对话记录目录时替换的字符
+var claudeProjectNamePattern = regexp.MustCompile(`[^A-Za-z0-9]`)
+
+// claudeSessions 记录当前Claude会话ID，持久化到 <state_dir>/claude/<session>.json，
+// claudewarp重启后仍可恢复
+type claudeSessions struct {
+	mu      sync.RWMutex
+	path    string
+	current *ClaudeSession
+}
+
+// openClaudeSessions 读取上次记录的Claude会话ID
+func openClaudeSessions(path string) (*claudeSessions, error) {
+	s := &claudeSessions{path: path}
+	var rec ClaudeSession
+	if err := readJSONFile(path, &rec); err != nil {
+		return nil, fmt.Errorf("读取Claude会话记录失败: %v", err)
+	}
+	if rec.ID != "" {
+		s.current = &rec
+	}
+	return s, nil
+}
+
+// get 返回当前记录，没有时为nil
+func (s *claudeSessions) get() *ClaudeSession {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.current == nil {
+		return nil
+	}
+	rec := *s.current
+	return &rec
+}
+
+// set 更新并持久化记录，会话ID和对话记录文件都未变化时返回false
+func (s *claudeSessions) set(rec ClaudeSession) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur := s.current; cur != nil && cur.ID == rec.ID && cur.Cwd == rec.Cwd &&
+		(rec.Transcript == "" || cur.Transcript == rec.Transcript) {
+		return false, nil
+	}
+	if rec.Transcript == "" && s.current != nil && s.current.ID == rec.ID {
+		rec.Transcript = s.current.Transcript
+	}
+	s.current = &rec
+	if err := writeJSONFile(s.path, rec); err != nil {
+		return true, fmt.Errorf("保存Claude会话记录失败: %v", err)
+	}
+	return true, nil
+}
+
+// claudeProjectDir 返回Claude保存某个工作目录对话记录的目录，
+// 即 ~/.claude/projects/<工作目录中非字母数字替换为->（可由CLAUDE_CONFIG_DIR覆盖~/.claude）
+func claudeProjectDir(profile Profile, cwd string) string {
+	base := claudeConfigDir(profile)
+	if base == "" {
+		return ""
+	}
+	return filepath.Join(base, "projects", claudeProjectNamePattern.ReplaceAllString(cwd, "-"))
+}
+
+// claudeConfigDir 返回Claude的配置目录，默认 ~/.claude，可由CLAUDE_CONFIG_DIR覆盖
+func claudeConfigDir(profile Profile) string {
+	if base := profile.Env["CLAUDE_CONFIG_DIR"]; base != "" {
+		return base
+	}
+	if base := os.Getenv("CLAUDE_CONFIG_DIR"); base != "" {
+		return base
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".claude")
+}
+
+// latestTranscript 返回目录下after之后更新过的最新对话记录，文件名即会话ID
+func latestTranscript(dir string, after time.Time) (id, path string) {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	var latest time.Time
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || info.ModTime().Before(after) || !info.ModTime().After(latest) {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(p), ".jsonl")
+		if !claudeSessionIDPattern.MatchString(name) {
+			continue
+		}
+		latest, id, path = info.ModTime(), name, p
+	}
+	return id, path
+}
+
+// watchClaudeSession 定期从对话记录文件识别当前Claude会话ID。
+// 同一目录下同时运行多个Claude时只能取最近更新的一个，此时应配置hook回调精确上报。
+func (w *ClaudeWarp) watchClaudeSession() {
+	ticker := time.NewTicker(claudeSessionInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		w.childMux.RLock()
+		child := w.child
+		w.childMux.RUnlock()
+		if child.PID == 0 || child.Exited {
+			continue
+		}
+		// 本次启动后已有hook上报，以hook为准
+		cur := w.claudeSessions.get()
+		if cur != nil && cur.Source == protocol.ClaudeSessionFromHook && cur.UpdatedAt.After(child.StartedAt) {
+			continue
+		}
+		id, path := latestTranscript(claudeProjectDir(w.sessionProfile(), child.Cwd), child.StartedAt.Add(-transcriptSlack))
+		if id == "" || (cur != nil && cur.ID == id) {
+			continue
+		}
+		w.recordClaudeSession(ClaudeSession{
+			ID:         id,
+			Cwd:        child.Cwd,
+			Transcript: path,
+			Source:     protocol.ClaudeSessionFromTranscript,
+			UpdatedAt:  time.Now(),
+		})
+	}
+}
+
+// recordClaudeSession 记录识别到的Claude会话ID并通知Web客户端
+func (w *ClaudeWarp) recordClaudeSession(rec ClaudeSession) {
+	changed, err := w.claudeSessions.set(rec)
+	if err != nil {
+		w.addMessage("error", err.Error())
+	}
+	if !changed {
+		return
+	}
+	w.addMessage("output", fmt.Sprintf("🔖 Claude会话ID: %s（来源: %s）", rec.ID, rec.Source))
+	w.broadcastEvent(protocol.ClaudeSessionEvent{
+		Type:    protocol.EventClaudeSession,
+		Session: w.claudeSessions.get(),
+	})
+}
+
+// claudeHookPayload Claude hook 通过标准输入传给命令的JSON中用到的字段
+type claudeHookPayload struct {
+	SessionID      string `json:"session_id"`
+	TranscriptPath string `json:"transcript_path"`
+	Cwd            string `json:"cwd"`
+	HookEventName  string `json:"hook_event_name"`
+}
+
+// handleClaudeHook 接收Claude hook回调上报的会话ID，
+// 如 SessionStart hook: curl -s --unix-socket <sock> -d @- http://claudewarp/api/claude/hook
+func (w *ClaudeWarp) handleClaudeHook(wr http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(wr, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := w.requireController(wr, r); !ok {
+		return
+	}
+
+	var payload claudeHookPayload
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&payload); err != nil {
+		http.Error(wr, "需要Claude hook的JSON输入", http.StatusBadRequest)
+		return
+	}
+	if !claudeSessionIDPattern.MatchString(payload.SessionID) {
+		http.Error(wr, "session_id 无效", http.StatusBadRequest)
+		return
+	}
+	cwd := payload.Cwd
+	if cwd == "" {
+		w.childMux.RLock()
+		cwd = w.child.Cwd
+		w.childMux.RUnlock()
+	}
+	w.recordClaudeSession(ClaudeSession{
+		ID:         payload.SessionID,
+		Cwd:        cwd,
+		Transcript: payload.TranscriptPath,
+		Source:     protocol.ClaudeSessionFromHook,
+		UpdatedAt:  time.Now(),
+	})
+	// hook命令的标准输出可能被Claude当作上下文，不返回内容
+	wr.WriteHeader(http.StatusNoContent)
+}
+
+// claudeResumeEnv 恢复会话时传给启动命令的Claude会话ID环境变量
+const claudeResumeEnv = "CLAUDEWARP_RESUME_ID"
+
+// claudeResumeWrapper 恢复会话时放在PATH最前面的claude包装脚本：去掉包装目录后调用真正的claude，
+// 并加上 --resume。经PATH查找的调用（含 exec claude、env … claude）都会经过它；
+// 会话ID只用一次，claude再启动的子进程不会被恢复到同一会话
+const claudeResumeWrapper = `#!/bin/sh
+# 由claudewarp生成，恢复Claude会话时使用
+PATH=${PATH#"$(dirname "$0"):"}
+if [ -n "$` + claudeResumeEnv + `" ]; then
+	id=$` + claudeResumeEnv + `
+	unset ` + claudeResumeEnv + `
+	exec claude --resume "$id" "$@"
+fi
+exec claude "$@"
+`
+
+// claudePathPattern 以路径调用claude的命令，如 /usr/local/bin/claude --model opus
+var claudePathPattern = regexp.MustCompile(`^(\s*[\w.~/-]*/claude)(\s|$)`)
+
+// resumeScript 返回恢复会话时执行的启动脚本，以及是否需要PATH中的包装脚本。
+// 命令中已引用 $CLAUDEWARP_RESUME_ID 时由命令自行传递参数；以路径调用claude时直接在其后加上 --resume；
+// 其他情况（claude、exec claude、env … claude 等）由包装脚本处理
+func resumeScript(command string) (string, bool) {
+	if strings.Contains(command, claudeResumeEnv) {
+		return command, false
+	}
+	if loc := claudePathPattern.FindStringSubmatchIndex(command); loc != nil {
+		return command[:loc[3]] + ` --resume "$` + claudeResumeEnv + `"` + command[loc[3]:], false
+	}
+	return command, true
+}
+
+// writeResumeWrapper 在 <state_dir>/bin 下写入claude包装脚本，返回所在目录
+func writeResumeWrapper(stateDir string) (string, error) {
+	dir, err := filepath.Abs(filepath.Join(stateDir, "bin"))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	// 先写临时文件再改名，多个会话同时恢复时不会执行到写了一半的脚本
+	tmp, err := os.CreateTemp(dir, ".claude-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(claudeResumeWrapper); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Chmod(0755); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return dir, os.Rename(tmp.Name(), filepath.Join(dir, "claude"))
+}
+
+// prependPath 把dir加到环境变量列表中PATH的最前面（以最后一个PATH为准）
+func prependPath(env []string, dir string) []string {
+	path := ""
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, "PATH="); ok {
+			path = v
+		}
+	}
+	if path == "" {
+		return append(env, "PATH="+dir)
+	}
+	return append(env, "PATH="+dir+string(os.PathListSeparator)+path)
+}
+
+// resumeProfile 返回以 --resume 恢复指定会话的启动配置
+func resumeProfile(profile Profile, rec ClaudeSession) Profile {
+	profile.ResumeID = rec.ID
+	if rec.Cwd != "" {
+		profile.Cwd = rec.Cwd
+	}
+	return profile
+}
+
+// restartRequest 请求输出转发循环以新的配置重新启动Claude
+type restartRequest struct {
+	profile Profile
+	reply   chan error
+}
+
+// resumeClaude 结束当前Claude进程（如仍在运行），在原工作目录以 --resume 重新启动
+func (w *ClaudeWarp) resumeClaude(rec ClaudeSession) error {
+	if !claudeSessionIDPattern.MatchString(rec.ID) {
+		return fmt.Errorf("Claude会话ID无效: %q", rec.ID)
+	}
+	w.resumeMux.Lock()
+	defer w.resumeMux.Unlock()
+
+	w.childMux.RLock()
+	exited := w.child.Exited
+	child := w.proc
+	w.childMux.RUnlock()
+	if exited && !w.config().KeepAlive && !w.restarting.Load() && !w.worktree.active() {
+		return fmt.Errorf("Claude已退出且未启用 keep_alive，claudewarp正在关闭")
+	}
+
+	w.restarting.Store(true)
+	if !exited && child != nil {
+		stopChild(child)
+	}
+
+	req := restartRequest{profile: resumeProfile(w.sessionProfile(), rec), reply: make(chan error, 1)}
+	select {
+	case w.restartChan <- req:
+	case <-time.After(resumeTimeout):
+		w.restarting.Store(false)
+		return fmt.Errorf("等待Claude进程退出超时")
+	}
+	if err := <-req.reply; err != nil {
+		return fmt.Errorf("恢复Claude会话失败: %v", err)
+	}
+	w.addMessage("output", fmt.Sprintf("♻️ 已恢复Claude会话 %s", rec.ID))
+	return nil
+}
+
+// stopChild 向Claude进程组发送SIGTERM，超时仍未退出则强制结束
+func stopChild(child *claudeChild) {
+	// pty.Start 使子进程成为新会话的首进程，进程组ID即其PID
+	pgid := child.cmd.Process.Pid
+	syscall.Kill(-pgid, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-child.done:
+		case <-time.After(resumeKillAfter):
+			syscall.Kill(-pgid, syscall.SIGKILL)
+		}
+	}()
+}
+
+// handleResume 处理恢复Claude会话请求：POST /api/resume {"session_id": "..."}，
+// 未指定会话ID时使用记录的会话
+func (w *ClaudeWarp) handleResume(wr http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(wr, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := w.requireController(wr, r)
+	if !ok {
+		return
+	}
+
+	var req protocol.ResumeRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&req); err != nil && err != io.EOF {
+		http.Error(wr, "需要JSON请求体 {\"session_id\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+	rec := w.claudeSessions.get()
+	switch {
+	case req.SessionID != "" && (rec == nil || rec.ID != req.SessionID):
+		// 使用会话配置的工作目录（worktree处理完后已改回主仓库）
+		rec = &ClaudeSession{ID: req.SessionID}
+	case rec == nil:
+		http.Error(wr, "尚未识别到Claude会话ID，请在请求中指定 session_id", http.StatusConflict)
+		return
+	}
+
+	w.addMessage("output", fmt.Sprintf("♻️ %s 请求恢复Claude会话 %s", requestIdentity(user, r.RemoteAddr), rec.ID))
+	if err := w.resumeClaude(*rec); err != nil {
+		http.Error(wr, err.Error(), http.StatusConflict)
+		return
+	}
+	data, _ := json.Marshal(w.status())
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestResumeScript 各种调用claude的方式恢复会话时都带上 --resume，且只对第一次调用生效
+func TestResumeScript(t *testing.T) {
+	bin := t.TempDir()
+	// 假的claude：打印参数，CLAUDE_NESTED非空时再调用一次claude，模拟claude启动子进程
+	fake := "#!/bin/sh\necho \"claude $*\"\nif [ -n \"$CLAUDE_NESTED\" ]; then CLAUDE_NESTED= claude nested; fi\n"
+	claude := filepath.Join(bin, "claude")
+	if err := os.WriteFile(claude, []byte(fake), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wrapper, err := writeResumeWrapper(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const id = "0b6c5a52-3f1e-4d7a-9a53-1f2e3d4c5b6a"
+	tests := []struct {
+		name    string
+		command string
+		want    string
+	}{
+		{"bare", "claude --model opus", "claude --resume " + id + " --model opus"},
+		{"exec", "exec claude", "claude --resume " + id},
+		{"env", "env FOO=1 claude -c", "claude --resume " + id + " -c"},
+		{"pipeline", "claude 2>&1 | cat # comment", "claude --resume " + id},
+		{"absolute path", claude + " --verbose", "claude --resume " + id + " --verbose"},
+		{"explicit variable", `claude ${CLAUDEWARP_RESUME_ID:+--resume "$CLAUDEWARP_RESUME_ID"}`, "claude --resume " + id},
+		{"nested claude not resumed", "CLAUDE_NESTED=1 claude", "claude --resume " + id + "\nclaude nested"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, wrap := resumeScript(tt.command)
+			cmd := exec.Command("sh", "-c", script)
+			cmd.Env = []string{"PATH=" + bin + string(os.PathListSeparator) + "/usr/bin:/bin", claudeResumeEnv + "=" + id}
+			if wrap {
+				cmd.Env = prependPath(cmd.Env, wrapper)
+			}
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			if got := strings.TrimSpace(string(out)); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
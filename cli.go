@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runSubcommand 处理子命令，返回退出码及是否为子命令
+func runSubcommand(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+
+	switch args[0] {
+	case "config":
+		return runConfigCommand(args[1:]), true
+	case "audit":
+		return runAuditCommand(args[1:]), true
+	case "send":
+		return runSendCommand(args[1:]), true
+	case "wait":
+		return runWaitCommand(args[1:]), true
+	case "keys":
+		return runKeysCommand(args[1:]), true
+	case "mode":
+		return runModeCommand(args[1:]), true
+	case "screen":
+		return runScreenCommand(args[1:]), true
+	case "ls":
+		return runLsCommand(args[1:]), true
+	case "scheduler":
+		return runSchedulerCommand(args[1:]), true
+	}
+	return 0, false
+}
+
+// runConfigCommand 处理 claudewarp config <check>
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "用法: claudewarp config check [-config 文件] [参数...]")
+		return 2
+	}
+
+	cfg, path, err := loadConfig("claudewarp config check", args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if path == "" {
+		path = "（未使用配置文件）"
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 配置无效: %s\n", path)
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(os.Stderr, "  - %s\n", line)
+		}
+		return 1
+	}
+
+	profile, _ := cfg.SessionProfile()
+	fmt.Printf("✅ 配置有效: %s\n", path)
+	fmt.Printf("  监听地址: %s:%d\n", cfg.Host, cfg.Port)
+	fmt.Printf("  会话配置: %s（%s）\n", cfg.Profile, profile.Command)
+	fmt.Printf("  状态目录: %s\n", cfg.StateDir)
+	return 0
+}
+
+// runAuditCommand 处理 claudewarp audit verify
+func runAuditCommand(args []string) int {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "用法: claudewarp audit verify [-audit-log 文件] [-config 文件]")
+		return 2
+	}
+
+	cfg, _, err := loadConfig("claudewarp audit verify", args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	path := cfg.AuditLogPath()
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 打开审计日志失败: %v\n", err)
+		return 2
+	}
+	defer f.Close()
+
+	count, err := verifyAuditLog(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 审计日志校验失败（%s，前%d条完好）: %v\n", path, count, err)
+		return 1
+	}
+	fmt.Printf("✅ 审计日志完整: %s（%d 条记录）\n", path, count)
+	return 0
+}
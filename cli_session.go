@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/imneov/claudewarp/client"
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// 会话子命令的退出码，脚本可以依赖这些值
+const (
+	exitOK        = 0 // 成功
+	exitError     = 1 // 请求失败、输入被拒绝等
+	exitUsage     = 2 // 参数错误
+	exitTimeout   = 3 // 等待超时
+	exitNoSession = 4 // 会话不存在、无法连接或已退出
+)
+
+// sessionDialTimeout 连接会话的最长等待时间
+const sessionDialTimeout = 10 * time.Second
+
+// sessionFlags 会话子命令的公共参数
+type sessionFlags struct {
+	session  string
+	stateDir string
+	url      string
+	timeout  time.Duration
+}
+
+// newSessionFlagSet 创建带公共参数的子命令参数集
+func newSessionFlagSet(name string, sf *sessionFlags, timeout time.Duration) *flag.FlagSet {
+	fs := flag.NewFlagSet("claudewarp "+name, flag.ContinueOnError)
+	stateDir := os.Getenv("CLAUDEWARP_STATE_DIR")
+	if stateDir == "" {
+		stateDir = defaultStateDir()
+	}
+	fs.StringVar(&sf.session, "session", os.Getenv("CLAUDEWARP_SESSION"), "会话名（只有一个运行中的会话时可省略）")
+	fs.StringVar(&sf.stateDir, "state-dir", stateDir, "状态目录")
+	fs.StringVar(&sf.url, "url", "", "直接连接的地址（http://、https:// 或 unix:///path），忽略会话登记")
+	fs.DurationVar(&sf.timeout, "timeout", timeout, "最长等待时间")
+	return fs
+}
+
+// sessionError 带退出码的错误
+type sessionError struct {
+	code int
+	err  error
+}
+
+func (e *sessionError) Error() string { return e.err.Error() }
+
+// resolveSession 根据参数找到要连接的会话
+func (sf *sessionFlags) resolveSession() (sessionRecord, error) {
+	if sf.url != "" {
+		return sessionRecord{Name: sf.url, URL: sf.url}, nil
+	}
+
+	sessions, err := listSessions(sf.stateDir)
+	if err != nil {
+		return sessionRecord{}, &sessionError{exitError, fmt.Errorf("读取会话登记失败: %v", err)}
+	}
+	if sf.session != "" {
+		for _, s := range sessions {
+			if s.Name == sf.session {
+				return s, nil
+			}
+		}
+		return sessionRecord{}, &sessionError{exitNoSession, fmt.Errorf("会话 %q 不存在或已退出", sf.session)}
+	}
+
+	switch len(sessions) {
+	case 0:
+		return sessionRecord{}, &sessionError{exitNoSession, fmt.Errorf("没有运行中的会话（%s）", sessionDir(sf.stateDir))}
+	case 1:
+		return sessions[0], nil
+	}
+	names := make([]string, len(sessions))
+	for i, s := range sessions {
+		names[i] = s.Name
+	}
+	return sessionRecord{}, &sessionError{exitUsage, fmt.Errorf("有多个运行中的会话，请用 -session 指定: %s", strings.Join(names, ", "))}
+}
+
+// dial 连接会话并等待WebSocket就绪
+func (sf *sessionFlags) dial(ctx context.Context) (*client.Client, error) {
+	rec, err := sf.resolveSession()
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := rec.clientOptions()
+	if err != nil {
+		return nil, &sessionError{exitError, err}
+	}
+	c, err := client.New(rec.ClientURL(), opts)
+	if err != nil {
+		return nil, &sessionError{exitUsage, err}
+	}
+	// 连接阶段单独限时，无法连接时尽快失败而不是等满 -timeout
+	readyCtx, cancel := context.WithTimeout(ctx, sessionDialTimeout)
+	defer cancel()
+	if err := c.Ready(readyCtx); err != nil {
+		c.Close()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, &sessionError{exitNoSession, fmt.Errorf("无法连接会话 %s (%s)", rec.Name, rec.ClientURL())}
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// sessionExit 打印错误并返回对应的退出码
+func sessionExit(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var se *sessionError
+	code := exitError
+	switch {
+	case errors.As(err, &se):
+		code = se.code
+	case errors.Is(err, context.DeadlineExceeded):
+		code = exitTimeout
+		err = fmt.Errorf("等待超时")
+	case errors.Is(err, client.ErrExited):
+		code = exitNoSession
+	}
+	fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+	return code
+}
+
+// parseSessionFlags 解析参数，第二个返回值为false时应以第一个返回值退出
+func parseSessionFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// runSendCommand 处理 claudewarp send，发送输入并在Claude空闲后打印新输出
+func runSendCommand(args []string) int {
+	var sf sessionFlags
+	fs := newSessionFlagSet("send", &sf, 10*time.Minute)
+	noWait := fs.Bool("no-wait", false, "发送后立即返回，不等待Claude空闲")
+	raw := fs.Bool("raw", false, "不追加换行")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: claudewarp send [参数] 文本...（文本为 - 时从标准输入读取）")
+		fs.PrintDefaults()
+	}
+	if code, ok := parseSessionFlags(fs, args); !ok {
+		return code
+	}
+
+	text := strings.Join(fs.Args(), " ")
+	if text == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return sessionExit(fmt.Errorf("读取标准输入失败: %v", err))
+		}
+		text = strings.TrimRight(string(data), "\n")
+	}
+	if text == "" {
+		fs.Usage()
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sf.timeout)
+	defer cancel()
+	c, err := sf.dial(ctx)
+	if err != nil {
+		return sessionExit(err)
+	}
+	defer c.Close()
+
+	mark := c.TextMark()
+	var decision protocol.InputDecision
+	if *raw {
+		decision, err = c.SendRaw(ctx, text)
+	} else {
+		decision, err = c.Send(ctx, text)
+	}
+	if err != nil {
+		return sessionExit(err)
+	}
+	switch decision.Decision {
+	case protocol.DecisionHeld, protocol.DecisionQueued:
+		return sessionExit(fmt.Errorf("输入未立即写入（%s，id=%s）", decision.Decision, decision.ID))
+	}
+	if *noWait {
+		return exitOK
+	}
+
+	state, err := c.WaitForState(ctx, protocol.StateIdle, protocol.StateAwaitingApproval, protocol.StateRateLimited)
+	fmt.Print(c.TextSince(mark))
+	if err != nil {
+		return sessionExit(err)
+	}
+	switch state {
+	case protocol.StateAwaitingApproval:
+		fmt.Fprintln(os.Stderr, "⏸️  Claude 正在等待确认")
+	case protocol.StateRateLimited:
+		fmt.Fprintln(os.Stderr, "⏳ Claude 用量已达上限，重置后将自动继续")
+	}
+	return exitOK
+}
+
+// runWaitCommand 处理 claudewarp wait，阻塞直到会话空闲、出现提示或输出匹配
+func runWaitCommand(args []string) int {
+	var sf sessionFlags
+	fs := newSessionFlagSet("wait", &sf, 10*time.Minute)
+	waitFor := fs.String("for", "idle", "等待条件: idle（停在输入框）、prompt（输入框或等待确认）、pattern（输出匹配 -pattern）")
+	pattern := fs.String("pattern", "", "-for pattern 使用的正则表达式，匹配当前屏幕及之后的输出")
+	if code, ok := parseSessionFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "❌ 未知参数: %s\n", strings.Join(fs.Args(), " "))
+		return exitUsage
+	}
+
+	var re *regexp.Regexp
+	switch *waitFor {
+	case "idle", "prompt":
+	case "pattern":
+		var err error
+		if re, err = regexp.Compile(*pattern); err != nil || *pattern == "" {
+			fmt.Fprintf(os.Stderr, "❌ -for pattern 需要有效的 -pattern 正则\n")
+			return exitUsage
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "❌ -for 只能是 idle、prompt 或 pattern\n")
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sf.timeout)
+	defer cancel()
+	c, err := sf.dial(ctx)
+	if err != nil {
+		return sessionExit(err)
+	}
+	defer c.Close()
+
+	switch *waitFor {
+	case "idle":
+		_, err = c.WaitForState(ctx, protocol.StateIdle)
+		if err == nil {
+			fmt.Println(protocol.StateIdle)
+		}
+	case "prompt":
+		var state protocol.State
+		if state, err = c.WaitForState(ctx, protocol.StateIdle, protocol.StateAwaitingApproval); err == nil {
+			fmt.Println(state)
+		}
+	case "pattern":
+		// 先记录位置再取快照，避免漏掉两者之间的输出
+		mark := c.TextMark()
+		var screen protocol.Screen
+		if screen, err = c.Snapshot(ctx); err != nil {
+			break
+		}
+		m := re.FindString(screen.Text)
+		if m == "" {
+			m, err = c.WaitForPatternFrom(ctx, re, mark)
+		}
+		if err == nil {
+			fmt.Println(m)
+		}
+	}
+	return sessionExit(err)
+}
+
+// runKeysCommand 处理 claudewarp keys，按名称发送按键
+func runKeysCommand(args []string) int {
+	var sf sessionFlags
+	fs := newSessionFlagSet("keys", &sf, 30*time.Second)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: claudewarp keys [参数] 按键...（如 esc、enter、shift-tab、up、ctrl-c）")
+		fs.PrintDefaults()
+	}
+	if code, ok := parseSessionFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	for _, name := range fs.Args() {
+		if _, err := protocol.KeySequence(name); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitUsage
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sf.timeout)
+	defer cancel()
+	c, err := sf.dial(ctx)
+	if err != nil {
+		return sessionExit(err)
+	}
+	defer c.Close()
+
+	decision, err := c.SendKeys(ctx, fs.Args()...)
+	if err == nil && decision.Decision != protocol.DecisionAllowed {
+		err = fmt.Errorf("按键未立即写入（%s，id=%s）", decision.Decision, decision.ID)
+	}
+	return sessionExit(err)
+}
+
+// runModeCommand 处理 claudewarp mode [模式]：查询或切换Claude的权限模式
+func runModeCommand(args []string) int {
+	var sf sessionFlags
+	fs := newSessionFlagSet("mode", &sf, 30*time.Second)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: claudewarp mode [参数] [default|accept_edits|plan|bypass_permissions]")
+		fs.PrintDefaults()
+	}
+	if code, ok := parseSessionFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sf.timeout)
+	defer cancel()
+	c, err := sf.dial(ctx)
+	if err != nil {
+		return sessionExit(err)
+	}
+	defer c.Close()
+
+	if fs.NArg() == 0 {
+		st, err := c.Status(ctx)
+		if err == nil {
+			fmt.Println(st.Mode)
+		}
+		return sessionExit(err)
+	}
+	result, err := c.SetMode(ctx, protocol.Mode(fs.Arg(0)))
+	if err == nil {
+		fmt.Println(result.Mode)
+	}
+	return sessionExit(err)
+}
+
+// runScreenCommand 处理 claudewarp screen，打印当前屏幕文本
+func runScreenCommand(args []string) int {
+	var sf sessionFlags
+	fs := newSessionFlagSet("screen", &sf, 30*time.Second)
+	if code, ok := parseSessionFlags(fs, args); !ok {
+		return code
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sf.timeout)
+	defer cancel()
+	c, err := sf.dial(ctx)
+	if err != nil {
+		return sessionExit(err)
+	}
+	defer c.Close()
+
+	screen, err := c.Snapshot(ctx)
+	if err != nil {
+		return sessionExit(err)
+	}
+	fmt.Print(screen.Text)
+	return exitOK
+}
+
+// runLsCommand 处理 claudewarp ls，列出本机运行中的会话
+func runLsCommand(args []string) int {
+	var sf sessionFlags
+	fs := newSessionFlagSet("ls", &sf, 2*time.Second)
+	if code, ok := parseSessionFlags(fs, args); !ok {
+		return code
+	}
+
+	sessions, err := listSessions(sf.stateDir)
+	if err != nil {
+		return sessionExit(err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPID\tPROFILE\tSTATE\tADDRESS\tCWD")
+	for _, s := range sessions {
+		state := "unreachable"
+		one := sf
+		one.session, one.url = s.Name, ""
+		ctx, cancel := context.WithTimeout(context.Background(), sf.timeout)
+		if c, err := one.dial(ctx); err == nil {
+			state = string(c.State())
+			c.Close()
+		}
+		cancel()
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", s.Name, s.PID, s.Profile, state, s.ClientURL(), s.Cwd)
+	}
+	tw.Flush()
+	return exitOK
+}
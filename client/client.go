@@ -0,0 +1,591 @@
+// Package client 是驱动 claudewarp 会话的 Go SDK。
+//
+// Client 通过 HTTP API 发送输入、读取状态和屏幕快照，并维持一条自动重连的
+// WebSocket 连接接收事件。重连时从上次收到的输出偏移续传，不会丢失或重复输出。
+//
+//	c, err := client.New("unix:///run/claudewarp.sock", nil)
+//	if err != nil { ... }
+//	defer c.Close()
+//	c.Send(ctx, "解释一下这个仓库")
+//	c.WaitForIdle(ctx)
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// ErrExited 会话的Claude进程已退出
+var ErrExited = errors.New("claudewarp: 会话已退出")
+
+// ErrClosed 客户端已关闭
+var ErrClosed = errors.New("claudewarp: 客户端已关闭")
+
+// textLimit WaitForPattern 可回看的纯文本字节数
+const textLimit = 256 * 1024
+
+// Options 客户端选项，零值可用
+type Options struct {
+	TLSConfig      *tls.Config   // https/wss 使用的TLS配置（自签名证书、客户端证书等）
+	Header         http.Header   // 每个请求附加的HTTP头
+	ReconnectDelay time.Duration // WebSocket断线后重连的等待时间，默认1秒
+	Timeout        time.Duration // HTTP请求超时，默认30秒
+}
+
+// Event 是从WebSocket收到的事件，Type 对应 protocol.Event* 常量，
+// 与类型匹配的字段非空；Raw 保留原始JSON以便处理其他事件。
+type Event struct {
+	Type     string
+	Terminal *protocol.TerminalData
+	State    *protocol.StateEvent
+	Message  *protocol.MessageEvent
+	Prompt   *protocol.PromptEvent
+	Decision *protocol.InputDecision
+	Raw      json.RawMessage
+}
+
+// APIError 服务端返回的非成功响应
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("claudewarp: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Client 连接一个 claudewarp 会话
+type Client struct {
+	base   string // HTTP基础地址，如 http://127.0.0.1:8080
+	wsURL  string // WebSocket地址
+	header http.Header
+	http   *http.Client
+	dialer *websocket.Dialer
+	delay  time.Duration
+
+	mu       sync.Mutex
+	subs     map[chan Event]struct{}
+	next     int64 // 下一段输出的偏移，-1表示尚未收到
+	state    protocol.State
+	stateSeq int64 // 状态每变化一次加一
+	sendSeq  int64 // 最近一次发送时的stateSeq，-1表示未发送过
+	sendText int64 // 最近一次发送时纯文本流的末尾位置，-1表示未发送过
+	text     textStream
+	changed  chan struct{} // 状态或输出变化时关闭并替换
+	closed   bool
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// New 创建客户端并在后台建立WebSocket连接。
+// rawURL 支持 http://host:port、https://host:port 和 unix:///path/to.sock。
+func New(rawURL string, opts *Options) (*Client, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("claudewarp: 无效的地址 %q: %v", rawURL, err)
+	}
+
+	transport := &http.Transport{TLSClientConfig: opts.TLSConfig}
+	dialer := &websocket.Dialer{TLSClientConfig: opts.TLSConfig, HandshakeTimeout: 10 * time.Second}
+	c := &Client{
+		header:   opts.Header,
+		dialer:   dialer,
+		delay:    opts.ReconnectDelay,
+		subs:     make(map[chan Event]struct{}),
+		next:     -1,
+		sendSeq:  -1,
+		sendText: -1,
+		text:     textStream{limit: textLimit},
+		changed:  make(chan struct{}),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if c.delay <= 0 {
+		c.delay = time.Second
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		c.base = u.Scheme + "://" + u.Host
+		if u.Scheme == "https" {
+			c.wsURL = "wss://" + u.Host + "/ws"
+		} else {
+			c.wsURL = "ws://" + u.Host + "/ws"
+		}
+	case "unix":
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+		if path == "" {
+			return nil, fmt.Errorf("claudewarp: unix地址缺少socket路径: %q", rawURL)
+		}
+		dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		transport.DialContext = dial
+		dialer.NetDialContext = dial
+		c.base = "http://unix"
+		c.wsURL = "ws://unix/ws"
+	default:
+		return nil, fmt.Errorf("claudewarp: 不支持的地址协议 %q", u.Scheme)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	c.http = &http.Client{Transport: transport, Timeout: timeout}
+
+	go c.run()
+	return c, nil
+}
+
+// Close 断开WebSocket连接并关闭所有事件订阅
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.quit)
+	c.mu.Unlock()
+
+	<-c.done
+
+	c.mu.Lock()
+	for ch := range c.subs {
+		close(ch)
+		delete(c.subs, ch)
+	}
+	close(c.changed)
+	c.mu.Unlock()
+	return nil
+}
+
+// Events 订阅事件，ctx结束或客户端关闭时通道被关闭。
+// 订阅者处理过慢时新事件会被丢弃，需要完整输出时请使用 WaitForPattern。
+func (c *Client) Events(ctx context.Context) <-chan Event {
+	ch := make(chan Event, 256)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		close(ch)
+		return ch
+	}
+	c.subs[ch] = struct{}{}
+	c.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.quit:
+			return
+		}
+		c.mu.Lock()
+		if _, ok := c.subs[ch]; ok {
+			delete(c.subs, ch)
+			close(ch)
+		}
+		c.mu.Unlock()
+	}()
+	return ch
+}
+
+// run 维持WebSocket连接，断线后从上次的输出偏移续传
+func (c *Client) run() {
+	defer close(c.done)
+	for {
+		c.connect()
+		select {
+		case <-c.quit:
+			return
+		case <-time.After(c.delay):
+		}
+	}
+}
+
+// connect 建立一次WebSocket连接并读取事件直到断开
+func (c *Client) connect() {
+	wsURL := c.wsURL
+	c.mu.Lock()
+	if c.next >= 0 {
+		wsURL += "?offset=" + strconv.FormatInt(c.next, 10)
+	}
+	c.mu.Unlock()
+
+	conn, _, err := c.dialer.Dial(wsURL, c.header)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Close时中断阻塞的读取
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-c.quit:
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.dispatch(data)
+	}
+}
+
+// dispatch 解析事件、更新本地状态并分发给订阅者
+func (c *Client) dispatch(data []byte) {
+	var head protocol.Event
+	if err := json.Unmarshal(data, &head); err != nil {
+		return
+	}
+	ev := Event{Type: head.Type, Raw: json.RawMessage(data)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch head.Type {
+	case protocol.EventTerminalData:
+		var td protocol.TerminalData
+		if json.Unmarshal(data, &td) != nil {
+			return
+		}
+		if td.Offset >= 0 {
+			// 续传时可能与已收到的输出重叠，去掉重复部分
+			if c.next > td.Offset {
+				skip := c.next - td.Offset
+				if skip >= int64(len(td.Content)) {
+					return
+				}
+				td.Content = td.Content[skip:]
+				td.Offset = c.next
+			}
+			c.next = td.Offset + int64(len(td.Content))
+		}
+		c.text.Write(td.Content)
+		ev.Terminal = &td
+	case protocol.EventState:
+		var se protocol.StateEvent
+		if json.Unmarshal(data, &se) != nil {
+			return
+		}
+		if se.State != c.state {
+			c.state = se.State
+			c.stateSeq++
+		}
+		ev.State = &se
+	case protocol.EventMessage:
+		var me protocol.MessageEvent
+		if json.Unmarshal(data, &me) != nil {
+			return
+		}
+		ev.Message = &me
+	case protocol.EventPrompt:
+		var pe protocol.PromptEvent
+		if json.Unmarshal(data, &pe) != nil {
+			return
+		}
+		ev.Prompt = &pe
+	case protocol.EventInputDecision:
+		var d protocol.InputDecision
+		if json.Unmarshal(data, &d) != nil {
+			return
+		}
+		ev.Decision = &d
+	}
+
+	close(c.changed)
+	c.changed = make(chan struct{})
+
+	for ch := range c.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// wait 等待cond成立；cond在持有锁时调用
+func (c *Client) wait(ctx context.Context, cond func() (bool, error)) error {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return ErrClosed
+		}
+		ok, err := cond()
+		changed := c.changed
+		c.mu.Unlock()
+		if ok || err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Ready 等待WebSocket首次连接成功并收到会话状态
+func (c *Client) Ready(ctx context.Context) error {
+	return c.wait(ctx, func() (bool, error) {
+		return c.state != "", nil
+	})
+}
+
+// State 返回最近收到的会话状态，尚未连接时为空
+func (c *Client) State() protocol.State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// WaitForIdle 等待Claude停在输入框。
+// 调用过 Send/SendKeys 时，只接受发送之后进入的空闲状态。
+func (c *Client) WaitForIdle(ctx context.Context) error {
+	_, err := c.WaitForState(ctx, protocol.StateIdle)
+	return err
+}
+
+// WaitForState 等待会话进入states中的任一状态并返回该状态，会话退出时返回 ErrExited。
+// 调用过 Send/SendKeys 时，只接受发送之后进入的状态。
+func (c *Client) WaitForState(ctx context.Context, states ...protocol.State) (protocol.State, error) {
+	var got protocol.State
+	err := c.wait(ctx, func() (bool, error) {
+		if c.stateSeq > c.sendSeq {
+			for _, state := range states {
+				if c.state == state {
+					got = state
+					return true, nil
+				}
+			}
+		}
+		if c.state == protocol.StateExited {
+			return false, ErrExited
+		}
+		return false, nil
+	})
+	return got, err
+}
+
+// TextMark 返回当前纯文本输出流的位置，配合 TextSince 读取之后的输出
+func (c *Client) TextMark() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.text.End()
+}
+
+// TextSince 返回从mark开始收到的纯文本输出（已去除ANSI转义序列）
+func (c *Client) TextSince(mark int64) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return string(c.text.Since(mark))
+}
+
+// WaitForPattern 等待输出（已去除ANSI转义序列）匹配re，返回匹配的文本。
+// 只匹配最近一次 Send/SendKeys 之后的输出；尚未发送过时只匹配调用之后的输出。
+func (c *Client) WaitForPattern(ctx context.Context, re *regexp.Regexp) (string, error) {
+	c.mu.Lock()
+	start := c.sendText
+	if start < 0 {
+		start = c.text.End()
+	}
+	c.mu.Unlock()
+	return c.WaitForPatternFrom(ctx, re, start)
+}
+
+// WaitForPatternFrom 等待从mark（见 TextMark）开始的输出匹配re，返回匹配的文本
+func (c *Client) WaitForPatternFrom(ctx context.Context, re *regexp.Regexp, start int64) (string, error) {
+	var match string
+	err := c.wait(ctx, func() (bool, error) {
+		if m := re.Find(c.text.Since(start)); m != nil {
+			match = string(m)
+			return true, nil
+		}
+		if c.state == protocol.StateExited {
+			return false, ErrExited
+		}
+		return false, nil
+	})
+	return match, err
+}
+
+// Send 发送一行文本（自动追加换行），返回服务端的策略决策。
+// 输入被挂起等待审批时 Decision 为 protocol.DecisionHeld，err 为nil。
+func (c *Client) Send(ctx context.Context, text string) (protocol.InputDecision, error) {
+	return c.send(ctx, protocol.InputRequest{Input: text, AddNewline: true})
+}
+
+// SendRaw 原样发送输入，不追加换行
+func (c *Client) SendRaw(ctx context.Context, data string) (protocol.InputDecision, error) {
+	return c.send(ctx, protocol.InputRequest{Input: data})
+}
+
+// SendKeys 按名称发送按键序列，如 SendKeys(ctx, "esc") 或 SendKeys(ctx, "down", "enter")
+func (c *Client) SendKeys(ctx context.Context, names ...string) (protocol.InputDecision, error) {
+	var b strings.Builder
+	for _, name := range names {
+		seq, err := protocol.KeySequence(name)
+		if err != nil {
+			return protocol.InputDecision{}, err
+		}
+		b.WriteString(seq)
+	}
+	return c.SendRaw(ctx, b.String())
+}
+
+func (c *Client) send(ctx context.Context, req protocol.InputRequest) (protocol.InputDecision, error) {
+	var decision protocol.InputDecision
+	body, _ := json.Marshal(req)
+
+	c.mu.Lock()
+	c.sendSeq = c.stateSeq
+	c.sendText = c.text.End()
+	c.mu.Unlock()
+
+	data, status, err := c.do(ctx, http.MethodPost, "/api/input", body)
+	if err != nil {
+		return decision, err
+	}
+	if json.Unmarshal(data, &decision) != nil {
+		return decision, &APIError{StatusCode: status, Message: strings.TrimSpace(string(data))}
+	}
+	if decision.Decision == protocol.DecisionDenied {
+		return decision, &APIError{StatusCode: status, Message: "输入被策略拒绝: " + decision.Rule}
+	}
+	return decision, nil
+}
+
+// Status 返回会话状态（/api/status）
+func (c *Client) Status(ctx context.Context) (protocol.Status, error) {
+	var st protocol.Status
+	err := c.getJSON(ctx, "/api/status", &st)
+	return st, err
+}
+
+// Snapshot 返回当前屏幕文本快照（/api/screen）
+func (c *Client) Snapshot(ctx context.Context) (protocol.Screen, error) {
+	var sc protocol.Screen
+	err := c.getJSON(ctx, "/api/screen", &sc)
+	return sc, err
+}
+
+// Messages 返回消息历史（/api/messages）
+func (c *Client) Messages(ctx context.Context) ([]protocol.Message, error) {
+	var msgs []protocol.Message
+	err := c.getJSON(ctx, "/api/messages", &msgs)
+	return msgs, err
+}
+
+// Pending 返回等待审批的输入（/api/input/pending）
+func (c *Client) Pending(ctx context.Context) ([]protocol.PendingInput, error) {
+	var pending []protocol.PendingInput
+	err := c.getJSON(ctx, "/api/input/pending", &pending)
+	return pending, err
+}
+
+// Enqueue 向会话的任务队列追加一条提示（POST /api/queue），Claude空闲时自动提交
+func (c *Client) Enqueue(ctx context.Context, prompt string) (protocol.QueueItem, error) {
+	var resp protocol.QueueAdded
+	body, _ := json.Marshal(map[string]string{"prompt": prompt})
+	data, status, err := c.do(ctx, http.MethodPost, "/api/queue", body)
+	if err != nil {
+		return protocol.QueueItem{}, err
+	}
+	if err := json.Unmarshal(data, &resp); err != nil || resp.Item == nil {
+		return protocol.QueueItem{}, &APIError{StatusCode: status, Message: strings.TrimSpace(string(data))}
+	}
+	return *resp.Item, nil
+}
+
+// SetMode 通过Shift+Tab把Claude切换到指定权限模式，返回切换后的模式及按键次数
+func (c *Client) SetMode(ctx context.Context, mode protocol.Mode) (protocol.ModeResult, error) {
+	var result protocol.ModeResult
+	body, _ := json.Marshal(protocol.ModeRequest{Mode: mode})
+	data, status, err := c.do(ctx, http.MethodPost, "/api/mode", body)
+	if err != nil {
+		return result, err
+	}
+	if status != http.StatusOK || json.Unmarshal(data, &result) != nil {
+		return result, &APIError{StatusCode: status, Message: strings.TrimSpace(string(data))}
+	}
+	return result, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, v interface{}) error {
+	data, status, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return &APIError{StatusCode: status, Message: strings.TrimSpace(string(data))}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("claudewarp: 解析 %s 响应失败: %v", path, err)
+	}
+	return nil
+}
+
+// do 发送HTTP请求；2xx以外且无JSON响应体时返回 *APIError
+func (c *Client) do(ctx context.Context, method, path string, body []byte) ([]byte, int, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, r)
+	if err != nil {
+		return nil, 0, err
+	}
+	for k, vs := range c.header {
+		req.Header[k] = vs
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode >= 300 && !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return nil, resp.StatusCode, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+	return data, resp.StatusCode, nil
+}
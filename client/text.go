@@ -0,0 +1,33 @@
+package client
+
+import "github.com/imneov/claudewarp/protocol"
+
+// textStream 去除终端输出中的ANSI转义序列，跨帧保持解析状态
+type textStream struct {
+	data     []byte
+	base     int64 // data[0] 在纯文本流中的位置
+	limit    int
+	stripper protocol.TextStripper
+}
+
+// Write 追加终端输出的纯文本部分
+func (s *textStream) Write(p string) {
+	s.data = s.stripper.AppendText(s.data, []byte(p))
+	if over := len(s.data) - s.limit; over > 0 {
+		s.data = append(s.data[:0], s.data[over:]...)
+		s.base += int64(over)
+	}
+}
+
+// End 返回纯文本流的末尾位置
+func (s *textStream) End() int64 {
+	return s.base + int64(len(s.data))
+}
+
+// Since 返回从pos开始仍保留的纯文本
+func (s *textStream) Since(pos int64) []byte {
+	if pos < s.base {
+		pos = s.base
+	}
+	return s.data[pos-s.base:]
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// SlashCommand Claude斜杠命令
+type SlashCommand = protocol.SlashCommand
+
+// builtinCommands Claude内置的斜杠命令
+var builtinCommands = []SlashCommand{
+	{Name: "add-dir", Description: "添加额外的工作目录", ArgumentHint: "<路径>"},
+	{Name: "agents", Description: "管理自定义子代理"},
+	{Name: "bug", Description: "向Anthropic报告问题"},
+	{Name: "clear", Description: "清空对话历史"},
+	{Name: "compact", Description: "压缩对话历史，可附带压缩重点", ArgumentHint: "[说明]"},
+	{Name: "config", Description: "查看或修改配置"},
+	{Name: "context", Description: "查看上下文占用"},
+	{Name: "cost", Description: "显示本次会话的token用量"},
+	{Name: "doctor", Description: "检查Claude Code安装状况"},
+	{Name: "exit", Description: "退出Claude"},
+	{Name: "export", Description: "导出当前对话"},
+	{Name: "help", Description: "显示帮助"},
+	{Name: "hooks", Description: "管理hook配置"},
+	{Name: "init", Description: "生成项目的CLAUDE.md"},
+	{Name: "login", Description: "切换Anthropic账号"},
+	{Name: "logout", Description: "退出Anthropic账号"},
+	{Name: "mcp", Description: "管理MCP服务器"},
+	{Name: "memory", Description: "编辑CLAUDE.md记忆文件"},
+	{Name: "model", Description: "选择或切换模型", ArgumentHint: "[模型]"},
+	{Name: "permissions", Description: "查看或修改工具权限"},
+	{Name: "pr-comments", Description: "查看Pull Request评论"},
+	{Name: "resume", Description: "恢复之前的对话"},
+	{Name: "review", Description: "请求代码审查"},
+	{Name: "rewind", Description: "回退对话和代码到之前的位置"},
+	{Name: "status", Description: "查看账号和系统状态"},
+	{Name: "terminal-setup", Description: "安装Shift+Enter换行的按键绑定"},
+	{Name: "todos", Description: "列出当前的待办事项"},
+	{Name: "usage", Description: "查看套餐用量限制"},
+	{Name: "vim", Description: "切换vim编辑模式"},
+}
+
+// loadCommands 返回内置命令及项目、用户目录下的自定义命令
+func loadCommands(profile Profile, cwd string) []SlashCommand {
+	commands := make([]SlashCommand, 0, len(builtinCommands))
+	for _, cmd := range builtinCommands {
+		cmd.Source = protocol.CommandBuiltin
+		commands = append(commands, cmd)
+	}
+	if cwd != "" {
+		commands = append(commands, scanCommands(filepath.Join(cwd, ".claude", "commands"), protocol.CommandProject)...)
+	}
+	if base := claudeConfigDir(profile); base != "" {
+		commands = append(commands, scanCommands(filepath.Join(base, "commands"), protocol.CommandUser)...)
+	}
+	sort.SliceStable(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+// scanCommands 扫描命令目录下的 .md 文件，文件名即命令名，子目录作为命名空间
+func scanCommands(dir, source string) []SlashCommand {
+	var commands []SlashCommand
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".md") {
+			return nil
+		}
+		cmd := SlashCommand{
+			Name:   strings.TrimSuffix(d.Name(), ".md"),
+			Source: source,
+		}
+		if rel, err := filepath.Rel(dir, filepath.Dir(path)); err == nil && rel != "." {
+			cmd.Namespace = filepath.ToSlash(rel)
+		}
+		cmd.Description, cmd.ArgumentHint = readCommandFile(path)
+		commands = append(commands, cmd)
+		return nil
+	})
+	return commands
+}
+
+// readCommandFile 读取命令文件frontmatter中的 description 和 argument-hint，
+// 没有description时使用正文第一行
+func readCommandFile(path string) (description, argumentHint string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	inFrontmatter := false
+	for line := 0; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == 0 && text == "---":
+			inFrontmatter = true
+		case inFrontmatter && text == "---":
+			inFrontmatter = false
+		case inFrontmatter:
+			key, value, ok := strings.Cut(text, ":")
+			if !ok {
+				continue
+			}
+			value = strings.Trim(strings.TrimSpace(value), `"'`)
+			switch strings.TrimSpace(key) {
+			case "description":
+				description = value
+			case "argument-hint":
+				argumentHint = value
+			}
+		case text != "" && description == "":
+			description = strings.TrimLeft(text, "# ")
+			return truncateText(description, 200), argumentHint
+		case description != "":
+			return description, argumentHint
+		}
+	}
+	return description, argumentHint
+}
+
+// handleCommands 返回可用的斜杠命令，自定义命令每次请求时重新扫描
+func (w *ClaudeWarp) handleCommands(wr http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(wr, "仅支持GET方法", http.StatusMethodNotAllowed)
+		return
+	}
+	w.childMux.RLock()
+	cwd := w.child.Cwd
+	w.childMux.RUnlock()
+
+	data, _ := json.Marshal(loadCommands(w.sessionProfile(), cwd))
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
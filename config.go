@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config claudewarp配置，优先级：内置默认值 < 配置文件 < 环境变量 < 命令行参数
+type Config struct {
+	Host        string             `json:"host"`
+	Port        int                `json:"port"`
+	StateDir    string             `json:"state_dir"`
+	Session     string             `json:"session"`  // 会话名，供CLI子命令定位，默认与profile相同
+	Profile     string             `json:"profile"`  // 使用的会话配置名
+	Profiles    map[string]Profile `json:"profiles"` // 命名会话配置
+	TLS         TLSConfig          `json:"tls"`
+	Notify      NotifyConfig       `json:"notify"`
+	Redact      RedactConfig       `json:"redact"`
+	Audit       AuditConfig        `json:"audit"`
+	Auth        AuthConfig         `json:"auth"`
+	Policy      PolicyConfig       `json:"policy"`
+	Unix        UnixConfig         `json:"unix"`
+	Responders  []ResponderRule    `json:"responders"`  // 自动应答规则
+	Schedules   []ScheduleRule     `json:"schedules"`   // 定时任务
+	RateLimit   RateLimitConfig    `json:"rate_limit"`  // 用量限制检测与自动继续
+	Usage       UsageConfig        `json:"usage"`       // token用量价格表与预算
+	Workspace   WorkspaceConfig    `json:"workspace"`   // 工作目录变化跟踪
+	Checkpoints CheckpointConfig   `json:"checkpoints"` // 提交提示前的工作目录快照
+	Web         WebConfig          `json:"web"`         // Web界面
+	KeepAlive   bool               `json:"keep_alive"`  // Claude退出后保持运行，等待通过 /api/resume 恢复
+	Headless    bool               `json:"-"`           // 无控制台运行（由定时任务在后台启动会话时使用）
+	Resume      bool               `json:"-"`           // 启动时恢复上次记录的Claude会话
+	Worktree    bool               `json:"-"`           // 为本会话创建git worktree（与 profiles.<名>.worktree 相同）
+}
+
+// Profile 命名会话配置
+type Profile struct {
+	Command  string            `json:"command"`            // 启动Claude的shell命令
+	Cwd      string            `json:"cwd,omitempty"`      // 工作目录，默认为当前目录
+	Env      map[string]string `json:"env,omitempty"`      // 额外环境变量
+	Worktree bool              `json:"worktree,omitempty"` // 在工作目录所在仓库新建分支和git worktree，Claude在其中运行
+	ResumeID string            `json:"-"`                  // 以 --resume 恢复的Claude会话ID，经环境变量传入启动命令
+}
+
+// TLSConfig TLS配置
+type TLSConfig struct {
+	Cert       string `json:"cert"`
+	Key        string `json:"key"`
+	SelfSigned bool   `json:"self_signed"`
+	ClientCA   string `json:"client_ca"`
+}
+
+// NotifyConfig 状态检测与通知配置（支持SIGHUP热加载）
+type NotifyConfig struct {
+	IdleAfter Duration       `json:"idle_after"`
+	Webhook   string         `json:"webhook"`
+	Bell      bool           `json:"bell"`
+	States    []SessionState `json:"states"` // 触发通知的状态
+}
+
+// RedactConfig 脱敏配置（支持SIGHUP热加载）
+type RedactConfig struct {
+	Patterns []string `json:"patterns"`
+}
+
+// WebConfig Web界面配置（支持SIGHUP热加载）
+type WebConfig struct {
+	CDN bool `json:"cdn"` // 前端依赖未内置时从CDN加载（需要外网），默认开启；离线环境可关闭
+}
+
+// UnixConfig Unix domain socket监听配置
+type UnixConfig struct {
+	Path        string `json:"path"`         // socket路径，为空则不监听
+	Mode        string `json:"mode"`         // 文件权限（八进制），默认0600
+	Owner       string `json:"owner"`        // 属主 "用户[:组]"
+	AllowedUIDs []int  `json:"allowed_uids"` // 允许发送输入的本地UID，为空时仅限当前用户
+	Only        bool   `json:"only"`         // 只监听Unix socket，不开放TCP端口
+}
+
+// AuthConfig 用户角色配置，用户名来自mTLS客户端证书
+type AuthConfig struct {
+	DefaultRole string            `json:"default_role"` // 未列出的用户（含匿名）的角色，未设置时见 defaultRole
+	Users       map[string]string `json:"users"`        // 用户名 -> 角色
+}
+
+// RoleFor 返回用户角色
+func (c *Config) RoleFor(user string) string {
+	if role, ok := c.Auth.Users[user]; ok && user != "" {
+		return role
+	}
+	return c.defaultRole()
+}
+
+// defaultRole 未列出的用户的角色：未显式配置时，只监听本机且未配置用户时为controller，
+// 监听非本地地址或配置了用户时为viewer
+func (c *Config) defaultRole() string {
+	if c.Auth.DefaultRole != "" {
+		return c.Auth.DefaultRole
+	}
+	if len(c.Auth.Users) > 0 || (!c.Unix.Only && !isLoopbackHost(c.Host)) {
+		return RoleViewer
+	}
+	return RoleController
+}
+
+// AuditConfig 输入审计日志配置
+type AuditConfig struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path"` // 默认为 <state_dir>/audit.log
+}
+
+// AuditLogPath 返回审计日志路径
+func (c *Config) AuditLogPath() string {
+	if c.Audit.Path != "" {
+		return c.Audit.Path
+	}
+	return filepath.Join(c.StateDir, "audit.log")
+}
+
+// Duration 支持 "2s"、"1m30s" 格式的JSON时长
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("时长必须是字符串（如 \"2s\"）")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// defaultProfileName 未指定时使用的会话配置名
+const defaultProfileName = "default"
+
+// defaultConfig 内置默认配置
+func defaultConfig() *Config {
+	return &Config{
+		Host:     "localhost",
+		Port:     8080,
+		StateDir: defaultStateDir(),
+		Profile:  defaultProfileName,
+		Notify: NotifyConfig{
+			IdleAfter: Duration{2 * time.Second},
+			States:    []SessionState{StateIdle, StateAwaitingApproval, StateExited},
+		},
+		RateLimit: RateLimitConfig{
+			ResumePrompt: "continue",
+			Grace:        Duration{time.Minute},
+			Fallback:     Duration{time.Hour},
+		},
+		Workspace: WorkspaceConfig{
+			Enabled:  true,
+			Interval: Duration{10 * time.Second},
+		},
+		Checkpoints: CheckpointConfig{Enabled: true, Limit: 100},
+		Audit:       AuditConfig{Enabled: true},
+		Web:         WebConfig{CDN: true},
+		Policy: PolicyConfig{
+			Default:     PolicyAllow,
+			HoldTimeout: Duration{10 * time.Minute},
+		},
+	}
+}
+
+// 环境变量到命令行参数的映射
+var envOverrides = map[string]string{
+	"CLAUDEWARP_HOST":            "host",
+	"CLAUDEWARP_PORT":            "port",
+	"CLAUDEWARP_STATE_DIR":       "state-dir",
+	"CLAUDEWARP_PROFILE":         "profile",
+	"CLAUDEWARP_SESSION":         "session",
+	"CLAUDEWARP_IDLE_AFTER":      "idle-after",
+	"CLAUDEWARP_NOTIFY_WEBHOOK":  "notify-webhook",
+	"CLAUDEWARP_BELL":            "bell",
+	"CLAUDEWARP_RESUME_PROMPT":   "resume-prompt",
+	"CLAUDEWARP_KEEP_ALIVE":      "keep-alive",
+	"CLAUDEWARP_WORKSPACE":       "workspace",
+	"CLAUDEWARP_CHECKPOINTS":     "checkpoints",
+	"CLAUDEWARP_TLS_CERT":        "tls-cert",
+	"CLAUDEWARP_TLS_KEY":         "tls-key",
+	"CLAUDEWARP_TLS_SELF_SIGNED": "tls-self-signed",
+	"CLAUDEWARP_TLS_CLIENT_CA":   "tls-client-ca",
+	"CLAUDEWARP_AUDIT_LOG":       "audit-log",
+	"CLAUDEWARP_UNIX_SOCKET":     "unix-socket",
+	"CLAUDEWARP_WEB_CDN":         "web-cdn",
+}
+
+// registerFlags 注册与配置字段绑定的命令行参数
+func registerFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.IntVar(&cfg.Port, "port", cfg.Port, "Web监控端口")
+	fs.StringVar(&cfg.Host, "host", cfg.Host, "Web监控主机地址")
+	fs.StringVar(&cfg.StateDir, "state-dir", cfg.StateDir, "状态目录（证书等持久化数据）")
+	fs.StringVar(&cfg.Profile, "profile", cfg.Profile, "使用的会话配置名")
+	fs.StringVar(&cfg.Session, "session", cfg.Session, "会话名（默认与profile相同），供 claudewarp send 等子命令定位")
+	fs.DurationVar(&cfg.Notify.IdleAfter.Duration, "idle-after", cfg.Notify.IdleAfter.Duration, "输出静默多久后判定为空闲")
+	fs.StringVar(&cfg.Notify.Webhook, "notify-webhook", cfg.Notify.Webhook, "状态变化时通知的Webhook地址")
+	fs.BoolVar(&cfg.Notify.Bell, "bell", cfg.Notify.Bell, "空闲或等待确认时在本地终端响铃")
+	fs.StringVar(&cfg.RateLimit.ResumePrompt, "resume-prompt", cfg.RateLimit.ResumePrompt, "用量限制重置后自动发送的提示，为空则不发送")
+	fs.StringVar(&cfg.TLS.Cert, "tls-cert", cfg.TLS.Cert, "TLS证书文件")
+	fs.StringVar(&cfg.TLS.Key, "tls-key", cfg.TLS.Key, "TLS私钥文件")
+	fs.BoolVar(&cfg.TLS.SelfSigned, "tls-self-signed", cfg.TLS.SelfSigned, "自动生成并使用自签名证书")
+	fs.StringVar(&cfg.TLS.ClientCA, "tls-client-ca", cfg.TLS.ClientCA, "客户端证书CA文件，指定后启用mTLS")
+	fs.Var((*stringList)(&cfg.Redact.Patterns), "redact", "自定义脱敏正则（可重复指定）")
+	fs.BoolVar(&cfg.Audit.Enabled, "audit", cfg.Audit.Enabled, "记录输入审计日志")
+	fs.StringVar(&cfg.Audit.Path, "audit-log", cfg.Audit.Path, "审计日志路径（默认 <state-dir>/audit.log）")
+	fs.StringVar(&cfg.Unix.Path, "unix-socket", cfg.Unix.Path, "监听的Unix socket路径")
+	fs.StringVar(&cfg.Unix.Mode, "unix-socket-mode", cfg.Unix.Mode, "Unix socket文件权限（八进制，默认0600）")
+	fs.StringVar(&cfg.Unix.Owner, "unix-socket-owner", cfg.Unix.Owner, "Unix socket属主（用户[:组]）")
+	fs.BoolVar(&cfg.Unix.Only, "unix-only", cfg.Unix.Only, "只监听Unix socket，不开放TCP端口")
+	fs.BoolVar(&cfg.Web.CDN, "web-cdn", cfg.Web.CDN, "前端依赖未内置时从CDN加载（-web-cdn=false 关闭）")
+	fs.BoolVar(&cfg.KeepAlive, "keep-alive", cfg.KeepAlive, "Claude退出后保持运行，可在Web界面或 /api/resume 恢复会话")
+	fs.BoolVar(&cfg.Workspace.Enabled, "workspace", cfg.Workspace.Enabled, "跟踪Claude工作目录中的文件变化（git diff）")
+	fs.BoolVar(&cfg.Checkpoints.Enabled, "checkpoints", cfg.Checkpoints.Enabled, "提交提示前把工作目录快照保存为检查点")
+	fs.BoolVar(&cfg.Worktree, "worktree", cfg.Worktree, "在工作目录所在仓库新建分支和git worktree，Claude在其中运行")
+	fs.BoolVar(&cfg.Resume, "resume", cfg.Resume, "启动时以 --resume 恢复该会话上次记录的Claude会话")
+	fs.BoolVar(&cfg.Headless, "headless", cfg.Headless, "无控制台运行：不读取标准输入，也不向标准输出转发终端内容")
+}
+
+// loadConfig 解析命令行参数、配置文件和环境变量，返回合并后的配置及配置文件路径
+func loadConfig(name string, args []string) (*Config, string, error) {
+	// 第一遍解析：获取配置文件路径并记录显式指定的参数
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cliCfg := defaultConfig()
+	registerFlags(fs, cliCfg)
+	configPath := fs.String("config", os.Getenv("CLAUDEWARP_CONFIG"), "配置文件路径（默认 <state-dir>/config.json）")
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() > 0 {
+		return nil, "", fmt.Errorf("未知参数: %s", strings.Join(fs.Args(), " "))
+	}
+
+	path := *configPath
+	if path == "" {
+		candidate := filepath.Join(cliCfg.StateDir, "config.json")
+		if _, err := os.Stat(candidate); err == nil {
+			path = candidate
+		}
+	}
+
+	cfg := defaultConfig()
+	if path != "" {
+		if err := readConfigFile(path, cfg); err != nil {
+			return nil, path, err
+		}
+	}
+
+	// 依次应用环境变量和显式指定的命令行参数
+	apply := flag.NewFlagSet(name, flag.ContinueOnError)
+	apply.SetOutput(io.Discard)
+	registerFlags(apply, cfg)
+
+	envNames := make([]string, 0, len(envOverrides))
+	for env := range envOverrides {
+		envNames = append(envNames, env)
+	}
+	sort.Strings(envNames)
+	for _, env := range envNames {
+		if v, ok := os.LookupEnv(env); ok {
+			if err := apply.Set(envOverrides[env], v); err != nil {
+				return nil, path, fmt.Errorf("环境变量 %s 无效: %v", env, err)
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" {
+			return
+		}
+		if list, ok := f.Value.(*stringList); ok {
+			for _, v := range *list {
+				err = apply.Set(f.Name, v)
+			}
+			return
+		}
+		err = apply.Set(f.Name, f.Value.String())
+	})
+	if err != nil {
+		return nil, path, err
+	}
+	return cfg, path, nil
+}
+
+// readConfigFile 读取JSON配置文件，未知字段视为错误
+func readConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+			return fmt.Errorf("配置文件 %s 第%d行语法错误: %v", path, line, err)
+		}
+		return fmt.Errorf("配置文件 %s 解析失败: %v", path, err)
+	}
+	return nil
+}
+
+// Validate 校验配置，返回所有问题
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Port <= 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port 必须在 1-65535 之间，当前为 %d", c.Port))
+	}
+	if c.Host == "" {
+		errs = append(errs, fmt.Errorf("host 不能为空"))
+	}
+	if c.StateDir == "" {
+		errs = append(errs, fmt.Errorf("state_dir 不能为空"))
+	}
+
+	if _, err := c.SessionProfile(); err != nil {
+		errs = append(errs, err)
+	}
+	if !validSessionName(c.SessionName()) {
+		errs = append(errs, fmt.Errorf("session 只能包含字母、数字、'.'、'_' 和 '-'，当前为 %q", c.SessionName()))
+	}
+	for name, p := range c.Profiles {
+		if strings.TrimSpace(p.Command) == "" {
+			errs = append(errs, fmt.Errorf("profiles.%s.command 不能为空", name))
+		}
+		if p.Cwd != "" {
+			if info, err := os.Stat(p.Cwd); err != nil || !info.IsDir() {
+				errs = append(errs, fmt.Errorf("profiles.%s.cwd 不是有效目录: %s", name, p.Cwd))
+			}
+		}
+	}
+
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		errs = append(errs, fmt.Errorf("tls.cert 和 tls.key 必须同时指定"))
+	}
+	for field, path := range map[string]string{"tls.cert": c.TLS.Cert, "tls.key": c.TLS.Key, "tls.client_ca": c.TLS.ClientCA} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			errs = append(errs, fmt.Errorf("%s 文件不可用: %v", field, err))
+		}
+	}
+
+	errs = append(errs, c.Notify.validate()...)
+	errs = append(errs, c.RateLimit.validate()...)
+	errs = append(errs, c.Usage.validate()...)
+	errs = append(errs, c.Workspace.validate()...)
+	errs = append(errs, c.Checkpoints.validate()...)
+	errs = append(errs, c.Redact.validate()...)
+	errs = append(errs, c.Policy.validate()...)
+	if c.Policy.usesHold() && c.TLS.ClientCA == "" && c.Unix.Path == "" {
+		errs = append(errs, fmt.Errorf("policy 的 hold 动作需要认证身份区分发送者与审批人：请配置 tls.client_ca（mTLS）或 unix.path"))
+	}
+	errs = append(errs, validateResponders(c.Responders)...)
+	errs = append(errs, c.validateSchedules()...)
+	errs = append(errs, c.Unix.validate()...)
+	for user, role := range c.Auth.Users {
+		if role != RoleController && role != RoleViewer {
+			errs = append(errs, fmt.Errorf("auth.users.%s 的角色必须是 controller 或 viewer", user))
+		}
+	}
+	if c.Auth.DefaultRole != "" && c.Auth.DefaultRole != RoleController && c.Auth.DefaultRole != RoleViewer {
+		errs = append(errs, fmt.Errorf("auth.default_role 必须是 controller 或 viewer"))
+	}
+	return errors.Join(errs...)
+}
+
+// validate 校验通知配置
+func (n NotifyConfig) validate() []error {
+	var errs []error
+	if n.IdleAfter.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("notify.idle_after 必须大于0"))
+	}
+	if n.Webhook != "" {
+		if u, err := url.Parse(n.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("notify.webhook 不是有效的HTTP(S)地址: %s", n.Webhook))
+		}
+	}
+	for _, state := range n.States {
+		switch state {
+		case StateRunning, StateIdle, StateAwaitingApproval, StateRateLimited, StateExited:
+		default:
+			errs = append(errs, fmt.Errorf("notify.states 包含未知状态: %s", state))
+		}
+	}
+	return errs
+}
+
+// validate 校验脱敏配置
+func (r RedactConfig) validate() []error {
+	var errs []error
+	for _, expr := range r.Patterns {
+		if _, err := regexp.Compile(expr); err != nil {
+			errs = append(errs, fmt.Errorf("redact.patterns 中的正则 %q 无效: %v", expr, err))
+		}
+	}
+	return errs
+}
+
+// SessionProfile 返回当前使用的会话配置
+func (c *Config) SessionProfile() (Profile, error) {
+	if p, ok := c.Profiles[c.Profile]; ok {
+		return p, nil
+	}
+	if c.Profile == defaultProfileName {
+		return Profile{Command: "claude"}, nil
+	}
+
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return Profile{}, fmt.Errorf("未找到会话配置 %q（可用: %s）", c.Profile, strings.Join(names, ", "))
+}
+
+// reloadConfig 重新加载配置，仅应用无需重启子进程的设置（通知、脱敏、角色、输入策略、自动应答与定时任务）
+func (w *ClaudeWarp) reloadConfig() {
+	cfg, _, err := loadConfig(os.Args[0], os.Args[1:])
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		w.addMessage("error", fmt.Sprintf("重新加载配置失败，保留原配置: %v", err))
+		return
+	}
+
+	w.notifier.update(cfg.Notify)
+	w.tracker.setIdleAfter(cfg.Notify.IdleAfter.Duration)
+	w.tracker.setRateLimitFallback(cfg.RateLimit.Fallback.Duration)
+	w.usage.update(cfg.Usage)
+	w.redactor.SetCustom(cfg.Redact.Patterns)
+	w.policy.update(cfg.Policy)
+	w.responders.update(cfg.Responders)
+	w.broadcastResponders()
+	defer w.broadcastSchedules() // 在释放配置锁之后执行
+
+	w.cfgMux.Lock()
+	defer w.cfgMux.Unlock()
+	old := w.cfg
+	if old.Host != cfg.Host || old.Port != cfg.Port || old.Profile != cfg.Profile || old.Session != cfg.Session ||
+		old.StateDir != cfg.StateDir || old.TLS != cfg.TLS || old.Unix.Path != cfg.Unix.Path ||
+		old.Unix.Mode != cfg.Unix.Mode || old.Unix.Owner != cfg.Unix.Owner || old.Unix.Only != cfg.Unix.Only {
+		w.addMessage("output", "⚠️ 监听地址、会话配置或TLS的变更需要重启后生效")
+	}
+	cfg.Host, cfg.Port, cfg.Profile, cfg.Session, cfg.StateDir, cfg.TLS = old.Host, old.Port, old.Profile, old.Session, old.StateDir, old.TLS
+	cfg.Unix.Path, cfg.Unix.Mode, cfg.Unix.Owner, cfg.Unix.Only = old.Unix.Path, old.Unix.Mode, old.Unix.Owner, old.Unix.Only
+	cfg.Headless, cfg.Resume, cfg.Workspace.Enabled = old.Headless, old.Resume, old.Workspace.Enabled
+	w.cfg = cfg
+	w.scheduler.setConfig(cfg)
+	w.addMessage("output", "🔄 配置已重新加载")
+}
+
+// config 返回当前配置
+func (w *ClaudeWarp) config() *Config {
+	w.cfgMux.RLock()
+	defer w.cfgMux.RUnlock()
+	return w.cfg
+}
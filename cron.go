@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSpec 解析后的5段cron表达式（分 时 日 月 周），按本地时间计算
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool // 日、周以 * 开头时只按另一个字段匹配
+}
+
+// cronField 一个字段的取值范围与名称
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // 名称对应 min 起的取值，如月份 jan..dec
+}
+
+var cronFields = []cronField{
+	{name: "分钟", min: 0, max: 59},
+	{name: "小时", min: 0, max: 23},
+	{name: "日", min: 1, max: 31},
+	{name: "月", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "星期", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// cronMacros 常用表达式的简写
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron 解析cron表达式，支持 *、列表（1,3）、范围（1-5）、步长（*/15、9-17/2）、
+// 月份与星期名称（jan、mon-fri）以及 @daily 等简写，星期中 0 和 7 都表示周日
+func parseCron(expr string) (*cronSpec, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron表达式需要5段（分 时 日 月 周），当前为 %q", expr)
+	}
+
+	var bits [5]uint64
+	for i, part := range parts {
+		b, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+	// 星期7与0同为周日
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+	return &cronSpec{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: strings.HasPrefix(parts[2], "*"),
+		dowAny: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+// parseCronField 解析一个字段，返回取值位图
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s字段的步长无效: %q", f.name, item)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		if rangePart != "*" {
+			loPart, hiPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = f.value(loPart); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(hiPart); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "5/15" 表示从5开始到最大值
+				hi = f.max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s字段的范围无效: %q", f.name, item)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value 解析字段中的单个数值或名称
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s字段的取值 %q 无效（%d-%d）", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// cronSearchLimit 查找下次执行时间的最大跨度，超过则认为表达式永远不会触发（如 2月30日）
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// cronAllHours 小时字段为 * 时的位图
+const cronAllHours = 1<<24 - 1
+
+// next 返回t之后（不含t所在的分钟）第一个匹配的时间，找不到时返回零值。
+// 夏令时开始时跳过的时刻不会触发；夏令时结束时重复的一小时内，指定了小时的任务只在第一次经过时触发
+func (c *cronSpec) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		prev := t
+		y, m, d := t.Date()
+		switch {
+		case c.month&(1<<uint(m)) == 0:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		case c.hour != cronAllHours && t.Add(-time.Hour).Hour() == t.Hour():
+			// 夏令时结束后第二次经过同一时刻
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+		// 夏令时开始时不存在的时刻会被规范化到更早的时间，此时按实际时间前进到下一个整点
+		if !t.After(prev) {
+			t = prev.Add(time.Duration(60-prev.Minute()) * time.Minute)
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches 日与周都有限制时任一匹配即可（与标准cron一致），否则按受限的那个字段匹配
+func (c *cronSpec) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "* * * * *"},
+		{expr: "*/15 9-17 * * mon-fri"},
+		{expr: "0 0 1,15 jan,jul *"},
+		{expr: "5/20 * * * 7"},
+		{expr: "@daily"},
+		{expr: "  @Hourly  "},
+		{expr: "* * * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * 13 *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "10-5 * * * *", wantErr: true},
+		{expr: "* * * * foo", wantErr: true},
+		{expr: "@never", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("缺少时区数据:", err)
+	}
+	utc := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		{
+			name: "every 15 minutes excludes current minute",
+			expr: "*/15 * * * *",
+			from: utc(10, 19, 10, 15),
+			want: []time.Time{utc(10, 19, 10, 30), utc(10, 19, 10, 45), utc(10, 19, 11, 0)},
+		},
+		{
+			name: "weekdays only",
+			expr: "0 9 * * mon-fri",
+			from: utc(10, 23, 12, 0), // 周五
+			want: []time.Time{utc(10, 26, 9, 0), utc(10, 27, 9, 0)},
+		},
+		{
+			name: "day of month or weekday",
+			expr: "0 0 1 * sun",
+			from: utc(10, 19, 0, 0), // 周一
+			want: []time.Time{utc(10, 25, 0, 0), utc(11, 1, 0, 0), utc(11, 8, 0, 0)},
+		},
+		{
+			name: "sunday as 7",
+			expr: "0 12 * * 7",
+			from: utc(10, 19, 0, 0),
+			want: []time.Time{utc(10, 25, 12, 0)},
+		},
+		{
+			name: "month rollover",
+			expr: "0 0 31 * *",
+			from: utc(10, 31, 0, 0),
+			want: []time.Time{utc(12, 31, 0, 0)},
+		},
+		{
+			name: "never fires",
+			expr: "0 0 30 2 *",
+			from: utc(1, 1, 0, 0),
+			want: []time.Time{{}},
+		},
+		{
+			name: "dst start skips the missing hour",
+			expr: "30 2 * * *",
+			from: time.Date(2026, 3, 7, 3, 0, 0, 0, ny),
+			want: []time.Time{time.Date(2026, 3, 9, 2, 30, 0, 0, ny)},
+		},
+		{
+			name: "dst start hourly",
+			expr: "0 * * * *",
+			from: time.Date(2026, 3, 8, 0, 30, 0, 0, ny),
+			want: []time.Time{
+				time.Date(2026, 3, 8, 1, 0, 0, 0, ny),
+				time.Date(2026, 3, 8, 3, 0, 0, 0, ny),
+			},
+		},
+		{
+			name: "dst end fires once in the repeated hour",
+			expr: "30 1 * * *",
+			from: time.Date(2026, 10, 31, 3, 0, 0, 0, ny),
+			want: []time.Time{
+				time.Date(2026, 11, 1, 1, 30, 0, 0, time.FixedZone("EDT", -4*3600)),
+				time.Date(2026, 11, 2, 1, 30, 0, 0, ny),
+			},
+		},
+		{
+			name: "dst end hourly fires in both passes",
+			expr: "0 * * * *",
+			from: time.Date(2026, 11, 1, 0, 30, 0, 0, ny),
+			want: []time.Time{
+				time.Date(2026, 11, 1, 1, 0, 0, 0, time.FixedZone("EDT", -4*3600)),
+				time.Date(2026, 11, 1, 1, 0, 0, 0, time.FixedZone("EST", -5*3600)),
+				time.Date(2026, 11, 1, 2, 0, 0, 0, ny),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			at := tt.from
+			for i, want := range tt.want {
+				at = spec.next(at)
+				if !at.Equal(want) {
+					t.Fatalf("第%d次: next = %v, want %v", i+1, at, want)
+				}
+			}
+		})
+	}
+}
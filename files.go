@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+const (
+	fileViewLimit     = 1 << 20  // 查看文件时返回的最大字节数
+	fileDownloadLimit = 20 << 20 // 可下载的最大文件大小
+	fileListLimit     = 5000     // 目录列表最多返回的条目数
+	fileSniffLen      = 8 << 10  // 判断是否为二进制文件时检查的字节数
+)
+
+// errPathOutside 请求的路径不在会话工作目录内
+var errPathOutside = errors.New("路径不在会话工作目录内")
+
+// errPathIgnored 请求的路径被 .gitignore 忽略或位于 .git 目录中
+var errPathIgnored = errors.New("路径被 .gitignore 忽略或位于 .git 目录中，不可查看")
+
+// confinePath 把相对路径解析为会话工作目录root内的真实路径。
+// 拒绝绝对路径和 .. ，解析符号链接后仍须位于root内。
+func confinePath(root, rel string) (realRoot, real string, err error) {
+	if realRoot, err = filepath.EvalSymlinks(root); err != nil {
+		return "", "", err
+	}
+	rel = filepath.FromSlash(rel)
+	if rel == "" || rel == "." {
+		return realRoot, realRoot, nil
+	}
+	if filepath.IsAbs(rel) || !filepath.IsLocal(rel) {
+		return "", "", errPathOutside
+	}
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if part == ".." {
+			return "", "", errPathOutside
+		}
+	}
+	if real, err = filepath.EvalSymlinks(filepath.Join(realRoot, rel)); err != nil {
+		return "", "", err
+	}
+	if !withinDir(realRoot, real) {
+		return "", "", errPathOutside
+	}
+	return realRoot, real, nil
+}
+
+// withinDir 判断path是否为dir或其下的路径
+func withinDir(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// gitIgnored 返回rels中被 .gitignore 忽略的路径，dir不在git仓库中时为空
+func gitIgnored(dir string, rels []string) map[string]bool {
+	ignored := make(map[string]bool)
+	if len(rels) == 0 {
+		return ignored
+	}
+	// 没有被忽略的路径时 git check-ignore 以状态码1退出
+	input := []byte(strings.Join(rels, "\x00") + "\x00")
+	out, _ := runGitInput(dir, nil, input, "check-ignore", "-z", "--stdin")
+	for _, p := range strings.Split(string(out), "\x00") {
+		if p != "" {
+			ignored[p] = true
+		}
+	}
+	return ignored
+}
+
+// hiddenPath 判断路径是否位于 .git 目录中
+func hiddenPath(rel string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if part == ".git" {
+			return true
+		}
+	}
+	return false
+}
+
+// listDir 列出目录，跳过 .git、被忽略的文件和指向工作目录外的符号链接
+func listDir(root, dir string) (protocol.FileListing, error) {
+	relDir, _ := filepath.Rel(root, dir)
+	listing := protocol.FileListing{Path: filepath.ToSlash(relDir), Entries: []protocol.FileEntry{}}
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return listing, err
+	}
+
+	var entries []protocol.FileEntry
+	var rels []string
+	targets := make(map[string]string) // 符号链接 -> 目标的相对路径
+	for _, item := range items {
+		rel := filepath.ToSlash(filepath.Join(relDir, item.Name()))
+		if hiddenPath(rel) {
+			continue
+		}
+		info, err := item.Info()
+		if err != nil {
+			continue
+		}
+		entry := protocol.FileEntry{Name: item.Name(), Path: rel, Type: protocol.FileTypeFile, Size: info.Size(), ModTime: info.ModTime()}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := filepath.EvalSymlinks(filepath.Join(dir, item.Name()))
+			if err != nil || !withinDir(root, target) {
+				continue
+			}
+			entry.Type = protocol.FileTypeSymlink
+			if target != root {
+				targetRel, _ := filepath.Rel(root, target)
+				targets[rel] = filepath.ToSlash(targetRel)
+				rels = append(rels, targets[rel])
+			}
+		case info.IsDir():
+			entry.Type, entry.Size = protocol.FileTypeDir, 0
+		case !info.Mode().IsRegular():
+			continue
+		}
+		entries = append(entries, entry)
+		rels = append(rels, rel)
+	}
+
+	ignored := gitIgnored(root, rels)
+	for _, entry := range entries {
+		if target, ok := targets[entry.Path]; ok && (hiddenPath(target) || ignored[target]) {
+			continue
+		}
+		if !ignored[entry.Path] {
+			listing.Entries = append(listing.Entries, entry)
+		}
+	}
+	sort.Slice(listing.Entries, func(i, j int) bool {
+		a, b := listing.Entries[i], listing.Entries[j]
+		if (a.Type == protocol.FileTypeDir) != (b.Type == protocol.FileTypeDir) {
+			return a.Type == protocol.FileTypeDir
+		}
+		return a.Name < b.Name
+	})
+	if len(listing.Entries) > fileListLimit {
+		listing.Entries, listing.Truncated = listing.Entries[:fileListLimit], true
+	}
+	return listing, nil
+}
+
+// handleFiles 只读浏览会话工作目录：GET /api/files?path=<相对路径>，
+// 目录返回列表，文件返回内容；加 download=1 下载文件
+func (w *ClaudeWarp) handleFiles(wr http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(wr, "仅支持GET方法", http.StatusMethodNotAllowed)
+		return
+	}
+	w.childMux.RLock()
+	cwd := w.child.Cwd
+	w.childMux.RUnlock()
+	if cwd == "" {
+		http.Error(wr, "Claude尚未启动", http.StatusServiceUnavailable)
+		return
+	}
+
+	root, real, err := confinePath(cwd, r.URL.Query().Get("path"))
+	if err != nil {
+		writeFileError(wr, err)
+		return
+	}
+	rel, _ := filepath.Rel(root, real)
+	rel = filepath.ToSlash(rel)
+	if rel != "." && (hiddenPath(rel) || gitIgnored(root, []string{rel})[rel]) {
+		writeFileError(wr, errPathIgnored)
+		return
+	}
+
+	// 打开解析后的真实路径，不再跟随符号链接
+	f, err := os.OpenFile(real, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		writeFileError(wr, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeFileError(wr, err)
+		return
+	}
+
+	if info.IsDir() {
+		listing, err := listDir(root, real)
+		if err != nil {
+			writeFileError(wr, err)
+			return
+		}
+		data, _ := json.Marshal(listing)
+		wr.Header().Set("Content-Type", "application/json")
+		wr.Write(data)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		http.Error(wr, "不是普通文件", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("download") != "" {
+		w.downloadFile(wr, f, info)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(f, fileViewLimit))
+	if err != nil {
+		writeFileError(wr, err)
+		return
+	}
+	content := protocol.FileContent{Path: rel, Size: info.Size(), ModTime: info.ModTime(), Truncated: info.Size() > fileViewLimit}
+	if isBinary(data) {
+		content.Binary = true
+	} else {
+		content.Content = w.redactor.Redact(string(data))
+	}
+	out, _ := json.Marshal(content)
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(out)
+}
+
+// downloadFile 以附件形式返回文件，文本文件同样经过脱敏
+func (w *ClaudeWarp) downloadFile(wr http.ResponseWriter, f *os.File, info os.FileInfo) {
+	if info.Size() > fileDownloadLimit {
+		http.Error(wr, fmt.Sprintf("文件超过 %d MiB，不可下载", fileDownloadLimit>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(f, fileDownloadLimit))
+	if err != nil {
+		writeFileError(wr, err)
+		return
+	}
+	if !isBinary(data) {
+		data = []byte(w.redactor.Redact(string(data)))
+	}
+	wr.Header().Set("Content-Type", "application/octet-stream")
+	wr.Header().Set("X-Content-Type-Options", "nosniff")
+	wr.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Name()}))
+	wr.Write(data)
+}
+
+// isBinary 开头包含NUL字节的视为二进制文件
+func isBinary(data []byte) bool {
+	if len(data) > fileSniffLen {
+		data = data[:fileSniffLen]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// writeFileError 把文件访问错误转换为HTTP状态码，不暴露工作目录外的路径
+func writeFileError(wr http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errPathOutside), errors.Is(err, errPathIgnored):
+		http.Error(wr, err.Error(), http.StatusForbidden)
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(wr, "文件不存在", http.StatusNotFound)
+	case errors.Is(err, os.ErrPermission):
+		http.Error(wr, "没有读取权限", http.StatusForbidden)
+	case errors.Is(err, syscall.ELOOP):
+		http.Error(wr, errPathOutside.Error(), http.StatusForbidden)
+	default:
+		http.Error(wr, "读取失败", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfinePath(t *testing.T) {
+	base := t.TempDir()
+	if real, err := filepath.EvalSymlinks(base); err == nil {
+		base = real
+	}
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	writeTestFile(t, root, "src/main.go", "package main\n")
+	writeTestFile(t, outside, "secret.txt", "secret\n")
+
+	links := map[string]string{
+		"src/link.go":     "main.go",
+		"up":              "..",
+		"escape":          outside,
+		"escape-file.txt": filepath.Join(outside, "secret.txt"),
+		"src/sibling":     filepath.Join("..", "..", "outside"),
+		"self":            root,
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip("无法创建符号链接:", err)
+		}
+	}
+	// 工作目录本身是符号链接时按真实路径判断
+	rootLink := filepath.Join(base, "root-link")
+	if err := os.Symlink(root, rootLink); err != nil {
+		t.Skip("无法创建符号链接:", err)
+	}
+
+	tests := []struct {
+		name    string
+		root    string
+		rel     string
+		want    string
+		wantErr error
+	}{
+		{name: "root", root: root, rel: "", want: root},
+		{name: "dot", root: root, rel: ".", want: root},
+		{name: "file", root: root, rel: "src/main.go", want: filepath.Join(root, "src/main.go")},
+		{name: "symlink inside", root: root, rel: "src/link.go", want: filepath.Join(root, "src/main.go")},
+		{name: "symlink to root", root: root, rel: "self/src", want: filepath.Join(root, "src")},
+		{name: "root via symlink", root: rootLink, rel: "src/main.go", want: filepath.Join(root, "src/main.go")},
+		{name: "parent", root: root, rel: "..", wantErr: errPathOutside},
+		{name: "parent traversal", root: root, rel: "../outside/secret.txt", wantErr: errPathOutside},
+		{name: "dotdot inside", root: root, rel: "src/../src/main.go", wantErr: errPathOutside},
+		{name: "absolute", root: root, rel: filepath.Join(outside, "secret.txt"), wantErr: errPathOutside},
+		{name: "symlink to parent", root: root, rel: "up/outside/secret.txt", wantErr: errPathOutside},
+		{name: "symlink to outside dir", root: root, rel: "escape/secret.txt", wantErr: errPathOutside},
+		{name: "symlink to outside file", root: root, rel: "escape-file.txt", wantErr: errPathOutside},
+		{name: "relative symlink escaping", root: root, rel: "src/sibling/secret.txt", wantErr: errPathOutside},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			realRoot, real, err := confinePath(tt.root, tt.rel)
+			if err != tt.wantErr {
+				t.Fatalf("confinePath(%q) error = %v, want %v", tt.rel, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if realRoot != root {
+				t.Errorf("realRoot = %q, want %q", realRoot, root)
+			}
+			if real != tt.want {
+				t.Errorf("real = %q, want %q", real, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := confinePath(root, "missing.txt"); err == nil || err == errPathOutside {
+		t.Errorf("missing file: error = %v, want not-exist error", err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// fsWatchLimit 最多监听的目录数，超出部分依靠定期检查
+const fsWatchLimit = 4096
+
+// fsWatchMask 触发重新检查的inotify事件
+const fsWatchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF
+
+// fsWatcher 通过inotify递归监听目录树（跳过 .git 和被忽略的目录），有变化时向事件通道发送通知
+type fsWatcher struct {
+	fd     int
+	file   *os.File // 非阻塞fd交给运行时轮询，Close可以中断读取
+	events chan struct{}
+	mu     sync.Mutex
+	dirs   map[int]string // watch描述符 -> 目录
+}
+
+// newFSWatcher 监听root下的所有目录
+func newFSWatcher(root string) (*fsWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	fw := &fsWatcher{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan struct{}, 1),
+		dirs:   make(map[int]string),
+	}
+	if err := fw.addTree(root); err != nil {
+		fw.file.Close()
+		return nil, err
+	}
+	go fw.read()
+	return fw, nil
+}
+
+// addTree 递归添加目录监听，跳过 .git 和被 .gitignore 忽略的目录（如 node_modules）
+func (fw *fsWatcher) addTree(root string) error {
+	wd, err := syscall.InotifyAddWatch(fw.fd, root, fsWatchMask)
+	if err != nil {
+		return err
+	}
+	fw.mu.Lock()
+	fw.dirs[wd] = root
+	fw.mu.Unlock()
+
+	queue := []string{root}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		var names []string
+		for _, e := range entries {
+			if e.IsDir() && e.Name() != ".git" {
+				names = append(names, e.Name())
+			}
+		}
+		// 每个目录检查一次其子目录是否被忽略
+		ignored := gitIgnored(dir, names)
+		for _, name := range names {
+			if ignored[name] {
+				continue
+			}
+			fw.mu.Lock()
+			full := len(fw.dirs) >= fsWatchLimit
+			fw.mu.Unlock()
+			if full {
+				return nil
+			}
+			path := filepath.Join(dir, name)
+			wd, err := syscall.InotifyAddWatch(fw.fd, path, fsWatchMask)
+			if err != nil {
+				continue
+			}
+			fw.mu.Lock()
+			fw.dirs[wd] = path
+			fw.mu.Unlock()
+			queue = append(queue, path)
+		}
+	}
+	return nil
+}
+
+// read 读取inotify事件，新建的目录加入监听
+func (fw *fsWatcher) read() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := fw.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			offset = nameStart + int(ev.Len)
+
+			fw.mu.Lock()
+			dir := fw.dirs[int(ev.Wd)]
+			if ev.Mask&syscall.IN_IGNORED != 0 {
+				delete(fw.dirs, int(ev.Wd))
+			}
+			fw.mu.Unlock()
+			if ev.Mask&syscall.IN_ISDIR != 0 && ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 && dir != "" && offset <= n {
+				name := string(buf[nameStart:offset])
+				if i := strings.IndexByte(name, 0); i >= 0 {
+					name = name[:i]
+				}
+				if name != ".git" && !gitIgnored(dir, []string{name})[name] {
+					fw.addTree(filepath.Join(dir, name))
+				}
+			}
+		}
+		select {
+		case fw.events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Events 返回变化通知通道
+func (fw *fsWatcher) Events() <-chan struct{} {
+	return fw.events
+}
+
+// Close 停止监听
+func (fw *fsWatcher) Close() error {
+	return fw.file.Close()
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// fsWatcher 当前平台不支持inotify，只依靠定期检查
+type fsWatcher struct{}
+
+// newFSWatcher 当前平台不支持文件系统通知
+func newFSWatcher(root string) (*fsWatcher, error) {
+	return nil, errors.New("当前平台不支持inotify")
+}
+
+// Events 返回变化通知通道
+func (fw *fsWatcher) Events() <-chan struct{} {
+	return nil
+}
+
+// Close 停止监听
+func (fw *fsWatcher) Close() error {
+	return nil
+}
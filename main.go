@@ -2,73 +2,228 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/creack/pty"
 	"github.com/gorilla/websocket"
+	"github.com/imneov/claudewarp/protocol"
 	"golang.org/x/term"
 )
 
 // Message 表示Claude交互消息
-type Message struct {
-	Type      string    `json:"type"`      // "output", "input", "error"
-	Content   string    `json:"content"`   // 消息内容
-	Timestamp time.Time `json:"timestamp"` // 时间戳
-}
+type Message = protocol.Message
 
 // ClaudeWarp 主要结构体
 type ClaudeWarp struct {
-	claudeCmd     *exec.Cmd                // Claude子进程
-	ptmx          *os.File                 // PTY主端
-	messages      []Message                // 消息历史
-	clients       map[*websocket.Conn]bool // WebSocket客户端
-	clientsMux    sync.RWMutex             // 客户端锁
-	messagesMux   sync.RWMutex             // 消息锁
-	inputChan     chan WebInput            // Web输入通道
-	outputReader  *io.PipeReader           // 输出管道读端
-	outputWriter  *io.PipeWriter           // 输出管道写端
-	inputReader   *io.PipeReader           // 输入管道读端
-	inputWriter   *io.PipeWriter           // 输入管道写端
-	resizeChan    chan os.Signal           // 窗口大小变化通道
-	termState     *term.State              // 终端状态
-	startupBuffer bytes.Buffer             // 启动日志缓冲区
+	proc           *claudeChild                    // 当前Claude子进程及PTY（childMux保护，经currentChild读取）
+	messages       []Message                       // 消息历史
+	clients        map[*websocket.Conn]*clientInfo // WebSocket客户端
+	clientsMux     sync.RWMutex                    // 客户端锁
+	messagesMux    sync.RWMutex                    // 消息锁
+	inputChan      chan WebInput                   // Web输入通道
+	outputReader   *io.PipeReader                  // 输出管道读端
+	outputWriter   *io.PipeWriter                  // 输出管道写端
+	inputReader    *io.PipeReader                  // 输入管道读端
+	inputWriter    *io.PipeWriter                  // 输入管道写端
+	resizeChan     chan os.Signal                  // 窗口大小变化通道
+	termState      *term.State                     // 终端状态
+	startupBuffer  bytes.Buffer                    // 启动日志缓冲区
+	screen         *screenBuffer                   // 屏幕文本缓冲区
+	output         *outputLog                      // 已发送终端输出，供断线续传
+	tracker        *stateTracker                   // 会话状态跟踪
+	notifier       *notifier                       // 状态变化通知
+	metrics        *metrics                        // 运行指标
+	child          childInfo                       // 子进程信息
+	childMux       sync.RWMutex                    // 子进程信息锁
+	redactor       *redactor                       // 离开进程内容的脱敏器
+	outputRedact   *streamRedactor                 // PTY输出流脱敏器
+	cfg            *Config                         // 当前配置
+	cfgMux         sync.RWMutex                    // 配置锁
+	configPath     string                          // 配置文件路径
+	audit          *auditLog                       // 输入审计日志
+	unixSocket     string                          // 监听中的Unix socket路径
+	policy         *inputPolicy                    // 远程输入策略
+	responders     *responders                     // 自动应答规则
+	queue          *promptQueue                    // 任务队列
+	scheduler      *scheduler                      // 定时任务
+	headless       bool                            // 无控制台运行
+	cleanupOnce    sync.Once                       // 保证只清理一次
+	sessionFile    string                          // 会话登记文件
+	profile        Profile                         // 会话配置（不含 --resume）
+	claudeSessions *claudeSessions                 // Claude会话ID记录
+	usage          *usageTracker                   // token用量统计
+	restartChan    chan restartRequest             // 恢复会话时重新启动Claude的请求
+	restarting     atomic.Bool                     // 正在恢复会话，子进程退出后不关闭
+	resumeMux      sync.Mutex                      // 同时只处理一个恢复请求
+	modeMux        sync.Mutex                      // 同时只处理一个切换模式请求
+	workspace      WorkspaceChanges                // 最近一次扫描的工作目录变化
+	workspaceMux   sync.RWMutex                    // 工作目录变化锁
+	checkpoints    *checkpoints                    // 工作目录检查点
+	worktree       *sessionWorktree                // 会话专用的git worktree
+	worktreeDone   chan struct{}                   // 会话结束后worktree已处理
 }
 
 // WebInput defines the structure for input coming from the web UI.
 type WebInput struct {
 	Content    string `json:"input"`
 	AddNewline bool   `json:"add_newline"`
+	Source     string `json:"-"` // 输入来源：web / api
+	Transport  string `json:"-"` // 传输方式：http / https
+	User       string `json:"-"` // 认证用户
+	Role       string `json:"-"` // 发送者角色
+	RemoteAddr string `json:"-"` // 客户端地址
+	ID         string `json:"-"` // 输入ID，用于回报策略决策
+
+	reply chan InputDecision // 同步等待决策的请求，可为nil
 }
 
+// stringList 可重复指定的字符串参数
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// upgrader 只接受同源或不带Origin（非浏览器客户端）的WebSocket连接，
+// Web界面经WebSocket发送输入，不能让其他网站借用户的浏览器连接
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许所有来源，生产环境需要限制
-	},
+	CheckOrigin: sameOrigin,
+}
+
+// sameOrigin 检查请求的Origin是否与Host一致
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
 }
 
 func main() {
-	var port = flag.Int("port", 8080, "Web监控端口")
-	var host = flag.String("host", "localhost", "Web监控主机地址")
-	flag.Parse()
+	if code, ok := runSubcommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
+	cfg, configPath, err := loadConfig(os.Args[0], os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		log.Fatalf("加载配置失败: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("配置无效:\n%v", err)
+	}
+	profile, _ := cfg.SessionProfile()
+
+	redactor, err := newRedactor(cfg.Redact.Patterns)
+	if err != nil {
+		log.Fatalf("脱敏规则错误: %v", err)
+	}
+
+	tlsConfig, err := buildTLSConfig(tlsOptions{
+		CertFile:     cfg.TLS.Cert,
+		KeyFile:      cfg.TLS.Key,
+		SelfSigned:   cfg.TLS.SelfSigned,
+		ClientCAFile: cfg.TLS.ClientCA,
+		StateDir:     cfg.StateDir,
+		Host:         cfg.Host,
+	})
+	if err != nil {
+		log.Fatalf("TLS配置错误: %v", err)
+	}
 
 	warp := &ClaudeWarp{
-		messages:   make([]Message, 0),
-		clients:    make(map[*websocket.Conn]bool),
-		inputChan:  make(chan WebInput, 100),
-		resizeChan: make(chan os.Signal, 1),
+		messages:     make([]Message, 0),
+		clients:      make(map[*websocket.Conn]*clientInfo),
+		inputChan:    make(chan WebInput, 100),
+		resizeChan:   make(chan os.Signal, 1),
+		screen:       newScreenBuffer(64 * 1024),
+		output:       newOutputLog(outputLogSize),
+		notifier:     newNotifier(cfg.Notify, os.Stdout),
+		metrics:      newMetrics(),
+		redactor:     redactor,
+		cfg:          cfg,
+		configPath:   configPath,
+		headless:     cfg.Headless,
+		profile:      profile,
+		restartChan:  make(chan restartRequest),
+		worktreeDone: make(chan struct{}, 1),
+	}
+	warp.outputRedact = newStreamRedactor(redactor, warp.sendTerminalData)
+	if warp.policy, err = newInputPolicy(cfg.Policy); err != nil {
+		log.Fatalf("输入策略错误: %v", err)
+	}
+	if warp.responders, err = newResponders(cfg.Responders); err != nil {
+		log.Fatalf("自动应答规则错误: %v", err)
+	}
+	if warp.queue, err = openPromptQueue(filepath.Join(cfg.StateDir, "queue", cfg.SessionName()+".json")); err != nil {
+		log.Fatalf("%v", err)
+	}
+	warp.scheduler = newScheduler(cfg, configPath, warp)
+	if warp.claudeSessions, err = openClaudeSessions(filepath.Join(cfg.StateDir, "claude", cfg.SessionName()+".json")); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if warp.usage, err = openUsageTracker(filepath.Join(cfg.StateDir, "usage"), cfg.SessionName(), cfg.Profile, cfg.Usage); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if warp.checkpoints, err = openCheckpoints(filepath.Join(cfg.StateDir, "checkpoints", cfg.SessionName()+".json"), cfg.SessionName()); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if warp.worktree, err = openSessionWorktree(filepath.Join(cfg.StateDir, "worktree", cfg.SessionName()+".json")); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if cfg.Worktree || profile.Worktree {
+		cwd := profile.Cwd
+		if cwd == "" {
+			cwd, _ = os.Getwd()
+		}
+		wt, err := warp.worktree.prepare(cwd, cfg.SessionName(), cfg.StateDir)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		profile.Cwd = wt.Cwd
+		warp.profile = profile
+		warp.addMessage("output", fmt.Sprintf("🌿 Claude在worktree %s 的分支 %s 上工作", wt.Path, wt.Branch))
+	}
+	if cfg.Resume {
+		rec := warp.claudeSessions.get()
+		if rec == nil {
+			log.Fatalf("会话 %q 没有记录的Claude会话ID，无法恢复", cfg.SessionName())
+		}
+		profile = resumeProfile(profile, *rec)
 	}
+	if cfg.Audit.Enabled {
+		if warp.audit, err = openAuditLog(cfg.AuditLogPath()); err != nil {
+			log.Fatalf("审计日志错误: %v", err)
+		}
+	}
+	warp.tracker = newStateTracker(warp.screen, cfg.Notify.IdleAfter.Duration, cfg.RateLimit.Fallback.Duration)
+	warp.tracker.onChange = warp.onStateChange
+	warp.tracker.onMode = warp.onModeChange
 
 	// 创建一个同时写入os.Stdout和启动缓冲区的writer
 	initialWriter := io.MultiWriter(os.Stdout, &warp.startupBuffer)
@@ -101,18 +256,47 @@ func main() {
 	warp.outputReader, warp.outputWriter = io.Pipe()
 	warp.inputReader, warp.inputWriter = io.Pipe()
 
+	// 登记会话，供 claudewarp send/wait/ls 等子命令定位
+	if warp.sessionFile, err = warp.registerSession(cfg, profile, tlsConfig != nil); err != nil {
+		log.Fatalf("%v", err)
+	}
+
 	// 启动Claude子进程
-	claudeCmd := "claude"
-	if err := warp.startClaude(claudeCmd); err != nil {
+	if err := warp.startClaude(profile); err != nil {
 		log.Fatalf("启动Claude失败: %v", err)
 	}
 
+	// 启动状态检测与自动应答
+	go warp.tracker.run()
+	go warp.runResponders()
+	go warp.scheduler.run()
+	go warp.watchClaudeSession()
+	go warp.importTranscripts()
+	if cfg.Workspace.Enabled {
+		go warp.watchWorkspace()
+	}
+
 	// 启动Web服务器
-	go warp.startWebServer(*host, *port)
+	go warp.startWebServer(cfg, tlsConfig)
 
 	// 在主控制台和Web端显示监控地址
-	addr := fmt.Sprintf("%s:%d", *host, *port)
-	fmt.Fprintf(initialWriter, "📱 Web监控界面: http://%s\n\n", addr)
+	if cfg.Unix.Path != "" {
+		fmt.Fprintf(initialWriter, "🔌 Unix socket: %s\n", cfg.Unix.Path)
+	}
+	if !cfg.Unix.Only {
+		addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+		scheme := "http"
+		if tlsConfig != nil {
+			scheme = "https"
+		} else if !isLoopbackHost(cfg.Host) {
+			fmt.Fprintf(initialWriter, "⚠️  监听非本地地址但未启用TLS，会话内容将以明文传输\n")
+		}
+		fmt.Fprintf(initialWriter, "📱 Web监控界面: %s://%s\n", scheme, addr)
+		if cfg.Auth.DefaultRole == "" && cfg.defaultRole() == RoleViewer {
+			fmt.Fprintf(initialWriter, "🔒 未列出的用户默认只能查看，可在 auth.users 中授予 controller 或设置 auth.default_role\n")
+		}
+	}
+	fmt.Fprintln(initialWriter)
 
 	// 设置信号处理
 	sigChan := make(chan os.Signal, 1)
@@ -126,14 +310,39 @@ func main() {
 		os.Exit(0)
 	}()
 
-	// 启动输入输出劫持（会阻塞直到PTY关闭）
+	// SIGHUP 热加载可安全变更的配置
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			warp.reloadConfig()
+		}
+	}()
+
+	// 启动输入输出劫持（会阻塞直到Claude进程结束且不再恢复）
 	warp.hijackIO()
 
-	// 如果hijackIO返回，说明Claude进程结束了
 	fmt.Println("Claude进程已结束")
 	warp.cleanup()
 }
 
+// defaultStateDir 默认状态目录
+func defaultStateDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".claudewarp")
+	}
+	return ".claudewarp"
+}
+
+// isLoopbackHost 判断监听地址是否仅限本机
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 // printLogo 打印启动LOGO
 func printLogo(w io.Writer) {
 	logo := `
@@ -159,33 +368,66 @@ func printLogo(w io.Writer) {
 	fmt.Fprint(w, logo)
 }
 
-// startClaude 启动Claude子进程并设置PTY劫持
-func (w *ClaudeWarp) startClaude(cmdStr string) error {
-	// 创建Claude命令
-	w.claudeCmd = exec.Command("sh", "-c", cmdStr)
+// 无控制台运行时的终端大小
+const (
+	headlessRows = 40
+	headlessCols = 120
+)
 
-	// 继承当前进程的所有环境变量（包括代理设置）
-	w.claudeCmd.Env = os.Environ()
+// startClaude 按会话配置启动Claude子进程并设置PTY劫持
+func (w *ClaudeWarp) startClaude(profile Profile) error {
+	// 创建Claude命令，恢复会话时会话ID经环境变量传入
+	script, wrap := profile.Command, false
+	if profile.ResumeID != "" {
+		script, wrap = resumeScript(script)
+	}
+	cmd := exec.Command("sh", "-c", script)
+
+	// 继承当前进程的所有环境变量（包括代理设置），再叠加会话配置中的变量
+	cmd.Env = os.Environ()
+	for k, v := range profile.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	if profile.ResumeID != "" {
+		cmd.Env = append(cmd.Env, claudeResumeEnv+"="+profile.ResumeID)
+	}
+	if wrap {
+		dir, err := writeResumeWrapper(w.config().StateDir)
+		if err != nil {
+			return fmt.Errorf("创建恢复会话的claude包装脚本失败: %v", err)
+		}
+		cmd.Env = prependPath(cmd.Env, dir)
+	}
+	cmd.Dir = profile.Cwd
+	if cmd.Dir == "" {
+		if cwd, err := os.Getwd(); err == nil {
+			cmd.Dir = cwd
+		}
+	}
 
 	// 调试：显示传递给Claude的关键环境变量
-	for _, env := range w.claudeCmd.Env {
+	for _, env := range cmd.Env {
 		if strings.Contains(strings.ToLower(env), "proxy") {
 			w.addMessage("output", fmt.Sprintf("🔧 传递环境变量: %s", env))
 		}
 	}
 
 	// 启动带PTY的命令
-	var err error
-	w.ptmx, err = pty.Start(w.claudeCmd)
+	ptmx, err := pty.Start(cmd)
 	if err != nil {
 		return fmt.Errorf("启动PTY失败: %v", err)
 	}
+	w.recordChildStart(&claudeChild{cmd: cmd, ptmx: ptmx, done: make(chan struct{})})
 
-	// 设置PTY窗口大小以匹配当前终端
-	w.setupPTYSize()
-
-	// 监听窗口大小变化
-	w.handleWindowResize()
+	if w.headless {
+		// 没有控制台可继承，使用固定大小
+		if err := pty.Setsize(ptmx, &pty.Winsize{Rows: headlessRows, Cols: headlessCols}); err != nil {
+			w.addMessage("error", fmt.Sprintf("设置终端大小失败: %v", err))
+		}
+	} else {
+		// 设置PTY窗口大小以匹配当前终端
+		w.setupPTYSize()
+	}
 
 	w.addMessage("output", "🚀 Claude会话已启动")
 	w.addMessage("output", "💡 劫持模式：控制台正常显示，此处监控交互")
@@ -195,8 +437,12 @@ func (w *ClaudeWarp) startClaude(cmdStr string) error {
 
 // setupPTYSize 设置PTY窗口大小
 func (w *ClaudeWarp) setupPTYSize() {
+	child := w.currentChild()
+	if child == nil {
+		return
+	}
 	// 继承当前终端的窗口大小
-	if err := pty.InheritSize(os.Stdin, w.ptmx); err != nil {
+	if err := pty.InheritSize(os.Stdin, child.ptmx); err != nil {
 		// 如果无法继承，设置一个默认大小
 		w.addMessage("error", fmt.Sprintf("无法继承终端大小: %v", err))
 	}
@@ -209,9 +455,7 @@ func (w *ClaudeWarp) handleWindowResize() {
 
 	go func() {
 		for range w.resizeChan {
-			if err := pty.InheritSize(os.Stdin, w.ptmx); err != nil {
-				w.addMessage("error", fmt.Sprintf("调整窗口大小失败: %v", err))
-			}
+			w.setupPTYSize()
 		}
 	}()
 
@@ -221,6 +465,14 @@ func (w *ClaudeWarp) handleWindowResize() {
 
 // hijackIO 劫持Claude的输入输出
 func (w *ClaudeWarp) hijackIO() {
+	if w.headless {
+		w.serveHeadless()
+		return
+	}
+
+	// 监听窗口大小变化
+	w.handleWindowResize()
+
 	// 设置终端原始模式 - 这是关键！
 	var err error
 	w.termState, err = term.MakeRaw(int(os.Stdin.Fd()))
@@ -232,6 +484,7 @@ func (w *ClaudeWarp) hijackIO() {
 	// 输入代理：stdin -> PTY (完全透明) - 必须先启动
 	go func() {
 		buffer := make([]byte, 1)
+		var line consoleLine
 		for {
 			n, err := os.Stdin.Read(buffer)
 			if err != nil {
@@ -245,23 +498,27 @@ func (w *ClaudeWarp) hijackIO() {
 				os.Exit(0)
 			}
 
+			// 回车提交提示时保存工作目录检查点：在转发前读取输入框中的提示并判断状态，
+			// 快照在后台保存，不阻塞按键
+			var prompt string
+			if typed, enter := line.feed(buffer[0]); enter && w.wantCheckpoint() {
+				prompt = consolePrompt(w.screen.Tail(screenTailSize), typed)
+			}
+
 			// 正常转发给PTY
-			w.ptmx.Write(buffer[:n])
+			w.writePTY(buffer[:n])
+			w.tracker.noteInput()
+			w.audit.RecordConsole(buffer[:n])
+			if prompt != "" {
+				go w.saveCheckpoint(prompt, SourceConsole, "")
+			}
 		}
 	}()
 
 	// Web输入处理（独立通道）
 	go func() {
 		for webInput := range w.inputChan {
-			content := webInput.Content
-			if webInput.AddNewline {
-				content += "\n"
-			}
-			if _, err := w.ptmx.Write([]byte(content)); err != nil {
-				w.addMessage("error", fmt.Sprintf("发送Web输入失败: %v", err))
-				continue
-			}
-			w.addMessage("input", webInput.Content+" (Web界面)")
+			w.processInput(webInput)
 		}
 	}()
 
@@ -269,8 +526,136 @@ func (w *ClaudeWarp) hijackIO() {
 	webWriter := &webWriter{warp: w}
 	multiWriter := io.MultiWriter(os.Stdout, webWriter)
 
-	// 这个调用会阻塞，直到PTY关闭
-	io.Copy(multiWriter, w.ptmx)
+	// 这个调用会阻塞，直到Claude进程结束且不再恢复
+	w.pumpOutput(multiWriter)
+}
+
+// serveHeadless 无控制台运行：只处理远程输入，输出仅发送给Web客户端
+func (w *ClaudeWarp) serveHeadless() {
+	go func() {
+		for webInput := range w.inputChan {
+			w.processInput(webInput)
+		}
+	}()
+
+	// 这个调用会阻塞，直到Claude进程结束且不再恢复
+	w.pumpOutput(&webWriter{warp: w})
+}
+
+// pumpOutput 转发PTY输出；子进程退出后若启用keep_alive或正在恢复会话，等待重新启动后继续转发
+func (w *ClaudeWarp) pumpOutput(dst io.Writer) {
+	for {
+		if child := w.currentChild(); child != nil {
+			io.Copy(dst, child.ptmx)
+		}
+		w.waitChild()
+		w.tracker.set(StateExited)
+		if !w.awaitRestart() {
+			return
+		}
+	}
+}
+
+// awaitRestart 等待恢复请求并重新启动Claude，不需要保持运行时返回false
+func (w *ClaudeWarp) awaitRestart() bool {
+	if !w.restarting.Load() {
+		switch {
+		case w.worktree.active():
+			// 等待用户选择合并、保留或删除worktree
+			w.broadcastWorktree()
+			w.addMessage("output", "🌿 Claude进程已退出，请在Web界面或通过 POST /api/worktree 选择合并、保留或删除worktree")
+			if !w.headless {
+				fmt.Print("\r\n🌿 Claude进程已退出，请在Web界面选择合并、保留或删除worktree（Ctrl+C 退出并保留）\r\n")
+			}
+		case !w.config().KeepAlive:
+			return false
+		default:
+			w.addMessage("output", "⏸️ Claude进程已退出，可在Web界面或通过 POST /api/resume 恢复会话")
+			if !w.headless {
+				fmt.Print("\r\n⏸️ Claude进程已退出，可在Web界面或通过 POST /api/resume 恢复会话（Ctrl+C 退出）\r\n")
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-w.worktreeDone:
+			return false
+		case req := <-w.restartChan:
+			w.restarting.Store(false)
+			old := w.currentChild()
+			err := w.startClaude(req.profile)
+			req.reply <- err
+			if err != nil {
+				continue
+			}
+			// 其他goroutine可能仍持有旧PTY，关闭后它们的写入返回错误而不会写到新进程
+			if old != nil {
+				old.ptmx.Close()
+			}
+			w.metrics.childRestarts.Add(1)
+			w.tracker.restart()
+			return true
+		}
+	}
+}
+
+// writeInput 将远程输入写入PTY并记录审计日志
+func (w *ClaudeWarp) writeInput(in WebInput, decision, rule, approvedBy string) error {
+	content := in.Content
+	if in.AddNewline {
+		content += "\n"
+	}
+	if prompt, ok := promptText(in); ok {
+		w.checkpointPrompt(prompt, in.Source, requestIdentity(in.User, in.RemoteAddr))
+	}
+	n, err := w.writePTY([]byte(content))
+	w.metrics.webInputBytes.Add(int64(n))
+	if err != nil {
+		w.addMessage("error", fmt.Sprintf("发送Web输入失败: %v", err))
+		return err
+	}
+	w.tracker.noteInput()
+
+	entry := AuditEntry{
+		Source:     in.Source,
+		Transport:  in.Transport,
+		User:       in.User,
+		RemoteAddr: in.RemoteAddr,
+		Data:       []byte(content),
+		Rule:       rule,
+		ApprovedBy: approvedBy,
+	}
+	if decision != DecisionAllowed {
+		entry.Decision = decision
+	}
+	if err := w.audit.Record(entry); err != nil {
+		w.addMessage("error", err.Error())
+	}
+	w.addMessage("input", fmt.Sprintf("%s (%s)", in.Content, inputOrigin(in)))
+	return nil
+}
+
+// inputOrigin 描述输入来源，用于消息历史
+func inputOrigin(in WebInput) string {
+	origin := "Web界面"
+	switch in.Source {
+	case SourceAPI:
+		origin = "API"
+	case SourceResponder:
+		origin = "自动应答"
+	case SourceQueue:
+		origin = "任务队列"
+	case SourceRateLimit:
+		origin = "用量重置后自动继续"
+	}
+	if in.User != "" {
+		origin += " " + in.User
+	}
+	if in.RemoteAddr != "" {
+		origin += "@" + in.RemoteAddr
+	}
+	return origin
 }
 
 // webWriter 实现io.Writer接口，用于Web界面监控
@@ -281,292 +666,225 @@ type webWriter struct {
 func (w *webWriter) Write(p []byte) (n int, err error) {
 	// 发送原始终端数据到Web界面（包含ANSI转义序列）
 	if len(p) > 0 {
-		content := string(p)
-		w.warp.sendTerminalData(content)
+		w.warp.metrics.ptyBytesRead.Add(int64(len(p)))
+		w.warp.screen.Write(p)
+		w.warp.tracker.noteOutput()
+
+		// 脱敏后经sendTerminalData发送，未完成的行可能稍后发送
+		w.warp.outputRedact.Write(p)
+
+		// 终端响铃透传给Web界面
+		if bytes.IndexByte(p, 0x07) >= 0 {
+			w.warp.broadcastEvent(protocol.Event{Type: protocol.EventBell})
+		}
 	}
 	return len(p), nil
 }
 
-// sendTerminalData 发送原始终端数据到Web界面
+// onStateChange 处理会话状态变化：广播给Web客户端并发送通知
+func (w *ClaudeWarp) onStateChange(from, to SessionState, since time.Time) {
+	w.metrics.observeState(to, since)
+	w.broadcastEvent(StateEvent{
+		Type:     protocol.EventState,
+		State:    to,
+		Previous: from,
+		Since:    since,
+		ResetAt:  w.rateLimitView(to),
+		Mode:     w.tracker.Mode(),
+	})
+
+	// 停在输入框或等待确认时推送提示事件，附带屏幕尾部文本
+	kind := ""
+	switch to {
+	case StateIdle:
+		kind = protocol.PromptInput
+	case StateAwaitingApproval:
+		kind = protocol.PromptApproval
+	}
+	if kind != "" {
+		w.broadcastEvent(protocol.PromptEvent{
+			Type: protocol.EventPrompt,
+			Kind: kind,
+			Text: w.redactor.Redact(w.screen.Tail(screenTailSize)),
+			At:   since,
+		})
+	}
+	w.notifier.notifyState(from, to, since)
+	w.onRateLimit(from, to, since)
+	w.advanceQueue(to)
+}
+
+// sendTerminalData 发送原始终端数据到Web界面，调用方负责脱敏
 func (w *ClaudeWarp) sendTerminalData(content string) {
-	w.clientsMux.RLock()
-	defer w.clientsMux.RUnlock()
+	w.clientsMux.Lock()
+	defer w.clientsMux.Unlock()
+
+	// 在持有客户端锁时写入输出日志，保证续传的客户端不丢失也不重复数据
+	offset := w.output.Append(content)
+	w.queue.captureOutput(content)
 
 	// 发送原始终端数据（包含ANSI转义序列）
-	data, _ := json.Marshal(map[string]interface{}{
-		"type":    "terminal_data",
-		"content": content,
+	data, _ := json.Marshal(protocol.TerminalData{
+		Type:    protocol.EventTerminalData,
+		Content: content,
+		Offset:  offset,
 	})
 
-	for client := range w.clients {
-		if err := client.WriteMessage(websocket.TextMessage, data); err != nil {
-			client.Close()
-			delete(w.clients, client)
-		}
-	}
+	w.writeClientsLocked(data)
 }
 
 // addMessage 添加消息并广播给所有客户端
 func (w *ClaudeWarp) addMessage(msgType, content string) {
+	content = w.redactor.Redact(content)
 	msg := Message{
 		Type:      msgType,
 		Content:   content,
 		Timestamp: time.Now(),
 	}
 
-	w.messagesMux.Lock()
-	w.messages = append(w.messages, msg)
-	w.messagesMux.Unlock()
+	w.recordMessage(msg)
 
 	// 格式化消息并发送到Web终端
 	formattedContent := fmt.Sprintf("📢 %s\r\n", content)
 	w.sendTerminalData(formattedContent)
+	w.broadcastEvent(protocol.MessageEvent{Type: protocol.EventMessage, Message: msg})
+}
+
+// appendMessage 把对话记录中的消息脱敏后加入历史并推送，不回显到Web终端
+func (w *ClaudeWarp) appendMessage(msg Message) {
+	msg.Content = w.redactor.Redact(msg.Content)
+	if msg.ToolInput != nil {
+		input := json.RawMessage(w.redactor.Redact(string(msg.ToolInput)))
+		if !json.Valid(input) {
+			input = nil
+		}
+		msg.ToolInput = input
+	}
+
+	w.recordMessage(msg)
+
+	w.broadcastEvent(protocol.MessageEvent{Type: protocol.EventMessage, Message: msg})
+}
+
+// messageHistoryLimit 内存中保留的消息数，/api/messages 和新连接的客户端只能看到最近这些消息
+const messageHistoryLimit = 2000
+
+// recordMessage 把消息加入历史，超出保留数时丢弃最早的消息
+func (w *ClaudeWarp) recordMessage(msg Message) {
+	w.messagesMux.Lock()
+	defer w.messagesMux.Unlock()
+	w.messages = append(w.messages, msg)
+	if over := len(w.messages) - messageHistoryLimit; over > 0 {
+		n := copy(w.messages, w.messages[over:])
+		w.messages = w.messages[:n]
+	}
 }
 
 // broadcastMessage 广播消息给所有客户端
 func (w *ClaudeWarp) broadcastMessage(msg Message) {
-	w.clientsMux.RLock()
-	defer w.clientsMux.RUnlock()
+	w.clientsMux.Lock()
+	defer w.clientsMux.Unlock()
 
 	data, _ := json.Marshal(msg)
+	w.writeClientsLocked(data)
+}
+
+// broadcastEvent 广播任意JSON事件给所有客户端
+func (w *ClaudeWarp) broadcastEvent(event interface{}) {
+	w.clientsMux.Lock()
+	defer w.clientsMux.Unlock()
+
+	data, _ := json.Marshal(event)
+	w.writeClientsLocked(data)
+}
+
+// writeClientsLocked 向所有客户端写入一帧，发送失败的客户端被移除。
+// 调用方需持有clientsMux写锁：同一连接不允许并发写入。
+func (w *ClaudeWarp) writeClientsLocked(data []byte) {
 	for client := range w.clients {
 		if err := client.WriteMessage(websocket.TextMessage, data); err != nil {
+			w.metrics.wsSendErrors.Add(1)
 			client.Close()
 			delete(w.clients, client)
 		}
 	}
 }
 
-// startWebServer 启动Web服务器
-func (w *ClaudeWarp) startWebServer(host string, port int) {
+// startWebServer 启动Web服务器，可同时监听TCP（tlsConfig非nil时使用HTTPS）和Unix socket
+func (w *ClaudeWarp) startWebServer(cfg *Config, tlsConfig *tls.Config) {
 	http.HandleFunc("/", w.handleIndex)
+	http.HandleFunc("/static/", w.handleStatic)
 	http.HandleFunc("/ws", w.handleWebSocket)
 	http.HandleFunc("/api/messages", w.handleMessages)
 	http.HandleFunc("/api/input", w.handleInputAPI)
+	http.HandleFunc("/api/input/pending", w.handlePendingInputs)
+	http.HandleFunc("/api/input/pending/", w.handlePendingInputs)
+	http.HandleFunc("/api/responders", w.handleResponders)
+	http.HandleFunc("/api/responders/", w.handleResponders)
+	http.HandleFunc("/api/queue", w.handleQueue)
+	http.HandleFunc("/api/queue/", w.handleQueue)
+	http.HandleFunc("/api/schedules", w.handleSchedules)
+	http.HandleFunc("/api/schedules/", w.handleSchedules)
+	http.HandleFunc("/api/mode", w.handleMode)
+	http.HandleFunc("/api/commands", w.handleCommands)
+	http.HandleFunc("/api/workspace/changes", w.handleWorkspaceChanges)
+	http.HandleFunc("/api/checkpoints", w.handleCheckpoints)
+	http.HandleFunc("/api/checkpoints/", w.handleCheckpoints)
+	http.HandleFunc("/api/worktree", w.handleWorktree)
+	http.HandleFunc("/api/files", w.handleFiles)
+	http.HandleFunc("/api/usage", w.handleUsage)
+	http.HandleFunc("/api/resume", w.handleResume)
+	http.HandleFunc("/api/claude/hook", w.handleClaudeHook)
+	http.HandleFunc("/api/state", w.handleState)
+	http.HandleFunc("/api/screen", w.handleScreen)
+	http.HandleFunc("/metrics", w.handleMetrics)
+	http.HandleFunc("/api/status", w.handleStatus)
+	http.HandleFunc("/healthz", w.handleHealthz)
+	http.HandleFunc("/readyz", w.handleReadyz)
+
+	if missing := missingVendorFiles(); len(missing) > 0 {
+		if cfg.Web.CDN {
+			log.Printf("前端依赖未内置，将从CDN加载: %s", strings.Join(missing, ", "))
+		} else {
+			log.Printf("⚠️ 前端依赖未内置且已关闭CDN回退，Web界面无法加载: %s（运行 go generate ./... 后重新构建，或去掉 -web-cdn=false）", strings.Join(missing, ", "))
+		}
+	}
 
-	addr := fmt.Sprintf("%s:%d", host, port)
+	if cfg.Unix.Path != "" {
+		ln, err := listenUnix(cfg.Unix)
+		if err != nil {
+			log.Fatalf("无法监听Unix socket: %v", err)
+		}
+		w.unixSocket = cfg.Unix.Path
+		log.Printf("🔌 Web服务器监听Unix socket %s", cfg.Unix.Path)
+		unixServer := &http.Server{ConnContext: unixConnContext}
+		if cfg.Unix.Only {
+			if err := unixServer.Serve(ln); err != nil {
+				log.Fatalf("Unix socket服务异常退出: %v", err)
+			}
+			return
+		}
+		go func() {
+			if err := unixServer.Serve(ln); err != nil {
+				log.Printf("Unix socket服务异常退出: %v", err)
+			}
+		}()
+	}
+
+	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
 	log.Printf("🚀 Web服务器启动于 %s", addr)
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	server := &http.Server{Addr: addr, TLSConfig: tlsConfig}
+	var err error
+	if tlsConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
 		log.Fatalf("无法启动Web服务器: %v", err)
 	}
 }
 
-// handleIndex 处理主页
-func (w *ClaudeWarp) handleIndex(wr http.ResponseWriter, r *http.Request) {
-	html := `<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>ClaudeWarp - Terminal Hijacker</title>
-    <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/xterm@5.3.0/css/xterm.min.css" />
-    <style>
-        body {
-            font-family: 'Menlo', 'Courier New', monospace;
-            margin: 0;
-            padding: 20px;
-            background-color: #1e1e1e;
-            color: #d4d4d4;
-        }
-        .container {
-            max-width: 1400px;
-            margin: 0 auto;
-        }
-        .header {
-            text-align: center;
-            margin-bottom: 20px;
-        }
-        .info-box {
-            background-color: #2d2d30;
-            border: 1px solid #3e3e42;
-            border-radius: 5px;
-            padding: 15px;
-            margin-bottom: 20px;
-            border-left: 4px solid #0e639c;
-        }
-        #terminal-container {
-            width: 100%;
-            height: 65vh;
-            padding: 10px;
-            box-sizing: border-box;
-            background-color: #0c0c0c;
-            border: 1px solid #333;
-            border-radius: 5px;
-        }
-        #terminal {
-            width: 100%;
-            height: 100%;
-        }
-        .input-section {
-            display: flex;
-            align-items: center;
-            gap: 10px;
-            margin-top: 20px;
-        }
-        .input-box {
-            flex: 1;
-            padding: 10px;
-            background-color: #3c3c3c;
-            border: 1px solid #555;
-            border-radius: 3px;
-            color: #d4d4d4;
-            font-family: inherit;
-        }
-        .send-btn {
-            padding: 10px 20px;
-            background-color: #0e639c;
-            color: white;
-            border: none;
-            border-radius: 3px;
-            cursor: pointer;
-        }
-        .send-btn:hover {
-            background-color: #1177bb;
-        }
-        .input-options {
-            display: flex;
-            align-items: center;
-            gap: 5px;
-            color: #aaa;
-        }
-        .status {
-            text-align: center;
-            margin-bottom: 10px;
-            font-weight: bold;
-        }
-        .connected {
-            color: #16825d;
-        }
-        .disconnected {
-            color: #f14949;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>🔍 ClaudeWarp Terminal Hijacker</h1>
-            <div id="status" class="status disconnected">● 连接中...</div>
-        </div>
-        
-        <div class="info-box">
-            <strong>💡 终端劫持模式:</strong> 完全同步真实终端输出，支持所有ANSI转义序列和颜色
-        </div>
-        
-        <div id="terminal-container">
-            <div id="terminal"></div>
-        </div>
-        
-        <div class="input-section">
-            <input type="text" id="inputBox" class="input-box" placeholder="远程输入到Claude..." />
-            <button id="sendBtn" class="send-btn">发送</button>
-            <div class="input-options">
-                <input type="checkbox" id="newlineCheckbox" checked>
-                <label for="newlineCheckbox">追加回车</label>
-            </div>
-        </div>
-    </div>
-
-    <script src="https://cdn.jsdelivr.net/npm/xterm@5.3.0/lib/xterm.min.js"></script>
-    <script src="https://cdn.jsdelivr.net/npm/xterm-addon-fit@0.8.0/lib/xterm-addon-fit.min.js"></script>
-    <script>
-        const terminalContainer = document.getElementById('terminal-container');
-        const terminalDiv = document.getElementById('terminal');
-        const inputBox = document.getElementById('inputBox');
-        const sendBtn = document.getElementById('sendBtn');
-        const newlineCheckbox = document.getElementById('newlineCheckbox');
-        const statusDiv = document.getElementById('status');
-        
-        const term = new Terminal({
-            cursorBlink: true,
-            fontSize: 14,
-            fontFamily: 'Menlo, "DejaVu Sans Mono", Consolas, "Lucida Console", monospace',
-            theme: {
-                background: '#0c0c0c',
-                foreground: '#d4d4d4',
-                cursor: '#d4d4d4',
-            },
-            rows: 30, // Default, will be adjusted by fit addon
-            convertEol: true, // Automatically convert \n to \r\n
-        });
-        
-        const fitAddon = new FitAddon.FitAddon();
-        term.loadAddon(fitAddon);
-        term.open(terminalDiv);
-        
-        function fitTerminal() {
-            try {
-                fitAddon.fit();
-            } catch (e) {
-                console.error("Fit addon error:", e);
-            }
-        }
-        
-        window.addEventListener('load', fitTerminal);
-        window.addEventListener('resize', fitTerminal);
-        
-        let ws;
-        
-        function connect() {
-            ws = new WebSocket('ws://' + window.location.host + '/ws');
-            
-            ws.onopen = function() {
-                statusDiv.textContent = '● 终端劫持已连接';
-                statusDiv.className = 'status connected';
-                fitTerminal();
-            };
-            
-            ws.onmessage = function(event) {
-                const data = JSON.parse(event.data);
-                if (data.type === 'terminal_data' && typeof data.content === 'string') {
-                    term.write(data.content);
-                }
-            };
-            
-            ws.onclose = function() {
-                statusDiv.textContent = '● 终端劫持连接断开';
-                statusDiv.className = 'status disconnected';
-                setTimeout(connect, 3000);
-            };
-            
-            ws.onerror = function(error) {
-                console.error('WebSocket Error: ', error);
-                statusDiv.textContent = '● 终端劫持连接错误';
-                statusDiv.className = 'status disconnected';
-            };
-        }
-        
-        function sendInput() {
-            const input = inputBox.value; // Don't trim, to allow sending just spaces if needed
-            if (!input) return;
-
-            if (ws && ws.readyState === WebSocket.OPEN) {
-                fetch('/api/input', {
-                    method: 'POST',
-                    headers: {'Content-Type': 'application/json'},
-                    body: JSON.stringify({
-                        input: input,
-                        add_newline: newlineCheckbox.checked
-                    })
-                });
-                inputBox.value = '';
-            }
-        }
-        
-        sendBtn.addEventListener('click', sendInput);
-        inputBox.addEventListener('keypress', function(e) {
-            if (e.key === 'Enter') {
-                sendInput();
-            }
-        });
-        
-        connect();
-    </script>
-</body>
-</html>`
-	wr.Header().Set("Content-Type", "text/html; charset=utf-8")
-	wr.Write([]byte(html))
-}
-
 // handleWebSocket 处理WebSocket连接
 func (w *ClaudeWarp) handleWebSocket(wr http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(wr, r, nil)
@@ -576,34 +894,169 @@ func (w *ClaudeWarp) handleWebSocket(wr http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
+	// 带offset参数的客户端为断线重连，从输出日志续传
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || offset < 0 {
+			conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseUnsupportedData, "无效的offset"))
+			return
+		}
+		w.resumeWebSocket(conn, r, offset)
+		return
+	}
+
 	// 将启动日志发送给新连接的客户端
 	if w.startupBuffer.Len() > 0 {
-		content := w.startupBuffer.String()
+		content := w.redactor.Redact(w.startupBuffer.String())
 		// content = strings.ReplaceAll(content, "\n", "\r\n") // Xterm.js with convertEol:true handles this
-		data, _ := json.Marshal(map[string]interface{}{
-			"type":    "terminal_data",
-			"content": content,
+		data, _ := json.Marshal(protocol.TerminalData{
+			Type:    protocol.EventTerminalData,
+			Content: content,
+			Offset:  -1, // 启动日志不在输出流中
 		})
 		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			w.metrics.wsSendErrors.Add(1)
 			log.Printf("发送启动日志给新客户端失败: %v", err)
 		}
 	}
 
+	w.sendCurrentState(conn)
+
 	w.clientsMux.Lock()
-	w.clients[conn] = true
+	w.clients[conn] = w.newClientInfo(r)
 	w.clientsMux.Unlock()
 
+	w.serveWebSocket(conn, r)
+}
+
+// resumeWebSocket 从offset开始补发输出后注册客户端，补发期间持有写锁以免漏掉新输出
+func (w *ClaudeWarp) resumeWebSocket(conn *websocket.Conn, r *http.Request, offset int64) {
+	w.sendCurrentState(conn)
+
+	w.clientsMux.Lock()
+	if content, start := w.output.Since(offset); content != "" {
+		data, _ := json.Marshal(protocol.TerminalData{
+			Type:    protocol.EventTerminalData,
+			Content: content,
+			Offset:  start,
+		})
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			w.clientsMux.Unlock()
+			w.metrics.wsSendErrors.Add(1)
+			return
+		}
+	}
+	w.clients[conn] = w.newClientInfo(r)
+	w.clientsMux.Unlock()
+
+	w.serveWebSocket(conn, r)
+}
+
+// sendCurrentState 向新连接发送当前会话状态
+func (w *ClaudeWarp) sendCurrentState(conn *websocket.Conn) {
+	state, since := w.tracker.Current()
+	event := StateEvent{Type: protocol.EventState, State: state, Since: since, ResetAt: w.rateLimitView(state), Mode: w.tracker.Mode()}
+	if data, err := json.Marshal(event); err == nil {
+		conn.WriteMessage(websocket.TextMessage, data)
+	}
+	if rec := w.claudeSessions.get(); rec != nil {
+		data, _ := json.Marshal(protocol.ClaudeSessionEvent{Type: protocol.EventClaudeSession, Session: rec})
+		conn.WriteMessage(websocket.TextMessage, data)
+	}
+	if wt := w.worktree.get(); wt != nil {
+		data, _ := json.Marshal(protocol.WorktreeEvent{Type: protocol.EventWorktree, Worktree: wt})
+		conn.WriteMessage(websocket.TextMessage, data)
+	}
+	if list := w.checkpoints.list(); len(list) > 0 {
+		data, _ := json.Marshal(protocol.CheckpointsEvent{Type: protocol.EventCheckpoints, Checkpoints: list})
+		conn.WriteMessage(websocket.TextMessage, data)
+	}
+	if ws := w.currentWorkspace(); !ws.UpdatedAt.IsZero() {
+		data, _ := json.Marshal(protocol.WorkspaceEvent{Type: protocol.EventWorkspace, Workspace: ws})
+		conn.WriteMessage(websocket.TextMessage, data)
+	}
+}
+
+// newClientInfo 根据请求构造客户端信息
+func (w *ClaudeWarp) newClientInfo(r *http.Request) *clientInfo {
+	user := requestUser(r)
+	return &clientInfo{
+		RemoteAddr:  r.RemoteAddr,
+		User:        user,
+		Role:        w.config().RoleFor(user),
+		ConnectedAt: time.Now(),
+	}
+}
+
+// serveWebSocket 处理Web界面经WebSocket发送的请求，直到客户端断开，然后注销客户端
+func (w *ClaudeWarp) serveWebSocket(conn *websocket.Conn, r *http.Request) {
 	defer func() {
 		w.clientsMux.Lock()
 		delete(w.clients, conn)
 		w.clientsMux.Unlock()
 	}()
 
-	// 保持连接活跃
 	for {
-		if _, _, err := conn.NextReader(); err != nil {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
 			break
 		}
+		var req protocol.ClientRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			continue
+		}
+		switch req.Type {
+		case protocol.RequestInput:
+			go w.handleWebSocketInput(conn, r, req)
+		case protocol.RequestMode:
+			go w.handleWebSocketMode(conn, r, req)
+		}
+	}
+}
+
+// handleWebSocketInput 处理Web界面发送的输入，决策直接回复给该连接
+func (w *ClaudeWarp) handleWebSocketInput(conn *websocket.Conn, r *http.Request, req protocol.ClientRequest) {
+	in := w.remoteInput(r, SourceWeb)
+	in.Content, in.AddNewline = req.Input, req.AddNewline
+
+	var decision InputDecision
+	if reason := w.controlDenied(r); reason != "" {
+		decision = InputDecision{Decision: DecisionDenied, Reason: reason}
+	} else {
+		var ok bool
+		if decision, ok = w.submitInput(in); !ok {
+			decision = InputDecision{Decision: DecisionDenied, Reason: "输入队列已满"}
+		}
+	}
+	decision.Type = protocol.EventInputDecision
+	decision.Ref = req.Ref
+	w.sendToClient(conn, decision)
+}
+
+// handleWebSocketMode 处理Web界面的模式切换请求，结果直接回复给该连接
+func (w *ClaudeWarp) handleWebSocketMode(conn *websocket.Conn, r *http.Request, req protocol.ClientRequest) {
+	event := protocol.ModeResultEvent{Type: protocol.EventModeResult, Ref: req.Ref}
+	result, _, err := w.switchMode(w.remoteInput(r, SourceWeb), req.Mode, r)
+	if err != nil {
+		event.Error = err.Error()
+	}
+	event.ModeResult = result
+	w.sendToClient(conn, event)
+}
+
+// sendToClient 向单个已注册的客户端发送事件
+func (w *ClaudeWarp) sendToClient(conn *websocket.Conn, event interface{}) {
+	data, _ := json.Marshal(event)
+	w.clientsMux.Lock()
+	defer w.clientsMux.Unlock()
+	if _, ok := w.clients[conn]; !ok {
+		return
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		w.metrics.wsSendErrors.Add(1)
+		conn.Close()
+		delete(w.clients, conn)
 	}
 }
 
@@ -617,6 +1070,35 @@ func (w *ClaudeWarp) handleMessages(wr http.ResponseWriter, r *http.Request) {
 	wr.Write(data)
 }
 
+// handleState 处理会话状态API
+func (w *ClaudeWarp) handleState(wr http.ResponseWriter, r *http.Request) {
+	state, since := w.tracker.Current()
+	data, _ := json.Marshal(map[string]interface{}{
+		"state":       state,
+		"since":       since,
+		"last_output": w.tracker.LastOutput(),
+		"reset_at":    w.rateLimitView(state),
+		"mode":        w.tracker.Mode(),
+	})
+
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
+
+// handleScreen 返回当前屏幕文本快照
+func (w *ClaudeWarp) handleScreen(wr http.ResponseWriter, r *http.Request) {
+	state, _ := w.tracker.Current()
+	data, _ := json.Marshal(protocol.Screen{
+		Text:   w.redactor.Redact(w.screen.Tail(screenTailSize)),
+		State:  state,
+		Offset: w.output.End(),
+		At:     time.Now(),
+	})
+
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
+
 // handleInputAPI 处理输入API
 func (w *ClaudeWarp) handleInputAPI(wr http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
@@ -629,18 +1111,94 @@ func (w *ClaudeWarp) handleInputAPI(wr http.ResponseWriter, r *http.Request) {
 		http.Error(wr, "无效的JSON", http.StatusBadRequest)
 		return
 	}
+	if _, ok := w.requireController(wr, r); !ok {
+		return
+	}
+	in := w.remoteInput(r, SourceAPI)
+	in.Content, in.AddNewline = req.Content, req.AddNewline
 
-	// 发送到输入通道
+	decision, ok := w.submitInput(in)
+	if !ok {
+		http.Error(wr, "输入队列已满", http.StatusServiceUnavailable)
+		return
+	}
+	status := http.StatusOK
+	switch decision.Decision {
+	case DecisionDenied:
+		status = http.StatusForbidden
+	case DecisionHeld, DecisionQueued:
+		status = http.StatusAccepted
+	}
+	data, _ := json.Marshal(decision)
+	wr.Header().Set("Content-Type", "application/json")
+	wr.WriteHeader(status)
+	wr.Write(data)
+}
+
+// remoteInput 根据请求构造远程输入。来源由服务端按接入方式决定：
+// WebSocket为 web，REST接口为 api，客户端无法自行指定
+func (w *ClaudeWarp) remoteInput(r *http.Request, source string) WebInput {
+	in := WebInput{
+		Source:     source,
+		Transport:  requestTransport(r),
+		User:       requestUser(r),
+		RemoteAddr: r.RemoteAddr,
+	}
+	if cred := peerCredFrom(r); cred != nil {
+		in.RemoteAddr = fmt.Sprintf("unix:pid=%d", cred.PID)
+	}
+	in.Role = w.config().RoleFor(in.User)
+	return in
+}
+
+// controlDenied 返回请求方不能控制会话（发送输入、修改状态）的原因，允许时返回空字符串
+func (w *ClaudeWarp) controlDenied(r *http.Request) string {
+	cfg := w.config()
+	if cfg.RoleFor(requestUser(r)) != RoleController {
+		return "只有controller角色可以执行此操作"
+	}
+	if !cfg.Unix.peerAllowed(peerCredFrom(r)) {
+		return "该本地用户不允许控制会话"
+	}
+	return ""
+}
+
+// requireController 校验请求方可以控制会话，否则回复403；返回请求方的认证用户
+func (w *ClaudeWarp) requireController(wr http.ResponseWriter, r *http.Request) (string, bool) {
+	if reason := w.controlDenied(r); reason != "" {
+		http.Error(wr, reason, http.StatusForbidden)
+		return "", false
+	}
+	return requestUser(r), true
+}
+
+// submitInput 将输入送入输入通道并等待策略决策，输入通道已满时返回false
+func (w *ClaudeWarp) submitInput(in WebInput) (InputDecision, bool) {
+	in.ID = newInputID()
+	in.reply = make(chan InputDecision, 1)
 	select {
-	case w.inputChan <- req:
-		wr.WriteHeader(http.StatusOK)
+	case w.inputChan <- in:
 	default:
-		http.Error(wr, "输入队列已满", http.StatusServiceUnavailable)
+		w.metrics.inputRejected.Add(1)
+		return InputDecision{}, false
+	}
+
+	decision := InputDecision{Type: protocol.EventInputDecision, ID: in.ID, Decision: DecisionQueued}
+	select {
+	case decision = <-in.reply:
+	case <-time.After(5 * time.Second):
 	}
+	return decision, true
 }
 
 // cleanup 清理资源
 func (w *ClaudeWarp) cleanup() {
+	// 信号处理与子进程退出可能同时触发清理，只执行一次
+	w.cleanupOnce.Do(w.doCleanup)
+}
+
+// doCleanup 执行清理
+func (w *ClaudeWarp) doCleanup() {
 	// 恢复终端状态 - 非常重要！
 	if w.termState != nil {
 		if err := term.Restore(int(os.Stdin.Fd()), w.termState); err != nil {
@@ -666,17 +1224,36 @@ func (w *ClaudeWarp) cleanup() {
 		w.inputWriter = nil
 	}
 
-	// 关闭PTY
-	if w.ptmx != nil {
-		w.ptmx.Close()
-		w.ptmx = nil
+	// 关闭PTY并终止Claude进程（已退出的进程无需再等待）
+	w.childMux.Lock()
+	child := w.proc
+	w.proc = nil
+	w.childMux.Unlock()
+	if child != nil {
+		child.ptmx.Close()
+		if !child.exited() {
+			child.cmd.Process.Kill()
+			child.wait() // 等待进程真正结束
+			w.recordChildExit(child.cmd)
+		}
+	}
+
+	// 注销会话
+	if w.sessionFile != "" {
+		os.Remove(w.sessionFile)
+		w.sessionFile = ""
+	}
+
+	// 删除Unix socket文件
+	if w.unixSocket != "" {
+		os.Remove(w.unixSocket)
+		w.unixSocket = ""
 	}
 
-	// 终止Claude进程
-	if w.claudeCmd != nil && w.claudeCmd.Process != nil {
-		w.claudeCmd.Process.Kill()
-		w.claudeCmd.Process.Wait() // 等待进程真正结束
-		w.claudeCmd = nil
+	// 关闭审计日志
+	if w.audit != nil {
+		w.audit.Close()
+		w.audit = nil
 	}
 
 	// 关闭通道
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metrics 运行指标，以Prometheus文本格式暴露
+type metrics struct {
+	ptyBytesRead      atomic.Int64 // 从ptmx读取的字节数
+	webInputBytes     atomic.Int64 // Web输入写入PTY的字节数
+	inputRejected     atomic.Int64 // 输入队列已满被拒绝的次数
+	wsSendErrors      atomic.Int64 // WebSocket发送失败次数
+	childRestarts     atomic.Int64 // 子进程重启次数
+	startTime         time.Time    // 会话启动时间
+	stateMux          sync.Mutex   // 状态耗时锁
+	stateSeconds      map[SessionState]float64
+	stateEnteredAt    time.Time
+	currentStateLabel SessionState
+}
+
+// newMetrics 创建指标集合
+func newMetrics() *metrics {
+	now := time.Now()
+	return &metrics{
+		startTime:         now,
+		stateSeconds:      make(map[SessionState]float64),
+		stateEnteredAt:    now,
+		currentStateLabel: StateRunning,
+	}
+}
+
+// observeState 记录状态切换，累计上一个状态的持续时间
+func (m *metrics) observeState(to SessionState, at time.Time) {
+	m.stateMux.Lock()
+	defer m.stateMux.Unlock()
+
+	m.stateSeconds[m.currentStateLabel] += at.Sub(m.stateEnteredAt).Seconds()
+	m.currentStateLabel = to
+	m.stateEnteredAt = at
+}
+
+// stateDurations 返回各状态累计时长（含当前状态已持续的时间）
+func (m *metrics) stateDurations() (map[SessionState]float64, SessionState) {
+	m.stateMux.Lock()
+	defer m.stateMux.Unlock()
+
+	durations := make(map[SessionState]float64, len(m.stateSeconds)+1)
+	for state, sec := range m.stateSeconds {
+		durations[state] = sec
+	}
+	durations[m.currentStateLabel] += time.Since(m.stateEnteredAt).Seconds()
+	return durations, m.currentStateLabel
+}
+
+// handleMetrics 处理/metrics请求
+func (w *ClaudeWarp) handleMetrics(wr http.ResponseWriter, r *http.Request) {
+	m := w.metrics
+
+	w.clientsMux.RLock()
+	clients := len(w.clients)
+	w.clientsMux.RUnlock()
+
+	var b strings.Builder
+	writeMetric(&b, "claudewarp_websocket_clients", "gauge", "当前连接的WebSocket客户端数", float64(clients))
+	writeMetric(&b, "claudewarp_pty_read_bytes_total", "counter", "从PTY读取的字节总数", float64(m.ptyBytesRead.Load()))
+	writeMetric(&b, "claudewarp_web_input_bytes_total", "counter", "Web输入写入PTY的字节总数", float64(m.webInputBytes.Load()))
+	writeMetric(&b, "claudewarp_input_queue_depth", "gauge", "输入队列中等待处理的条目数", float64(len(w.inputChan)))
+	writeMetric(&b, "claudewarp_input_queue_capacity", "gauge", "输入队列容量", float64(cap(w.inputChan)))
+	writeMetric(&b, "claudewarp_input_rejected_total", "counter", "因输入队列已满被拒绝的输入数", float64(m.inputRejected.Load()))
+	writeMetric(&b, "claudewarp_websocket_send_errors_total", "counter", "WebSocket发送失败次数", float64(m.wsSendErrors.Load()))
+	writeMetric(&b, "claudewarp_session_uptime_seconds", "gauge", "会话已运行的秒数", time.Since(m.startTime).Seconds())
+	writeMetric(&b, "claudewarp_child_restarts_total", "counter", "Claude子进程重启次数", float64(m.childRestarts.Load()))
+
+	durations, current := m.stateDurations()
+	states := make([]string, 0, len(durations))
+	for state := range durations {
+		states = append(states, string(state))
+	}
+	sort.Strings(states)
+
+	fmt.Fprintf(&b, "# HELP claudewarp_state_seconds_total 会话处于各状态的累计秒数\n")
+	fmt.Fprintf(&b, "# TYPE claudewarp_state_seconds_total counter\n")
+	for _, state := range states {
+		fmt.Fprintf(&b, "claudewarp_state_seconds_total{state=%q} %g\n", state, durations[SessionState(state)])
+	}
+	fmt.Fprintf(&b, "# HELP claudewarp_state 当前会话状态（值为1的标签即当前状态）\n")
+	fmt.Fprintf(&b, "# TYPE claudewarp_state gauge\n")
+	for _, state := range []SessionState{StateRunning, StateIdle, StateAwaitingApproval, StateRateLimited, StateExited} {
+		value := 0
+		if state == current {
+			value = 1
+		}
+		fmt.Fprintf(&b, "claudewarp_state{state=%q} %d\n", state, value)
+	}
+
+	wr.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	wr.Write([]byte(b.String()))
+}
+
+// writeMetric 写入单个无标签指标
+func writeMetric(b *strings.Builder, name, typ, help string, value float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, typ)
+	fmt.Fprintf(b, "%s %g\n", name, value)
+}
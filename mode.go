@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// Mode Claude的权限模式
+type Mode = protocol.Mode
+
+const (
+	modeSwitchTimeout = 3 * time.Second        // 每次按Shift+Tab后等待模式变化的时间
+	modePollInterval  = 100 * time.Millisecond // 等待模式变化时的检查间隔
+)
+
+// 屏幕启发式：Claude状态栏中的模式提示，如：
+//
+//	⏵⏵ accept edits on (shift+tab to cycle)
+//	⏸ plan mode on (shift+tab to cycle)
+//	⏵⏵ bypass permissions on (shift+tab to cycle)
+//
+// 普通模式下没有模式提示，只显示 "? for shortcuts"
+var modePatterns = []struct {
+	mode Mode
+	re   *regexp.Regexp
+}{
+	{protocol.ModeAcceptEdits, regexp.MustCompile(`(?i)accept edits on`)},
+	{protocol.ModePlan, regexp.MustCompile(`(?i)plan mode on`)},
+	{protocol.ModeBypassPermissions, regexp.MustCompile(`(?i)bypass permissions on`)},
+	{protocol.ModeDefault, regexp.MustCompile(`\? for shortcuts`)},
+}
+
+// parseMode 取屏幕文本中最后出现的模式提示，没有时返回空
+func parseMode(text string) Mode {
+	var mode Mode
+	last := -1
+	for _, p := range modePatterns {
+		locs := p.re.FindAllStringIndex(text, -1)
+		if len(locs) > 0 && locs[len(locs)-1][0] > last {
+			last, mode = locs[len(locs)-1][0], p.mode
+		}
+	}
+	return mode
+}
+
+// validMode 判断是否为已知的权限模式
+func validMode(mode Mode) bool {
+	switch mode {
+	case protocol.ModeDefault, protocol.ModeAcceptEdits, protocol.ModePlan, protocol.ModeBypassPermissions:
+		return true
+	}
+	return false
+}
+
+// modeCycle 返回Shift+Tab的切换顺序，bypass模式只有出现过才在循环中
+func (t *stateTracker) modeCycle() []Mode {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	cycle := []Mode{protocol.ModeDefault, protocol.ModeAcceptEdits, protocol.ModePlan}
+	if t.bypassSeen {
+		cycle = append(cycle, protocol.ModeBypassPermissions)
+	}
+	return cycle
+}
+
+// onModeChange 权限模式变化时向Web客户端推送当前状态
+func (w *ClaudeWarp) onModeChange(mode Mode) {
+	state, since := w.tracker.Current()
+	w.broadcastEvent(StateEvent{
+		Type:    protocol.EventState,
+		State:   state,
+		Since:   since,
+		ResetAt: w.rateLimitView(state),
+		Mode:    mode,
+	})
+}
+
+// setMode 逐次发送Shift+Tab直到屏幕上显示目标模式。
+// 按键经由输入通道，同样受输入策略约束并写入审计日志；in 提供来源和用户信息。
+func (w *ClaudeWarp) setMode(target Mode, in WebInput) (protocol.ModeResult, error) {
+	w.modeMux.Lock()
+	defer w.modeMux.Unlock()
+
+	cycle := w.tracker.modeCycle()
+	found := false
+	for _, mode := range cycle {
+		found = found || mode == target
+	}
+	if !found {
+		return protocol.ModeResult{}, fmt.Errorf("模式 %s 不在Claude的Shift+Tab循环中（bypass_permissions 需以 --dangerously-skip-permissions 启动）", target)
+	}
+
+	result := protocol.ModeResult{Mode: w.tracker.Mode()}
+	if result.Mode == "" {
+		return result, fmt.Errorf("尚未识别到Claude当前的模式")
+	}
+	shiftTab, _ := protocol.KeySequence("shift-tab")
+	for result.Mode != target {
+		if result.Presses >= len(cycle) {
+			return result, fmt.Errorf("已发送%d次Shift+Tab仍未切换到 %s，当前为 %s", result.Presses, target, result.Mode)
+		}
+		if err := w.sendModeKey(in, shiftTab); err != nil {
+			return result, err
+		}
+		result.Presses++
+		result.Mode = w.waitModeChange(result.Mode)
+	}
+	return result, nil
+}
+
+// sendModeKey 经由输入通道发送一次按键并等待策略决策
+func (w *ClaudeWarp) sendModeKey(in WebInput, seq string) error {
+	in.Content, in.AddNewline = seq, false
+	in.ID = newInputID()
+	in.reply = make(chan InputDecision, 1)
+	select {
+	case w.inputChan <- in:
+	default:
+		w.metrics.inputRejected.Add(1)
+		return fmt.Errorf("输入队列已满")
+	}
+	select {
+	case decision := <-in.reply:
+		if decision.Decision != DecisionAllowed {
+			return fmt.Errorf("Shift+Tab 未被执行（%s）: %s", decision.Decision, decision.Reason)
+		}
+		return nil
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("等待Shift+Tab输入决策超时")
+	}
+}
+
+// waitModeChange 等待屏幕上的模式变化，超时返回当前模式
+func (w *ClaudeWarp) waitModeChange(prev Mode) Mode {
+	deadline := time.Now().Add(modeSwitchTimeout)
+	for time.Now().Before(deadline) {
+		if mode := w.tracker.Mode(); mode != prev {
+			return mode
+		}
+		time.Sleep(modePollInterval)
+	}
+	return w.tracker.Mode()
+}
+
+// switchMode 校验发送者权限后切换模式，失败时返回对应的HTTP状态码
+func (w *ClaudeWarp) switchMode(in WebInput, mode Mode, r *http.Request) (protocol.ModeResult, int, error) {
+	if reason := w.controlDenied(r); reason != "" {
+		return protocol.ModeResult{}, http.StatusForbidden, errors.New(reason)
+	}
+	if !validMode(mode) {
+		return protocol.ModeResult{}, http.StatusBadRequest, fmt.Errorf("未知模式: %s", mode)
+	}
+	if state, _ := w.tracker.Current(); state == StateExited {
+		return protocol.ModeResult{}, http.StatusConflict, fmt.Errorf("Claude已退出")
+	}
+
+	result, err := w.setMode(mode, in)
+	if err != nil {
+		return result, http.StatusConflict, err
+	}
+	if result.Presses > 0 {
+		w.addMessage("output", fmt.Sprintf("🔀 %s 将Claude切换到 %s 模式", requestIdentity(in.User, r.RemoteAddr), result.Mode))
+	}
+	return result, http.StatusOK, nil
+}
+
+// handleMode 处理权限模式查询和切换：GET /api/mode，POST /api/mode {"mode": "plan"}
+func (w *ClaudeWarp) handleMode(wr http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		data, _ := json.Marshal(protocol.ModeResult{Mode: w.tracker.Mode()})
+		wr.Header().Set("Content-Type", "application/json")
+		wr.Write(data)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(wr, "仅支持GET和POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req protocol.ModeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !validMode(req.Mode) {
+		http.Error(wr, "需要JSON请求体 {\"mode\": \"default|accept_edits|plan|bypass_permissions\"}", http.StatusBadRequest)
+		return
+	}
+
+	result, status, err := w.switchMode(w.remoteInput(r, SourceAPI), req.Mode, r)
+	if err != nil {
+		http.Error(wr, err.Error(), status)
+		return
+	}
+	data, _ := json.Marshal(result)
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// notifier 在会话状态变化时发送通知
+type notifier struct {
+	mu         sync.RWMutex
+	webhookURL string                // Webhook地址，为空则不发送
+	bell       bool                  // 是否在本地终端响铃
+	states     map[SessionState]bool // 需要通知的状态
+	console    io.Writer             // 本地终端
+	client     *http.Client
+}
+
+// webhookPayload Webhook通知内容
+type webhookPayload struct {
+	Event    string                 `json:"event"` // state_changed / rate_limited / rate_limit_reset / budget_exceeded
+	State    SessionState           `json:"state,omitempty"`
+	Previous SessionState           `json:"previous,omitempty"`
+	Since    time.Time              `json:"since"`
+	ResetAt  *time.Time             `json:"reset_at,omitempty"` // rate_limited 事件的用量重置时间
+	Budget   *protocol.BudgetStatus `json:"budget,omitempty"`   // budget_exceeded 事件超出的预算
+}
+
+// newNotifier 创建通知器
+func newNotifier(cfg NotifyConfig, console io.Writer) *notifier {
+	n := &notifier{
+		console: console,
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+	n.update(cfg)
+	return n
+}
+
+// update 应用通知配置，支持运行时热加载
+func (n *notifier) update(cfg NotifyConfig) {
+	states := make(map[SessionState]bool, len(cfg.States))
+	for _, state := range cfg.States {
+		states[state] = true
+	}
+
+	n.mu.Lock()
+	n.webhookURL = cfg.Webhook
+	n.bell = cfg.Bell
+	n.states = states
+	n.mu.Unlock()
+}
+
+// notifyState 发送状态变化通知
+func (n *notifier) notifyState(from, to SessionState, since time.Time) {
+	n.mu.RLock()
+	webhookURL, bell, enabled := n.webhookURL, n.bell, n.states[to]
+	n.mu.RUnlock()
+	if !enabled {
+		return
+	}
+
+	if bell && n.console != nil {
+		fmt.Fprint(n.console, "\a")
+	}
+
+	if webhookURL != "" {
+		payload := webhookPayload{
+			Event:    "state_changed",
+			State:    to,
+			Previous: from,
+			Since:    since,
+		}
+		go n.postWebhook(webhookURL, payload)
+	}
+}
+
+// notifyRateLimit 在用量达到上限和解除时通知，不受 notify.states 过滤
+func (n *notifier) notifyRateLimit(limited bool, resetAt time.Time) {
+	n.mu.RLock()
+	webhookURL, bell := n.webhookURL, n.bell
+	n.mu.RUnlock()
+
+	if bell && n.console != nil {
+		fmt.Fprint(n.console, "\a")
+	}
+	if webhookURL == "" {
+		return
+	}
+	payload := webhookPayload{Event: "rate_limit_reset", Since: time.Now()}
+	if limited {
+		payload.Event, payload.ResetAt = "rate_limited", &resetAt
+	}
+	go n.postWebhook(webhookURL, payload)
+}
+
+// notifyBudget 在预算超出时通知，不受 notify.states 过滤
+func (n *notifier) notifyBudget(budget protocol.BudgetStatus) {
+	n.mu.RLock()
+	webhookURL, bell := n.webhookURL, n.bell
+	n.mu.RUnlock()
+
+	if bell && n.console != nil {
+		fmt.Fprint(n.console, "\a")
+	}
+	if webhookURL != "" {
+		go n.postWebhook(webhookURL, webhookPayload{Event: "budget_exceeded", Since: time.Now(), Budget: &budget})
+	}
+}
+
+// postWebhook 发送Webhook请求
+func (n *notifier) postWebhook(webhookURL string, payload interface{}) {
+	data, _ := json.Marshal(payload)
+	resp, err := n.client.Post(webhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Printf("发送Webhook通知失败: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Webhook返回异常状态: %s", resp.Status)
+	}
+}
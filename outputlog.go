@@ -0,0 +1,78 @@
+package main
+
+import "sync"
+
+// outputLogSize 输出日志保留的字节数，断线重连的客户端可从其中续传
+const outputLogSize = 1 << 20
+
+// outputLog 记录发送给Web客户端的终端输出（已脱敏），按全局字节偏移寻址
+type outputLog struct {
+	mu    sync.Mutex
+	buf   []byte
+	start int64 // buf[0] 对应的全局偏移
+	limit int
+}
+
+// newOutputLog 创建输出日志
+func newOutputLog(limit int) *outputLog {
+	return &outputLog{limit: limit}
+}
+
+// Append 追加输出，返回其起始偏移
+func (l *outputLog) Append(p string) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	offset := l.start + int64(len(l.buf))
+	l.buf = append(l.buf, p...)
+	// 超过两倍容量时才整体裁剪，避免每次追加都搬移数据
+	if len(l.buf) > 2*l.limit {
+		over := len(l.buf) - l.limit
+		l.buf = append(l.buf[:0:0], l.buf[over:]...)
+		l.start += int64(over)
+	}
+	return offset
+}
+
+// Since 返回从offset开始的输出及实际起始偏移；offset过旧时从最早保留的位置开始
+func (l *outputLog) Since(offset int64) (string, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	end := l.start + int64(len(l.buf))
+	if offset < l.start {
+		offset = l.start
+	}
+	// 不从UTF-8字符中间开始，避免JSON编码时产生替换字符
+	for offset < end && l.buf[offset-l.start]&0xc0 == 0x80 {
+		offset++
+	}
+	if offset >= end {
+		return "", end
+	}
+	return string(l.buf[offset-l.start:]), offset
+}
+
+// End 返回输出流的末尾偏移
+func (l *outputLog) End() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.start + int64(len(l.buf))
+}
+
+// Range 返回[start, end)之间的输出；开头部分已被裁剪时返回false
+func (l *outputLog) Range(start, end int64) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if start < l.start {
+		return "", false
+	}
+	if last := l.start + int64(len(l.buf)); end > last {
+		end = last
+	}
+	if start >= end {
+		return "", true
+	}
+	return string(l.buf[start-l.start : end-l.start]), true
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// readPeerCred 通过SO_PEERCRED获取Unix socket对端进程的凭据
+func readPeerCred(conn *net.UnixConn) (*peerCred, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var ucred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+	return &peerCred{PID: int(ucred.Pid), UID: int(ucred.Uid), GID: int(ucred.Gid)}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// readPeerCred 当前平台不支持SO_PEERCRED
+func readPeerCred(conn *net.UnixConn) (*peerCred, error) {
+	return nil, errors.New("当前平台不支持获取Unix socket对端凭据")
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// 策略动作
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+	PolicyHold  = "hold"
+)
+
+// 输入决策结果
+const (
+	DecisionQueued   = protocol.DecisionQueued
+	DecisionAllowed  = protocol.DecisionAllowed
+	DecisionDenied   = protocol.DecisionDenied
+	DecisionHeld     = protocol.DecisionHeld
+	DecisionApproved = protocol.DecisionApproved
+	DecisionRejected = protocol.DecisionRejected
+	DecisionExpired  = protocol.DecisionExpired
+)
+
+// PolicyConfig 远程输入策略配置（支持SIGHUP热加载）
+type PolicyConfig struct {
+	Default     string       `json:"default"`      // 无规则匹配时的动作
+	HoldTimeout Duration     `json:"hold_timeout"` // 挂起输入等待审批的时长
+	Rules       []PolicyRule `json:"rules"`        // 按顺序匹配，第一条命中的规则生效
+}
+
+// PolicyRule 单条输入策略规则，未设置的条件视为匹配任意值
+type PolicyRule struct {
+	Name    string         `json:"name"`
+	Action  string         `json:"action"`            // allow / deny / hold
+	Pattern string         `json:"pattern,omitempty"` // 输入内容正则
+	Sources []string       `json:"sources,omitempty"` // web / api ...
+	Roles   []string       `json:"roles,omitempty"`   // 发送者角色
+	States  []SessionState `json:"states,omitempty"`  // 当前检测到的会话状态
+	// PromptPattern Claude当前显示的提示（屏幕底部几行，如确认对话框中的命令和问题）正则
+	PromptPattern string `json:"prompt_pattern,omitempty"`
+
+	re       *regexp.Regexp
+	promptRe *regexp.Regexp
+}
+
+// validate 校验策略配置
+func (p PolicyConfig) validate() []error {
+	var errs []error
+	if !validPolicyAction(p.Default) {
+		errs = append(errs, fmt.Errorf("policy.default 必须是 allow/deny/hold，当前为 %q", p.Default))
+	}
+	if p.HoldTimeout.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("policy.hold_timeout 必须大于0"))
+	}
+	for i, rule := range p.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if !validPolicyAction(rule.Action) {
+			errs = append(errs, fmt.Errorf("policy.rules[%s].action 必须是 allow/deny/hold", name))
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			errs = append(errs, fmt.Errorf("policy.rules[%s].pattern 无效: %v", name, err))
+		}
+		if _, err := regexp.Compile(rule.PromptPattern); err != nil {
+			errs = append(errs, fmt.Errorf("policy.rules[%s].prompt_pattern 无效: %v", name, err))
+		}
+	}
+	return errs
+}
+
+// usesHold 是否有规则（含默认动作）会挂起输入等待审批
+func (p PolicyConfig) usesHold() bool {
+	if p.Default == PolicyHold {
+		return true
+	}
+	for _, rule := range p.Rules {
+		if rule.Action == PolicyHold {
+			return true
+		}
+	}
+	return false
+}
+
+func validPolicyAction(action string) bool {
+	return action == PolicyAllow || action == PolicyDeny || action == PolicyHold
+}
+
+// inputPolicy 位于inputChan与PTY之间的策略引擎
+type inputPolicy struct {
+	mu      sync.RWMutex
+	cfg     PolicyConfig
+	pending map[string]*pendingInput
+}
+
+// pendingInput 等待审批的输入
+type pendingInput struct {
+	Input     WebInput
+	Rule      string
+	HeldAt    time.Time
+	ExpiresAt time.Time
+	timer     *time.Timer
+}
+
+// PendingInputView 是/api/input/pending返回的挂起输入
+type PendingInputView = protocol.PendingInput
+
+// InputDecision 输入的策略决策，返回给发送者并通过WebSocket广播
+type InputDecision = protocol.InputDecision
+
+// newInputPolicy 创建策略引擎
+func newInputPolicy(cfg PolicyConfig) (*inputPolicy, error) {
+	p := &inputPolicy{pending: make(map[string]*pendingInput)}
+	if err := p.update(cfg); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// update 应用新的策略配置
+func (p *inputPolicy) update(cfg PolicyConfig) error {
+	rules := make([]PolicyRule, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("策略规则 %q 的正则无效: %v", rule.Name, err)
+		}
+		if rule.promptRe, err = regexp.Compile(rule.PromptPattern); err != nil {
+			return fmt.Errorf("策略规则 %q 的提示正则无效: %v", rule.Name, err)
+		}
+		rule.re = re
+		rules[i] = rule
+	}
+	cfg.Rules = rules
+
+	p.mu.Lock()
+	p.cfg = cfg
+	p.mu.Unlock()
+	return nil
+}
+
+// evaluate 返回输入应执行的动作及命中的规则名，prompt为Claude当前显示的提示
+func (p *inputPolicy) evaluate(in WebInput, state SessionState, prompt string) (string, string) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for i, rule := range p.cfg.Rules {
+		if rule.Pattern != "" && !rule.re.MatchString(in.Content) {
+			continue
+		}
+		if len(rule.Sources) > 0 && !containsString(rule.Sources, in.Source) {
+			continue
+		}
+		if len(rule.Roles) > 0 && !containsString(rule.Roles, in.Role) {
+			continue
+		}
+		if len(rule.States) > 0 && !containsState(rule.States, state) {
+			continue
+		}
+		if rule.PromptPattern != "" && !rule.promptRe.MatchString(prompt) {
+			continue
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		return rule.Action, name
+	}
+	return p.cfg.Default, "default"
+}
+
+// hold 挂起输入等待审批，超时后调用onExpire
+func (p *inputPolicy) hold(in WebInput, rule string, onExpire func(*pendingInput)) *pendingInput {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	item := &pendingInput{
+		Input:     in,
+		Rule:      rule,
+		HeldAt:    now,
+		ExpiresAt: now.Add(p.cfg.HoldTimeout.Duration),
+	}
+	item.timer = time.AfterFunc(p.cfg.HoldTimeout.Duration, func() {
+		if expired := p.take(in.ID); expired != nil {
+			onExpire(expired)
+		}
+	})
+	p.pending[in.ID] = item
+	return item
+}
+
+// take 取出并移除挂起输入
+func (p *inputPolicy) take(id string) *pendingInput {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	item, ok := p.pending[id]
+	if !ok {
+		return nil
+	}
+	item.timer.Stop()
+	delete(p.pending, id)
+	return item
+}
+
+// get 查询挂起输入
+func (p *inputPolicy) get(id string) *pendingInput {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pending[id]
+}
+
+// list 返回所有挂起输入
+func (p *inputPolicy) list() []PendingInputView {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	views := make([]PendingInputView, 0, len(p.pending))
+	for _, item := range p.pending {
+		views = append(views, PendingInputView{
+			ID:         item.Input.ID,
+			Content:    item.Input.Content,
+			AddNewline: item.Input.AddNewline,
+			Source:     item.Input.Source,
+			User:       item.Input.User,
+			RemoteAddr: item.Input.RemoteAddr,
+			Rule:       item.Rule,
+			HeldAt:     item.HeldAt,
+			ExpiresAt:  item.ExpiresAt,
+		})
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].HeldAt.Before(views[j].HeldAt) })
+	return views
+}
+
+// processInput 对远程输入执行策略并将决策回报给发送者
+func (w *ClaudeWarp) processInput(in WebInput) {
+	state, _ := w.tracker.Current()
+	action, rule := w.policy.evaluate(in, state, w.tracker.Prompt())
+
+	var decision InputDecision
+	switch action {
+	case PolicyDeny:
+		decision = InputDecision{ID: in.ID, Decision: DecisionDenied, Rule: rule, Reason: "输入被策略拒绝"}
+		w.auditDecision(in, DecisionDenied, rule, "")
+		w.addMessage("error", fmt.Sprintf("🚫 已拒绝输入 %q（规则 %s，%s）", in.Content, rule, inputOrigin(in)))
+	case PolicyHold:
+		if in.User == "" && (in.Source == SourceWeb || in.Source == SourceAPI) {
+			// 匿名发送者无法与审批人区分，不能进入双人审批流程
+			decision = InputDecision{ID: in.ID, Decision: DecisionDenied, Rule: rule, Reason: "需要审批的输入必须由已认证用户发送"}
+			w.auditDecision(in, DecisionDenied, rule, "")
+			w.addMessage("error", fmt.Sprintf("🚫 已拒绝匿名发送的需审批输入 %q（规则 %s，%s）", in.Content, rule, inputOrigin(in)))
+			break
+		}
+		w.policy.hold(in, rule, w.expirePending)
+		decision = InputDecision{ID: in.ID, Decision: DecisionHeld, Rule: rule, Reason: "等待其他用户审批"}
+		w.auditDecision(in, DecisionHeld, rule, "")
+		w.addMessage("output", fmt.Sprintf("⏸️ 输入 %q 等待审批（规则 %s，%s）", in.Content, rule, inputOrigin(in)))
+		w.broadcastPending()
+	default:
+		decision = InputDecision{ID: in.ID, Decision: DecisionAllowed, Rule: rule}
+		if err := w.writeInput(in, DecisionAllowed, rule, ""); err != nil {
+			decision = InputDecision{ID: in.ID, Decision: DecisionDenied, Rule: rule, Reason: err.Error()}
+		}
+	}
+	w.reportDecision(in, decision)
+}
+
+// expirePending 挂起输入审批超时
+func (w *ClaudeWarp) expirePending(item *pendingInput) {
+	w.auditDecision(item.Input, DecisionExpired, item.Rule, "")
+	w.reportDecision(item.Input, InputDecision{ID: item.Input.ID, Decision: DecisionExpired, Rule: item.Rule, Reason: "审批超时"})
+	w.broadcastPending()
+}
+
+// reportDecision 将决策回报给发送者（同步等待的请求）并广播给Web客户端
+func (w *ClaudeWarp) reportDecision(in WebInput, decision InputDecision) {
+	decision.Type = protocol.EventInputDecision
+	if in.reply != nil {
+		select {
+		case in.reply <- decision:
+		default:
+		}
+	}
+	w.broadcastEvent(decision)
+	w.queueDecision(in, decision)
+}
+
+// auditDecision 记录未写入PTY的策略决策
+func (w *ClaudeWarp) auditDecision(in WebInput, decision, rule, by string) {
+	if err := w.audit.Record(AuditEntry{
+		Source:     in.Source,
+		Transport:  in.Transport,
+		User:       in.User,
+		RemoteAddr: in.RemoteAddr,
+		Data:       []byte(in.Content),
+		Decision:   decision,
+		Rule:       rule,
+		ApprovedBy: by,
+	}); err != nil {
+		w.addMessage("error", err.Error())
+	}
+}
+
+// broadcastPending 广播挂起输入列表
+func (w *ClaudeWarp) broadcastPending() {
+	w.broadcastEvent(map[string]interface{}{
+		"type":    protocol.EventInputPending,
+		"pending": w.policy.list(),
+	})
+}
+
+// handlePendingInputs 处理 GET /api/input/pending 与 POST /api/input/pending/{id}/approve|reject
+func (w *ClaudeWarp) handlePendingInputs(wr http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/input/pending"), "/")
+	if rest == "" {
+		data, _ := json.Marshal(w.policy.list())
+		wr.Header().Set("Content-Type", "application/json")
+		wr.Write(data)
+		return
+	}
+
+	id, action, ok := strings.Cut(rest, "/")
+	if !ok || (action != "approve" && action != "reject") {
+		http.NotFound(wr, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(wr, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := w.requireController(wr, r)
+	if !ok {
+		return
+	}
+	item := w.policy.get(id)
+	if item == nil {
+		http.Error(wr, "挂起输入不存在或已处理", http.StatusNotFound)
+		return
+	}
+	// 审批人必须是已认证用户，IP无法区分同一人的多个地址或同一NAT后的多个人
+	if user == "" {
+		http.Error(wr, "审批输入需要已认证身份（mTLS客户端证书或Unix socket本地用户）", http.StatusForbidden)
+		return
+	}
+	approver := user
+	if approver == item.Input.User {
+		http.Error(wr, "不能审批自己发送的输入，需要其他用户确认", http.StatusForbidden)
+		return
+	}
+	if item = w.policy.take(id); item == nil {
+		http.Error(wr, "挂起输入不存在或已处理", http.StatusNotFound)
+		return
+	}
+
+	decision := InputDecision{ID: id, Rule: item.Rule, By: approver}
+	if action == "approve" {
+		decision.Decision = DecisionApproved
+		if err := w.writeInput(item.Input, DecisionApproved, item.Rule, approver); err != nil {
+			decision.Reason = err.Error()
+		}
+	} else {
+		decision.Decision = DecisionRejected
+		w.auditDecision(item.Input, DecisionRejected, item.Rule, approver)
+		w.addMessage("output", fmt.Sprintf("🚫 %s 拒绝了输入 %q", approver, item.Input.Content))
+	}
+	w.reportDecision(item.Input, decision)
+	w.broadcastPending()
+
+	data, _ := json.Marshal(decision)
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
+
+// requestIdentity 用于日志的发送者标识：优先使用认证用户，否则使用客户端IP
+func requestIdentity(user, remoteAddr string) string {
+	if user != "" {
+		return user
+	}
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// newInputID 生成输入ID
+func newInputID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsState(list []SessionState, s SessionState) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy, err := newInputPolicy(PolicyConfig{
+		Default:     PolicyAllow,
+		HoldTimeout: Duration{Duration: 1},
+		Rules: []PolicyRule{
+			{Name: "no-rm-rf", Action: PolicyDeny, Pattern: `rm\s+-rf`},
+			{
+				Name:          "approve-rm",
+				Action:        PolicyHold,
+				States:        []SessionState{StateAwaitingApproval},
+				Pattern:       `^(1|y|yes)?\s*$`,
+				PromptPattern: `(?s)\brm\b.*Do you want to`,
+			},
+			{Name: "viewer-api", Action: PolicyDeny, Sources: []string{SourceAPI}, Roles: []string{RoleViewer}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rmPrompt := "Bash command\n  rm build/cache.db\n  Remove stale cache\nDo you want to proceed?\n❯ 1. Yes\n  2. No"
+	lsPrompt := "Bash command\n  ls -la\nDo you want to proceed?\n❯ 1. Yes\n  2. No"
+	tests := []struct {
+		name       string
+		in         WebInput
+		state      SessionState
+		prompt     string
+		wantAction string
+		wantRule   string
+	}{
+		{"content pattern", WebInput{Content: "rm -rf /"}, StateIdle, "", PolicyDeny, "no-rm-rf"},
+		{"yes to rm", WebInput{Content: "1"}, StateAwaitingApproval, rmPrompt, PolicyHold, "approve-rm"},
+		{"enter on rm", WebInput{Content: "", AddNewline: true}, StateAwaitingApproval, rmPrompt, PolicyHold, "approve-rm"},
+		{"yes to ls", WebInput{Content: "1"}, StateAwaitingApproval, lsPrompt, PolicyAllow, "default"},
+		{"no to rm", WebInput{Content: "2"}, StateAwaitingApproval, rmPrompt, PolicyAllow, "default"},
+		{"rm prompt while idle", WebInput{Content: "1"}, StateIdle, rmPrompt, PolicyAllow, "default"},
+		{"viewer via api", WebInput{Content: "hi", Source: SourceAPI, Role: RoleViewer}, StateIdle, "", PolicyDeny, "viewer-api"},
+		{"controller via api", WebInput{Content: "hi", Source: SourceAPI, Role: RoleController}, StateIdle, "", PolicyAllow, "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, rule := policy.evaluate(tt.in, tt.state, tt.prompt)
+			if action != tt.wantAction || rule != tt.wantRule {
+				t.Errorf("evaluate = (%s, %s), want (%s, %s)", action, rule, tt.wantAction, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestPolicyPromptPatternValidate(t *testing.T) {
+	cfg := PolicyConfig{
+		Default:     PolicyAllow,
+		HoldTimeout: Duration{Duration: 1},
+		Rules:       []PolicyRule{{Name: "bad", Action: PolicyDeny, PromptPattern: "("}},
+	}
+	if errs := cfg.validate(); len(errs) == 0 {
+		t.Error("validate accepted an invalid prompt_pattern")
+	}
+	if _, err := newInputPolicy(cfg); err == nil {
+		t.Error("newInputPolicy accepted an invalid prompt_pattern")
+	}
+}
+
+func TestTrackerPrompt(t *testing.T) {
+	screen := newScreenBuffer(64 * 1024)
+	tracker := newStateTracker(screen, 0, 0)
+	screen.Write([]byte(strings.Repeat("old output rm -rf /\r\n", 30)))
+	screen.Write([]byte("\x1b[2J\x1b[1;1H╭───╮\r\n│ Bash command │\r\n│   rm build/cache.db │\r\n\r\n│ Do you want to proceed? │\r\n│ ❯ 1. Yes │\r\n╰───╯\r\n"))
+
+	prompt := tracker.Prompt()
+	for _, want := range []string{"rm build/cache.db", "Do you want to proceed?"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Prompt() = %q, missing %q", prompt, want)
+		}
+	}
+	if rows := strings.Count(prompt, "\n") + 1; rows > promptRows {
+		t.Errorf("Prompt() has %d rows, want at most %d", rows, promptRows)
+	}
+}
@@ -0,0 +1,75 @@
+package protocol
+
+// 转义序列解析状态
+const (
+	ansiNormal = iota
+	ansiEscape
+	ansiCSI
+	ansiOSC
+	ansiOSCEscape
+)
+
+// TextStripper 去除终端输出中的ANSI转义序列，跨调用保持解析状态。
+// 光标跳到其他行的序列转换为换行，光标右移转换为空格，回车等控制字符被丢弃
+type TextStripper struct {
+	state int
+}
+
+// Strip 解析p，对每个纯文本字节调用emit，i为该字节（或产生它的转义序列末字节）在p中的下标
+func (s *TextStripper) Strip(p []byte, emit func(b byte, i int)) {
+	for i, b := range p {
+		switch s.state {
+		case ansiNormal:
+			switch {
+			case b == 0x1b:
+				s.state = ansiEscape
+			case b == '\r':
+				// 回车通常意味着行被重绘，保留换行语义即可
+			case b == '\n' || b == '\t' || b >= 0x20:
+				emit(b, i)
+			}
+		case ansiEscape:
+			switch b {
+			case '[':
+				s.state = ansiCSI
+			case ']':
+				s.state = ansiOSC
+			default:
+				s.state = ansiNormal
+			}
+		case ansiCSI:
+			if b >= 0x40 && b <= 0x7e {
+				switch b {
+				case 'H', 'f', 'A', 'B', 'E', 'F', 'd':
+					// 光标跳转到其他行，用换行分隔内容
+					emit('\n', i)
+				case 'C':
+					emit(' ', i)
+				}
+				s.state = ansiNormal
+			}
+		case ansiOSC:
+			switch b {
+			case 0x07:
+				s.state = ansiNormal
+			case 0x1b:
+				s.state = ansiOSCEscape
+			}
+		case ansiOSCEscape:
+			s.state = ansiNormal
+		}
+	}
+}
+
+// AppendText 把p中的纯文本追加到dst并返回
+func (s *TextStripper) AppendText(dst, p []byte) []byte {
+	s.Strip(p, func(b byte, _ int) {
+		dst = append(dst, b)
+	})
+	return dst
+}
+
+// InSequence 是否停在未结束的转义序列中
+func (s *TextStripper) InSequence() bool {
+	return s.state != ansiNormal
+}
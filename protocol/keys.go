@@ -0,0 +1,51 @@
+package protocol
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keySequences 按键名到终端输入序列的映射
+var keySequences = map[string]string{
+	"enter":     "\r",
+	"esc":       "\x1b",
+	"escape":    "\x1b",
+	"tab":       "\t",
+	"shift-tab": "\x1b[Z",
+	"backspace": "\x7f",
+	"delete":    "\x1b[3~",
+	"space":     " ",
+	"up":        "\x1b[A",
+	"down":      "\x1b[B",
+	"right":     "\x1b[C",
+	"left":      "\x1b[D",
+	"home":      "\x1b[H",
+	"end":       "\x1b[F",
+	"pageup":    "\x1b[5~",
+	"pagedown":  "\x1b[6~",
+}
+
+// KeySequence 把按键名转换为终端输入序列。
+// 支持 enter、esc、tab、shift-tab、backspace、delete、space、方向键、
+// home/end/pageup/pagedown，以及 ctrl-a … ctrl-z。
+func KeySequence(name string) (string, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if seq, ok := keySequences[key]; ok {
+		return seq, nil
+	}
+	if letter, ok := strings.CutPrefix(key, "ctrl-"); ok && len(letter) == 1 && letter[0] >= 'a' && letter[0] <= 'z' {
+		return string(rune(letter[0] - 'a' + 1)), nil
+	}
+	return "", fmt.Errorf("未知按键 %q", name)
+}
+
+// KeyNames 按字母顺序返回支持的按键名（不含 ctrl-a … ctrl-z）
+func KeyNames() []string {
+	names := make([]string, 0, len(keySequences))
+	for name := range keySequences {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,613 @@
+// Package protocol 定义 claudewarp HTTP/WebSocket 接口的公共数据结构，
+// 服务端与 client 包共用这些类型。
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebSocket 事件类型
+const (
+	EventTerminalData  = "terminal_data"  // 终端输出（含ANSI转义序列）
+	EventState         = "state"          // 会话状态变化
+	EventMessage       = "message"        // 结构化消息
+	EventPrompt        = "prompt"         // 检测到Claude等待输入或确认
+	EventBell          = "bell"           // 终端响铃
+	EventInputDecision = "input_decision" // 远程输入的策略决策
+	EventInputPending  = "input_pending"  // 等待审批的输入列表变化
+	EventResponders    = "responders"     // 自动应答规则状态变化
+	EventQueue         = "queue"          // 任务队列变化
+	EventSchedules     = "schedules"      // 定时任务或执行记录变化
+	EventClaudeSession = "claude_session" // 识别到Claude会话ID
+	EventUsage         = "usage"          // token用量或费用变化
+	EventWorkspace     = "workspace"      // 工作目录中的文件变化
+	EventCheckpoints   = "checkpoints"    // 工作目录检查点列表变化
+	EventWorktree      = "worktree"       // 会话的git worktree状态变化
+	EventModeResult    = "mode_result"    // WebSocket模式切换请求的结果（仅发给请求方）
+)
+
+// Web界面经WebSocket发送的请求类型，服务端据此把输入来源记为 web
+const (
+	RequestInput = "input" // 发送输入
+	RequestMode  = "mode"  // 切换权限模式
+)
+
+// ClientRequest 是Web界面经WebSocket发送的请求
+type ClientRequest struct {
+	Type       string `json:"type"`                  // 见 Request* 常量
+	Ref        string `json:"ref,omitempty"`         // 客户端请求编号，原样带回响应
+	Input      string `json:"input,omitempty"`       // RequestInput
+	AddNewline bool   `json:"add_newline,omitempty"` // RequestInput
+	Mode       Mode   `json:"mode,omitempty"`        // RequestMode
+}
+
+// State 表示Claude会话的当前状态
+type State string
+
+const (
+	StateRunning          State = "running"           // 正在输出/工作
+	StateIdle             State = "idle"              // 停在输入框等待新指令
+	StateAwaitingApproval State = "awaiting_approval" // 等待用户确认操作
+	StateRateLimited      State = "rate_limited"      // 用量已达上限，等待重置
+	StateExited           State = "exited"            // 子进程已退出
+)
+
+// Message 表示Claude交互消息
+type Message struct {
+	Type      string    `json:"type"`      // 见 Message* 常量
+	Content   string    `json:"content"`   // 消息内容
+	Timestamp time.Time `json:"timestamp"` // 时间戳
+
+	// 以下字段仅来自Claude对话记录的消息带有
+	SessionID string          `json:"session_id,omitempty"` // Claude会话ID
+	UUID      string          `json:"uuid,omitempty"`       // 对话记录中的条目ID
+	MessageID string          `json:"message_id,omitempty"` // API消息ID，同一回复的多个条目相同
+	Model     string          `json:"model,omitempty"`      // assistant消息使用的模型
+	Tool      string          `json:"tool,omitempty"`       // tool_use的工具名
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	ToolInput json.RawMessage `json:"tool_input,omitempty"` // tool_use的参数
+	IsError   bool            `json:"is_error,omitempty"`   // tool_result是否为错误
+	Usage     *TokenUsage     `json:"usage,omitempty"`      // assistant消息的token用量，同一MessageID重复出现
+}
+
+// 消息类型
+const (
+	MessageOutput     = "output"      // claudewarp状态消息
+	MessageInput      = "input"       // 远程输入
+	MessageError      = "error"       // 错误
+	MessageUser       = "user"        // 对话记录：用户轮次
+	MessageAssistant  = "assistant"   // 对话记录：Claude回复文本
+	MessageToolUse    = "tool_use"    // 对话记录：Claude调用工具
+	MessageToolResult = "tool_result" // 对话记录：工具执行结果
+)
+
+// TokenUsage 一次API调用的token用量
+type TokenUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+}
+
+// Event 是所有WebSocket事件的公共头
+type Event struct {
+	Type string `json:"type"`
+}
+
+// TerminalData 终端输出帧，Offset为Content在输出流中的起始偏移
+type TerminalData struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	Offset  int64  `json:"offset"`
+}
+
+// StateEvent 会话状态变化事件
+type StateEvent struct {
+	Type     string     `json:"type"`
+	State    State      `json:"state"`
+	Previous State      `json:"previous,omitempty"`
+	Since    time.Time  `json:"since"`
+	ResetAt  *time.Time `json:"reset_at,omitempty"` // rate_limited 状态下的用量重置时间
+	Mode     Mode       `json:"mode,omitempty"`     // Claude当前的权限模式，识别不到时为空
+}
+
+// Mode 是Claude的权限模式，在Claude中按Shift+Tab循环切换
+type Mode string
+
+const (
+	ModeDefault           Mode = "default"            // 普通模式，编辑和命令需要确认
+	ModeAcceptEdits       Mode = "accept_edits"       // 自动接受编辑
+	ModePlan              Mode = "plan"               // 计划模式，只规划不修改
+	ModeBypassPermissions Mode = "bypass_permissions" // 跳过所有确认（需以 --dangerously-skip-permissions 启动）
+)
+
+// ModeRequest 是 POST /api/mode 的请求体
+type ModeRequest struct {
+	Mode Mode `json:"mode"`
+}
+
+// ModeResult 是 POST /api/mode 的响应
+type ModeResult struct {
+	Mode    Mode `json:"mode"`    // 切换后识别到的模式
+	Presses int  `json:"presses"` // 发送的Shift+Tab次数
+}
+
+// ModeResultEvent 是WebSocket模式切换请求的结果
+type ModeResultEvent struct {
+	Type  string `json:"type"`
+	Ref   string `json:"ref,omitempty"`
+	Error string `json:"error,omitempty"`
+	ModeResult
+}
+
+// MessageEvent 结构化消息事件
+type MessageEvent struct {
+	Type    string  `json:"type"`
+	Message Message `json:"message"`
+}
+
+// 提示类型
+const (
+	PromptInput    = "input"    // Claude停在输入框
+	PromptApproval = "approval" // Claude等待确认操作
+)
+
+// PromptEvent 检测到Claude等待输入或确认时推送
+type PromptEvent struct {
+	Type string    `json:"type"`
+	Kind string    `json:"kind"`
+	Text string    `json:"text"` // 屏幕尾部文本
+	At   time.Time `json:"at"`
+}
+
+// InputRequest 是 POST /api/input 的请求体
+type InputRequest struct {
+	Input      string `json:"input"`
+	AddNewline bool   `json:"add_newline"`
+}
+
+// 输入决策结果
+const (
+	DecisionQueued   = "queued" // 已入队但未在等待时间内得到决策
+	DecisionAllowed  = "allowed"
+	DecisionDenied   = "denied"
+	DecisionHeld     = "held"
+	DecisionApproved = "approved"
+	DecisionRejected = "rejected"
+	DecisionExpired  = "expired"
+)
+
+// InputDecision 输入的策略决策，返回给发送者并通过WebSocket广播
+type InputDecision struct {
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	Decision string `json:"decision"`
+	Rule     string `json:"rule,omitempty"`
+	By       string `json:"by,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Ref      string `json:"ref,omitempty"` // WebSocket请求的客户端编号，仅在直接回复时带有
+}
+
+// PendingInput 是 /api/input/pending 返回的挂起输入
+type PendingInput struct {
+	ID         string    `json:"id"`
+	Content    string    `json:"input"`
+	AddNewline bool      `json:"add_newline"`
+	Source     string    `json:"source"`
+	User       string    `json:"user,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Rule       string    `json:"rule"`
+	HeldAt     time.Time `json:"held_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// ClientInfo WebSocket客户端信息
+type ClientInfo struct {
+	RemoteAddr  string    `json:"remote_addr"`
+	User        string    `json:"user,omitempty"`
+	Role        string    `json:"role"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// ChildInfo Claude子进程信息
+type ChildInfo struct {
+	PID       int        `json:"pid"`
+	Command   []string   `json:"command"`
+	Cwd       string     `json:"cwd"`
+	StartedAt time.Time  `json:"started_at"`
+	Exited    bool       `json:"exited"`
+	ExitCode  *int       `json:"exit_code,omitempty"`
+	Signal    string     `json:"signal,omitempty"`
+	ExitedAt  *time.Time `json:"exited_at,omitempty"`
+}
+
+// PTYSize PTY窗口大小
+type PTYSize struct {
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+}
+
+// Status 是 /api/status 返回的会话描述
+type Status struct {
+	State        State        `json:"state"`
+	StateSince   time.Time    `json:"state_since"`
+	Mode         Mode         `json:"mode,omitempty"`
+	Child        ChildInfo    `json:"child"`
+	PTY          *PTYSize     `json:"pty,omitempty"`
+	Clients      []ClientInfo `json:"clients"`
+	LastActivity time.Time    `json:"last_activity"`
+	LastOutput   time.Time    `json:"last_output"`
+	LastInput    *time.Time   `json:"last_input,omitempty"`
+	// ClaudeSession 是Claude自身的会话ID，可用于 /api/resume 恢复对话
+	ClaudeSession *ClaudeSession `json:"claude_session,omitempty"`
+	// Worktree 是会话专用的git worktree，profile未启用时为空
+	Worktree *Worktree `json:"worktree,omitempty"`
+}
+
+// Claude会话ID的来源
+const (
+	ClaudeSessionFromHook       = "hook"       // Claude hook 回调
+	ClaudeSessionFromTranscript = "transcript" // ~/.claude/projects 下的对话记录文件
+)
+
+// UsageTotals token用量及按价格表折算的费用
+type UsageTotals struct {
+	TokenUsage
+	Requests int64   `json:"requests"` // API调用次数
+	CostUSD  float64 `json:"cost_usd"`
+}
+
+// UsageSummary 按会话、profile、日期或模型分组的用量
+type UsageSummary struct {
+	Key string `json:"key"`
+	UsageTotals
+}
+
+// 预算统计范围
+const (
+	BudgetScopeSession = "session" // 本会话
+	BudgetScopeProfile = "profile" // 使用相同profile的所有会话
+	BudgetScopeAll     = "all"     // 所有会话
+)
+
+// 预算周期
+const (
+	BudgetPeriodDay   = "day"
+	BudgetPeriodMonth = "month"
+)
+
+// 超出预算时的动作
+const (
+	BudgetWarn  = "warn"  // 提示并发送通知
+	BudgetPause = "pause" // 同时暂停本会话的任务队列
+)
+
+// BudgetStatus 预算在当前周期内的使用情况
+type BudgetStatus struct {
+	Name     string  `json:"name"`
+	Scope    string  `json:"scope"`
+	Period   string  `json:"period"`
+	LimitUSD float64 `json:"limit_usd"`
+	SpentUSD float64 `json:"spent_usd"`
+	Action   string  `json:"action"`
+	Exceeded bool    `json:"exceeded"`
+}
+
+// Usage 是 /api/usage 返回的用量统计，分组统计覆盖最近 Days 天
+type Usage struct {
+	Session  string         `json:"session"`
+	Profile  string         `json:"profile"`
+	Days     int            `json:"days"`
+	Today    UsageTotals    `json:"today"` // 本会话今日用量
+	Total    UsageTotals    `json:"total"` // 统计窗口内所有会话的用量
+	Sessions []UsageSummary `json:"sessions"`
+	Profiles []UsageSummary `json:"profiles"`
+	Daily    []UsageSummary `json:"daily"`
+	Models   []UsageSummary `json:"models"`
+	Budgets  []BudgetStatus `json:"budgets,omitempty"`
+	Unpriced []string       `json:"unpriced,omitempty"` // 价格表中没有的模型，费用按0计
+}
+
+// UsageEvent 是用量变化时推送的事件
+type UsageEvent struct {
+	Type  string `json:"type"`
+	Usage Usage  `json:"usage"`
+}
+
+// 工作目录文件的变化类型
+const (
+	FileModified  = "modified"
+	FileAdded     = "added"
+	FileDeleted   = "deleted"
+	FileUntracked = "untracked"
+)
+
+// FileChange 是工作目录中一个有变化的文件（相对HEAD）
+type FileChange struct {
+	Path      string `json:"path"`   // 相对仓库根目录的路径
+	Status    string `json:"status"` // modified / added / deleted / untracked
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary,omitempty"`
+}
+
+// WorkspaceChanges 是Claude工作目录相对HEAD的变化
+type WorkspaceChanges struct {
+	Cwd       string       `json:"cwd"`
+	Root      string       `json:"root,omitempty"`   // git仓库根目录，不在仓库中时为空
+	Branch    string       `json:"branch,omitempty"` // 当前分支，分离HEAD时为空
+	Head      string       `json:"head,omitempty"`   // HEAD提交，新仓库尚无提交时为空
+	Files     []FileChange `json:"files"`
+	Diff      string       `json:"diff,omitempty"` // 统一格式diff，仅在 /api/workspace/changes 中返回
+	Truncated bool         `json:"truncated,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// WorkspaceEvent 是工作目录变化时推送的事件，不含diff内容
+type WorkspaceEvent struct {
+	Type      string           `json:"type"`
+	Workspace WorkspaceChanges `json:"workspace"`
+}
+
+// Checkpoint 是提交提示前工作目录的快照，保存在隐藏ref上，不改动HEAD和暂存区
+type Checkpoint struct {
+	ID        int       `json:"id"`
+	Commit    string    `json:"commit"`           // 快照提交
+	Head      string    `json:"head,omitempty"`   // 快照时的HEAD
+	Branch    string    `json:"branch,omitempty"` // 快照时的分支
+	Root      string    `json:"root"`             // git仓库根目录
+	Prompt    string    `json:"prompt"`           // 触发快照的提示（已脱敏）
+	Source    string    `json:"source"`           // 提示来源：console / web / api / queue ...
+	User      string    `json:"user,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CheckpointsEvent 是检查点列表变化时推送的事件
+type CheckpointsEvent struct {
+	Type        string       `json:"type"`
+	Checkpoints []Checkpoint `json:"checkpoints"`
+}
+
+// CheckpointDiff 是两个检查点之间（或检查点与当前工作目录之间）的diff
+type CheckpointDiff struct {
+	From      int    `json:"from"`
+	To        int    `json:"to"` // 0 表示当前工作目录
+	Diff      string `json:"diff"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// 会话worktree的状态
+const (
+	WorktreeActive  = "active"  // 会话使用中
+	WorktreeMerged  = "merged"  // 已合并回原分支并删除
+	WorktreeKept    = "kept"    // 会话结束后保留
+	WorktreeRemoved = "removed" // 已删除worktree和分支
+)
+
+// 会话结束时对worktree的处理
+const (
+	WorktreeMerge  = "merge"
+	WorktreeKeep   = "keep"
+	WorktreeDelete = "delete"
+)
+
+// Worktree 是为会话创建的git worktree，Claude在其中的独立分支上工作
+type Worktree struct {
+	Path       string     `json:"path"`                  // worktree目录
+	Branch     string     `json:"branch"`                // 新建的分支
+	Repo       string     `json:"repo"`                  // 主仓库根目录
+	Base       string     `json:"base"`                  // 创建时的HEAD提交
+	BaseBranch string     `json:"base_branch,omitempty"` // 创建时主仓库的分支，合并的目标
+	Cwd        string     `json:"cwd"`                   // Claude的工作目录（worktree中与profile.cwd对应的位置）
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// WorktreeRequest 会话结束时选择worktree的处理方式
+type WorktreeRequest struct {
+	Action string `json:"action"` // merge / keep / delete
+}
+
+// WorktreeEvent 是worktree状态变化时推送的事件
+type WorktreeEvent struct {
+	Type     string    `json:"type"`
+	Worktree *Worktree `json:"worktree"`
+}
+
+// 文件浏览中的条目类型
+const (
+	FileTypeDir     = "dir"
+	FileTypeFile    = "file"
+	FileTypeSymlink = "symlink" // 指向会话工作目录内的符号链接
+)
+
+// FileEntry 是目录列表中的一项
+type FileEntry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"` // 相对会话工作目录的路径
+	Type    string    `json:"type"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// FileListing 是 /api/files 对目录返回的列表，已排除 .gitignore 忽略的文件
+type FileListing struct {
+	Path      string      `json:"path"`
+	Entries   []FileEntry `json:"entries"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// FileContent 是 /api/files 对文件返回的内容
+type FileContent struct {
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	Content   string    `json:"content,omitempty"` // 文本内容（已脱敏），二进制文件为空
+	Binary    bool      `json:"binary,omitempty"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// 斜杠命令来源
+const (
+	CommandBuiltin = "builtin" // Claude内置命令
+	CommandProject = "project" // 会话工作目录下的 .claude/commands
+	CommandUser    = "user"    // ~/.claude/commands
+)
+
+// SlashCommand 是 /api/commands 返回的Claude斜杠命令
+type SlashCommand struct {
+	Name         string `json:"name"` // 不含前导 "/"
+	Description  string `json:"description,omitempty"`
+	ArgumentHint string `json:"argument_hint,omitempty"`
+	Source       string `json:"source"`
+	Namespace    string `json:"namespace,omitempty"` // 自定义命令所在的子目录
+}
+
+// ClaudeSession 记录Claude自身的会话ID，claudewarp重启后仍保留
+type ClaudeSession struct {
+	ID         string    `json:"id"`
+	Cwd        string    `json:"cwd"`
+	Transcript string    `json:"transcript,omitempty"`
+	Source     string    `json:"source"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ClaudeSessionEvent 是Claude会话ID变化时推送的事件
+type ClaudeSessionEvent struct {
+	Type    string         `json:"type"`
+	Session *ClaudeSession `json:"session"`
+}
+
+// ResumeRequest 是 POST /api/resume 的请求体
+type ResumeRequest struct {
+	SessionID string `json:"session_id,omitempty"` // 为空时使用记录的会话ID
+}
+
+// Screen 是 /api/screen 返回的屏幕快照（已去除ANSI转义序列并脱敏）
+type Screen struct {
+	Text   string    `json:"text"`
+	State  State     `json:"state"`
+	Offset int64     `json:"offset"` // 快照时输出流的末尾偏移
+	At     time.Time `json:"at"`
+}
+
+// Responder 是 /api/responders 返回的自动应答规则及其运行状态
+type Responder struct {
+	Name      string     `json:"name"`
+	Match     string     `json:"match,omitempty"`
+	Prompt    string     `json:"prompt,omitempty"`
+	Reply     string     `json:"reply,omitempty"`
+	Keys      []string   `json:"keys,omitempty"`
+	States    []State    `json:"states,omitempty"`
+	MaxFires  int        `json:"max_fires,omitempty"`
+	Cooldown  string     `json:"cooldown,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Enabled   bool       `json:"enabled"`
+	Expired   bool       `json:"expired"`
+	Fires     int        `json:"fires"`
+	LastFired *time.Time `json:"last_fired,omitempty"`
+}
+
+// RespondersEvent 自动应答规则状态变化事件
+type RespondersEvent struct {
+	Type       string      `json:"type"`
+	Responders []Responder `json:"responders"`
+}
+
+// 任务状态
+const (
+	TaskPending   = "pending"   // 排队中
+	TaskRunning   = "running"   // 已提交，等待Claude回到输入框
+	TaskDone      = "done"      // Claude已回到输入框
+	TaskFailed    = "failed"    // 输入被拒绝、会话退出或中断
+	TaskCancelled = "cancelled" // 被取消
+)
+
+// QueueItem 任务队列中的一条提示
+type QueueItem struct {
+	ID          string     `json:"id"`
+	Prompt      string     `json:"prompt"`
+	Status      string     `json:"status"`
+	AddedBy     string     `json:"added_by,omitempty"`
+	AddedAt     time.Time  `json:"added_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	StartOffset int64      `json:"start_offset"` // 提交时输出流的偏移
+	EndOffset   int64      `json:"end_offset"`   // 完成时输出流的偏移
+	Decision    string     `json:"decision,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+// Queue 是 /api/queue 返回的任务队列
+type Queue struct {
+	Paused  bool        `json:"paused"`
+	Items   []QueueItem `json:"items"`   // 运行中及排队中的任务
+	History []QueueItem `json:"history"` // 已结束的任务，最近的在前
+}
+
+// QueueEvent 任务队列变化事件
+type QueueEvent struct {
+	Type  string `json:"type"`
+	Queue Queue  `json:"queue"`
+}
+
+// QueueAdded 是追加任务时 POST /api/queue 的响应，在队列快照外附带新任务
+type QueueAdded struct {
+	Queue
+	Item *QueueItem `json:"item,omitempty"`
+}
+
+// 定时任务来源
+const (
+	ScheduleFromConfig = "config" // 配置文件中的 schedules
+	ScheduleFromAPI    = "api"    // 通过 /api/schedules 添加
+)
+
+// ScheduleJob 定时任务：按cron表达式重复或在指定时间执行一次
+type ScheduleJob struct {
+	Name      string     `json:"name"`
+	Cron      string     `json:"cron,omitempty"` // 5段cron表达式，与at二选一
+	At        *time.Time `json:"at,omitempty"`   // 一次性执行时间
+	Prompt    string     `json:"prompt"`
+	Session   string     `json:"session,omitempty"` // 目标会话名
+	Profile   string     `json:"profile,omitempty"` // 目标会话配置，没有运行中的会话时用它启动新会话
+	Origin    string     `json:"origin"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	Next      *time.Time `json:"next,omitempty"`     // 下次执行时间，一次性任务执行后为空
+	LastRun   *time.Time `json:"last_run,omitempty"` // 上次执行时间
+}
+
+// 定时任务执行结果
+const (
+	RunPending   = "pending"   // 已开始执行，手动执行的响应中使用
+	RunDelivered = "delivered" // 已加入目标会话的任务队列
+	RunFailed    = "failed"    // 找不到或无法启动目标会话等
+)
+
+// ScheduleRun 一次定时任务执行记录
+type ScheduleRun struct {
+	ID      string    `json:"id"`
+	Job     string    `json:"job"`
+	At      time.Time `json:"at"`
+	Session string    `json:"session,omitempty"` // 实际投递的会话
+	Started bool      `json:"started,omitempty"` // 是否为此新启动了会话
+	Status  string    `json:"status"`
+	ItemID  string    `json:"item_id,omitempty"` // 目标会话中的队列任务ID
+	Error   string    `json:"error,omitempty"`
+}
+
+// Schedules 是 /api/schedules 返回的定时任务及最近的执行记录
+type Schedules struct {
+	Leader bool          `json:"leader"` // 当前进程是否负责执行定时任务
+	Jobs   []ScheduleJob `json:"jobs"`
+	Runs   []ScheduleRun `json:"runs"` // 最近的在前
+}
+
+// SchedulesEvent 定时任务或执行记录变化事件
+type SchedulesEvent struct {
+	Type      string    `json:"type"`
+	Schedules Schedules `json:"schedules"`
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// queueHistoryLimit 保留的已结束任务数
+const queueHistoryLimit = 200
+
+// queueRequestLimit 添加任务请求体的最大字节数
+const queueRequestLimit = 64 << 10
+
+// QueueItem 任务队列中的一条提示
+type QueueItem = protocol.QueueItem
+
+// promptQueue 会话的FIFO任务队列，Claude回到输入框时提交下一条
+type promptQueue struct {
+	mu      sync.Mutex
+	path    string // 持久化文件，为空则不持久化
+	paused  bool
+	items   []*QueueItem // 运行中（最多一条，位于开头）及排队中的任务
+	history []*QueueItem // 已结束的任务，最近的在前
+	output  *os.File     // 运行中任务的输出文件
+}
+
+// queueFile 持久化格式
+type queueFile struct {
+	Paused  bool         `json:"paused"`
+	Items   []*QueueItem `json:"items"`
+	History []*QueueItem `json:"history"`
+}
+
+// openPromptQueue 加载持久化的任务队列，上次运行中的任务标记为中断
+func openPromptQueue(path string) (*promptQueue, error) {
+	q := &promptQueue{path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取任务队列失败: %v", err)
+	}
+
+	var f queueFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("解析任务队列失败（%s）: %v", path, err)
+	}
+	q.paused, q.history = f.Paused, f.History
+	for _, item := range f.Items {
+		if item.Status == protocol.TaskRunning {
+			now := time.Now()
+			item.Status, item.FinishedAt, item.Reason = protocol.TaskFailed, &now, "claudewarp重启时中断"
+			q.history = append([]*QueueItem{item}, q.history...)
+			continue
+		}
+		q.items = append(q.items, item)
+	}
+	return q, nil
+}
+
+// saveLocked 持久化队列，调用方需持有锁
+func (q *promptQueue) saveLocked() error {
+	if q.path == "" {
+		return nil
+	}
+	data, _ := json.MarshalIndent(queueFile{Paused: q.paused, Items: q.items, History: q.history}, "", "  ")
+	if err := os.MkdirAll(filepath.Dir(q.path), 0700); err != nil {
+		return fmt.Errorf("保存任务队列失败: %v", err)
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("保存任务队列失败: %v", err)
+	}
+	return os.Rename(tmp, q.path)
+}
+
+// outputPath 返回任务输出文件路径：<state-dir>/queue/<会话>.output/<任务ID>.log。
+// 共享的输出日志只保留最近1 MiB，整夜运行的任务输出需要单独保存
+func (q *promptQueue) outputPath(id string) string {
+	if q.path == "" {
+		return ""
+	}
+	return filepath.Join(strings.TrimSuffix(q.path, ".json")+".output", id+".log")
+}
+
+// openOutputLocked 为开始执行的任务创建输出文件，调用方需持有锁
+func (q *promptQueue) openOutputLocked(id string) {
+	q.closeOutputLocked()
+	path := q.outputPath(id)
+	if path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	q.output, _ = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+}
+
+// closeOutputLocked 关闭运行中任务的输出文件，调用方需持有锁
+func (q *promptQueue) closeOutputLocked() {
+	if q.output != nil {
+		q.output.Close()
+		q.output = nil
+	}
+}
+
+// captureOutput 把终端输出（已脱敏）追加到运行中任务的输出文件
+func (q *promptQueue) captureOutput(content string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.output != nil {
+		io.WriteString(q.output, content)
+	}
+}
+
+// readOutput 读取任务的输出文件
+func (q *promptQueue) readOutput(id string) ([]byte, error) {
+	path := q.outputPath(id)
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(path)
+}
+
+// add 追加任务
+func (q *promptQueue) add(prompt, by string) (QueueItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item := &QueueItem{
+		ID:      newInputID(),
+		Prompt:  prompt,
+		Status:  protocol.TaskPending,
+		AddedBy: by,
+		AddedAt: time.Now(),
+	}
+	q.items = append(q.items, item)
+	return *item, q.saveLocked()
+}
+
+// cancel 取消排队中的任务
+func (q *promptQueue) cancel(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, item := range q.items {
+		if item.ID != id {
+			continue
+		}
+		if item.Status != protocol.TaskPending {
+			return fmt.Errorf("任务已开始执行，无法取消")
+		}
+		now := time.Now()
+		item.Status, item.FinishedAt = protocol.TaskCancelled, &now
+		q.items = append(q.items[:i], q.items[i+1:]...)
+		q.pushHistoryLocked(item)
+		return q.saveLocked()
+	}
+	return errQueueItemNotFound
+}
+
+// errQueueItemNotFound 任务不存在
+var errQueueItemNotFound = fmt.Errorf("任务不存在或已结束")
+
+// move 把排队中的任务移动到排队任务中的position位置（从0开始）
+func (q *promptQueue) move(id string, position int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// 运行中的任务固定在开头，不参与排序
+	first := 0
+	if len(q.items) > 0 && q.items[0].Status == protocol.TaskRunning {
+		first = 1
+	}
+	pending := q.items[first:]
+	from := -1
+	for i, item := range pending {
+		if item.ID == id {
+			from = i
+		}
+	}
+	if from < 0 {
+		return errQueueItemNotFound
+	}
+	if position < 0 {
+		position = 0
+	}
+	if position >= len(pending) {
+		position = len(pending) - 1
+	}
+
+	item := pending[from]
+	pending = append(pending[:from], pending[from+1:]...)
+	pending = append(pending[:position], append([]*QueueItem{item}, pending[position:]...)...)
+	q.items = append(q.items[:first], pending...)
+	return q.saveLocked()
+}
+
+// setPaused 暂停或恢复队列，运行中的任务不受影响
+func (q *promptQueue) setPaused(paused bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.paused = paused
+	return q.saveLocked()
+}
+
+// next 在没有运行中的任务且未暂停时取出下一条并标记为运行中
+func (q *promptQueue) next(offset int64) *QueueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.paused || len(q.items) == 0 || q.items[0].Status != protocol.TaskPending {
+		return nil
+	}
+	item := q.items[0]
+	now := time.Now()
+	item.Status, item.StartedAt, item.StartOffset = protocol.TaskRunning, &now, offset
+	q.openOutputLocked(item.ID)
+	q.saveLocked()
+	copied := *item
+	return &copied
+}
+
+// running 返回运行中的任务，没有时返回nil
+func (q *promptQueue) running() *QueueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) > 0 && q.items[0].Status == protocol.TaskRunning {
+		copied := *q.items[0]
+		return &copied
+	}
+	return nil
+}
+
+// finish 结束运行中的任务，返回是否有任务被结束
+func (q *promptQueue) finish(id, status string, offset int64, reason string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 || q.items[0].ID != id || q.items[0].Status != protocol.TaskRunning {
+		return false
+	}
+	item := q.items[0]
+	now := time.Now()
+	item.Status, item.FinishedAt, item.EndOffset = status, &now, offset
+	if reason != "" {
+		item.Reason = reason
+	}
+	q.items = q.items[1:]
+	q.closeOutputLocked()
+	q.pushHistoryLocked(item)
+	q.saveLocked()
+	return true
+}
+
+// setDecision 记录运行中任务的策略决策
+func (q *promptQueue) setDecision(id, decision string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) > 0 && q.items[0].ID == id {
+		q.items[0].Decision = decision
+		q.saveLocked()
+	}
+}
+
+func (q *promptQueue) pushHistoryLocked(item *QueueItem) {
+	q.history = append([]*QueueItem{item}, q.history...)
+	if len(q.history) > queueHistoryLimit {
+		for _, old := range q.history[queueHistoryLimit:] {
+			if path := q.outputPath(old.ID); path != "" {
+				os.Remove(path)
+			}
+		}
+		q.history = q.history[:queueHistoryLimit]
+	}
+}
+
+// find 按ID查找任务
+func (q *promptQueue) find(id string) (QueueItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, list := range [][]*QueueItem{q.items, q.history} {
+		for _, item := range list {
+			if item.ID == id {
+				return *item, true
+			}
+		}
+	}
+	return QueueItem{}, false
+}
+
+// snapshot 返回队列快照
+func (q *promptQueue) snapshot() protocol.Queue {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	view := protocol.Queue{
+		Paused:  q.paused,
+		Items:   make([]QueueItem, len(q.items)),
+		History: make([]QueueItem, len(q.history)),
+	}
+	for i, item := range q.items {
+		view.Items[i] = *item
+	}
+	for i, item := range q.history {
+		view.History[i] = *item
+	}
+	return view
+}
+
+// advanceQueue 会话空闲时结束运行中的任务并提交下一条
+func (w *ClaudeWarp) advanceQueue(state SessionState) {
+	switch state {
+	case StateIdle:
+		if item := w.queue.running(); item != nil {
+			// 提交后还没有任何输出时，空闲状态来自提交之前，任务尚未开始处理
+			if !w.tracker.LastOutput().After(*item.StartedAt) {
+				return
+			}
+			w.queue.finish(item.ID, protocol.TaskDone, w.output.End(), "")
+			w.broadcastQueue()
+		}
+	case StateExited:
+		if item := w.queue.running(); item != nil {
+			w.queue.finish(item.ID, protocol.TaskFailed, w.output.End(), "会话已退出")
+			w.broadcastQueue()
+		}
+		return
+	default:
+		return
+	}
+
+	item := w.queue.next(w.output.End())
+	if item == nil {
+		return
+	}
+	w.addMessage("output", fmt.Sprintf("📋 开始执行队列任务 %s", item.ID))
+	in := WebInput{
+		Content:    item.Prompt,
+		AddNewline: true,
+		Source:     SourceQueue,
+		Transport:  SourceQueue,
+		User:       item.AddedBy,
+		Role:       RoleController,
+		ID:         item.ID,
+	}
+	select {
+	case w.inputChan <- in:
+	default:
+		w.metrics.inputRejected.Add(1)
+		w.queue.finish(item.ID, protocol.TaskFailed, w.output.End(), "输入队列已满")
+	}
+	w.broadcastQueue()
+}
+
+// queueDecision 根据策略决策更新运行中的队列任务
+func (w *ClaudeWarp) queueDecision(in WebInput, decision InputDecision) {
+	if in.Source != SourceQueue {
+		return
+	}
+	if item := w.queue.running(); item == nil || item.ID != in.ID {
+		return
+	}
+	w.queue.setDecision(in.ID, decision.Decision)
+	switch decision.Decision {
+	case DecisionDenied, DecisionRejected, DecisionExpired:
+		reason := decision.Reason
+		if reason == "" {
+			reason = "输入未被允许"
+		}
+		w.queue.finish(in.ID, protocol.TaskFailed, w.output.End(), reason)
+		// 被拒绝的任务不会产生输出，直接尝试下一条
+		state, _ := w.tracker.Current()
+		go w.advanceQueue(state)
+	}
+	w.broadcastQueue()
+}
+
+// broadcastQueue 广播任务队列
+func (w *ClaudeWarp) broadcastQueue() {
+	w.broadcastEvent(protocol.QueueEvent{Type: protocol.EventQueue, Queue: w.queue.snapshot()})
+}
+
+// handleQueue 处理任务队列API：
+//
+//	GET  /api/queue                 队列及历史
+//	POST /api/queue                 {"prompt": "..."} 追加任务，响应附带新任务
+//	POST /api/queue/pause|resume    暂停/恢复
+//	POST /api/queue/{id}/cancel     取消排队中的任务
+//	POST /api/queue/{id}/move       {"position": n} 调整顺序
+//	GET  /api/queue/{id}/output     任务期间的终端输出
+func (w *ClaudeWarp) handleQueue(wr http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/queue"), "/")
+	if r.Method == "GET" {
+		w.handleQueueGet(wr, r, rest)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(wr, "仅支持GET和POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := w.requireController(wr, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	var added QueueItem
+	id, action, _ := strings.Cut(rest, "/")
+	switch {
+	case rest == "":
+		var req struct {
+			Prompt string `json:"prompt"`
+		}
+		decodeErr := json.NewDecoder(http.MaxBytesReader(wr, r.Body, queueRequestLimit)).Decode(&req)
+		var tooLarge *http.MaxBytesError
+		if errors.As(decodeErr, &tooLarge) {
+			http.Error(wr, fmt.Sprintf("请求体超过 %d 字节", queueRequestLimit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if decodeErr != nil || strings.TrimSpace(req.Prompt) == "" {
+			http.Error(wr, "需要JSON请求体 {\"prompt\": \"...\"}", http.StatusBadRequest)
+			return
+		}
+		if added, err = w.queue.add(req.Prompt, requestIdentity(user, r.RemoteAddr)); err == nil {
+			w.addMessage("output", fmt.Sprintf("📋 %s 添加了队列任务 %s", added.AddedBy, added.ID))
+		}
+	case rest == "pause" || rest == "resume":
+		err = w.queue.setPaused(rest == "pause")
+	case action == "cancel":
+		err = w.queue.cancel(id)
+	case action == "move":
+		var req struct {
+			Position int `json:"position"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&req); err != nil {
+			http.Error(wr, "需要JSON请求体 {\"position\": n}", http.StatusBadRequest)
+			return
+		}
+		err = w.queue.move(id, req.Position)
+	default:
+		http.NotFound(wr, r)
+		return
+	}
+	if err == errQueueItemNotFound {
+		http.Error(wr, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(wr, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.broadcastQueue()
+	// 新任务或恢复队列时，会话若已空闲则立即提交
+	if state, _ := w.tracker.Current(); state == StateIdle {
+		w.advanceQueue(state)
+	}
+
+	resp := protocol.QueueAdded{Queue: w.queue.snapshot()}
+	if added.ID != "" {
+		resp.Item = &added
+		// 队列推进后任务可能已开始执行
+		if item, ok := w.queue.find(added.ID); ok {
+			resp.Item = &item
+		}
+	}
+	data, _ := json.Marshal(resp)
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
+
+// handleQueueGet 返回队列或任务输出
+func (w *ClaudeWarp) handleQueueGet(wr http.ResponseWriter, r *http.Request, rest string) {
+	if rest == "" {
+		data, _ := json.Marshal(w.queue.snapshot())
+		wr.Header().Set("Content-Type", "application/json")
+		wr.Write(data)
+		return
+	}
+
+	id, action, _ := strings.Cut(rest, "/")
+	if action != "output" {
+		http.NotFound(wr, r)
+		return
+	}
+	item, ok := w.queue.find(id)
+	if !ok || item.StartedAt == nil {
+		http.Error(wr, "任务不存在或尚未开始", http.StatusNotFound)
+		return
+	}
+	if data, err := w.queue.readOutput(id); err == nil {
+		wr.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		wr.Write(data)
+		return
+	}
+
+	// 没有输出文件（未持久化队列）时从共享输出日志截取，偏移只在本次运行内有效
+	if item.StartedAt.Before(w.metrics.startTime) {
+		http.Error(wr, "任务在claudewarp重启前执行，输出已不可用", http.StatusGone)
+		return
+	}
+	end := item.EndOffset
+	if item.Status == protocol.TaskRunning {
+		end = w.output.End()
+	}
+	content, complete := w.output.Range(item.StartOffset, end)
+	if !complete {
+		http.Error(wr, "任务输出已超出内存中保留的范围", http.StatusGone)
+		return
+	}
+	wr.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(wr, content)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleQueueAddBodyLimit(t *testing.T) {
+	w := &ClaudeWarp{cfg: defaultConfig()}
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"too large", `{"prompt": "` + strings.Repeat("x", queueRequestLimit) + `"}`, http.StatusRequestEntityTooLarge},
+		{"invalid json", `{"prompt": `, http.StatusBadRequest},
+		{"empty prompt", `{"prompt": "  "}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			w.handleQueue(rec, httptest.NewRequest("POST", "/api/queue", strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// RateLimitConfig 用量限制处理配置（支持SIGHUP热加载）
+type RateLimitConfig struct {
+	ResumePrompt string   `json:"resume_prompt"` // 重置后自动发送的提示，为空则只恢复状态不发送
+	Grace        Duration `json:"grace"`         // 重置时间之后再等待多久，默认1m
+	Fallback     Duration `json:"fallback"`      // 无法解析重置时间时等待多久，默认1h
+}
+
+// validate 校验用量限制配置
+func (c RateLimitConfig) validate() []error {
+	var errs []error
+	if c.Grace.Duration < 0 {
+		errs = append(errs, fmt.Errorf("rate_limit.grace 不能为负数"))
+	}
+	if c.Fallback.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("rate_limit.fallback 必须大于0"))
+	}
+	return errs
+}
+
+// Claude用量限制提示，如：
+//
+//	Claude AI usage limit reached|1760000000
+//	Claude usage limit reached. Your limit will reset at 3pm (America/New_York).
+//	5-hour limit reached ∙ resets 3pm
+//	You've hit your weekly limit · resets Oct 20, 9am (Europe/London)
+//
+// 提示需从行首开始（允许Claude的边框和项目符号），避免匹配正文或文件内容中的同样文字
+var (
+	rateLimitEpochPattern = regexp.MustCompile(`^[\s│⎿●⏺•]*Claude(?: AI)? usage limit reached\|(\d{10})`)
+	rateLimitPattern      = regexp.MustCompile(`(?i)^[\s│⎿●⏺•]*(?:claude(?: ai)? usage limit reached|(?:[\w-]+ )?limit reached|you've hit your (?:\w+ )?limit)[^\n]{0,80}reset`)
+	rateLimitResetPattern = regexp.MustCompile(`(?i)resets?\s+(?:at\s+)?` +
+		`(?:(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?\s+(\d{1,2}),?\s+(?:at\s+)?)?` +
+		`(\d{1,2})(?::(\d{2}))?\s*(am|pm)?(?:\s*\(([^)]+)\))?`)
+	// rateLimitPromptPattern 输入框所在行
+	rateLimitPromptPattern = regexp.MustCompile(`^\s*│?\s*>`)
+)
+
+// rateLimitRows 用量限制提示须出现在屏幕底部的这么多个非空行内
+const rateLimitRows = 6
+
+var monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+// parseRateLimit 在屏幕底部的状态行中查找用量限制提示，返回是否找到及重置时间（无法解析时为零值）。
+// 提示之后又出现输入框说明Claude已回到可输入状态，不视为受限
+func parseRateLimit(text string, now time.Time) (bool, time.Time) {
+	rows := bottomRows(text, rateLimitRows)
+	for i := len(rows) - 1; i >= 0; i-- {
+		row := rows[i]
+		if rateLimitPromptPattern.MatchString(row) {
+			return false, time.Time{}
+		}
+		if m := rateLimitEpochPattern.FindStringSubmatch(row); m != nil {
+			sec, _ := strconv.ParseInt(m[1], 10, 64)
+			return true, time.Unix(sec, 0)
+		}
+		if rateLimitPattern.MatchString(row) {
+			return true, parseResetTime(row, now)
+		}
+	}
+	return false, time.Time{}
+}
+
+// bottomRows 返回文本最后n个非空行
+func bottomRows(text string, n int) []string {
+	var rows []string
+	for len(text) > 0 && len(rows) < n {
+		line := text
+		if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+			line, text = text[i+1:], text[:i]
+		} else {
+			text = ""
+		}
+		if strings.TrimSpace(strings.Trim(line, "│─╭╮╰╯ ")) != "" {
+			rows = append(rows, line)
+		}
+	}
+	// 还原为从上到下的顺序
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+	return rows
+}
+
+// parseResetTime 解析 "resets 3pm (Europe/London)"、"reset at 10:30pm"、"resets Oct 20, 9am" 等，
+// 只有时刻时取now之后最近的一次
+func parseResetTime(line string, now time.Time) time.Time {
+	m := rateLimitResetPattern.FindStringSubmatch(line)
+	// 必须带am/pm或分钟，避免把普通数字当作时间
+	if m == nil || (m[4] == "" && m[5] == "") {
+		return time.Time{}
+	}
+	hour, _ := strconv.Atoi(m[3])
+	minute, _ := strconv.Atoi(m[4])
+	switch strings.ToLower(m[5]) {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return time.Time{}
+	}
+
+	loc := now.Location()
+	if m[6] != "" {
+		if l, err := time.LoadLocation(strings.TrimSpace(m[6])); err == nil {
+			loc = l
+		}
+	}
+	now = now.In(loc)
+
+	if m[1] != "" {
+		month := time.Month(1)
+		for i, name := range monthNames {
+			if strings.EqualFold(m[1], name) {
+				month = time.Month(i + 1)
+			}
+		}
+		day, _ := strconv.Atoi(m[2])
+		t := time.Date(now.Year(), month, day, hour, minute, 0, 0, loc)
+		// 跨年：12月底看到 "resets Jan 2"
+		if t.Before(now.AddDate(0, -1, 0)) {
+			t = t.AddDate(1, 0, 0)
+		}
+		return t
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, loc)
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// onRateLimit 处理进入和离开 rate_limited 状态：记录消息、通知，并在重置后自动继续
+func (w *ClaudeWarp) onRateLimit(from, to SessionState, since time.Time) {
+	switch {
+	case to == StateRateLimited:
+		resetAt := w.tracker.ResetAt()
+		w.addMessage("output", fmt.Sprintf("⏳ Claude用量已达上限，将于 %s 重置", resetAt.Local().Format("2006-01-02 15:04")))
+		w.notifier.notifyRateLimit(true, resetAt)
+		go w.resumeAfterReset(since, resetAt)
+	case from == StateRateLimited:
+		w.addMessage("output", "▶️ 用量限制已解除")
+		w.notifier.notifyRateLimit(false, time.Time{})
+	}
+}
+
+// resumeAfterReset 等到重置时间后发送继续提示，期间状态已变化（如手动输入）则放弃
+func (w *ClaudeWarp) resumeAfterReset(since, resetAt time.Time) {
+	time.Sleep(time.Until(resetAt) + w.config().RateLimit.Grace.Duration)
+	if state, s := w.tracker.Current(); state != StateRateLimited || !s.Equal(since) {
+		return
+	}
+
+	prompt := w.config().RateLimit.ResumePrompt
+	if prompt != "" {
+		in := WebInput{
+			Content:    prompt,
+			AddNewline: true,
+			Source:     SourceRateLimit,
+			Transport:  SourceRateLimit,
+			Role:       RoleController,
+			ID:         newInputID(),
+		}
+		select {
+		case w.inputChan <- in:
+		default:
+			w.metrics.inputRejected.Add(1)
+			w.addMessage("error", "用量限制已重置，但输入队列已满，未能发送继续提示")
+		}
+	}
+	w.tracker.endRateLimit()
+}
+
+// rateLimitView 返回状态事件中附带的重置时间，不在 rate_limited 状态时为nil
+func (w *ClaudeWarp) rateLimitView(state SessionState) *time.Time {
+	if state != protocol.StateRateLimited {
+		return nil
+	}
+	resetAt := w.tracker.ResetAt()
+	return &resetAt
+}
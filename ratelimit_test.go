@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip("缺少时区数据:", err)
+	}
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		text      string
+		wantFound bool
+		wantReset time.Time
+	}{
+		{
+			name:      "epoch",
+			text:      "⏺ working\nClaude AI usage limit reached|1760000000\n",
+			wantFound: true,
+			wantReset: time.Unix(1760000000, 0),
+		},
+		{
+			name:      "reset at time with zone",
+			text:      "  ⎿  Claude usage limit reached. Your limit will reset at 3pm (Europe/London).\n",
+			wantFound: true,
+			wantReset: time.Date(2026, 10, 19, 15, 0, 0, 0, london),
+		},
+		{
+			name:      "hour limit, time already passed today",
+			text:      "5-hour limit reached ∙ resets 9am\n",
+			wantFound: true,
+			wantReset: time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "weekly limit with date",
+			text:      "You've hit your weekly limit · resets Oct 21, 9:30am (Europe/London)\n",
+			wantFound: true,
+			wantReset: time.Date(2026, 10, 21, 9, 30, 0, 0, london),
+		},
+		{
+			name:      "unparseable reset time",
+			text:      "Claude usage limit reached, resets soon\n",
+			wantFound: true,
+		},
+		{
+			name: "mentioned in prose",
+			text: "The docs say: when the usage limit reached message appears it resets at 3pm\n",
+		},
+		{
+			name: "followed by input prompt",
+			text: "Claude usage limit reached. Your limit will reset at 3pm.\n│ > continue please │\n",
+		},
+		{
+			name: "scrolled out of the status rows",
+			text: "Claude usage limit reached. Your limit will reset at 3pm.\n1\n2\n3\n4\n5\n6\n",
+		},
+		{
+			name: "no limit",
+			text: "⏺ Done.\n? for shortcuts\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, reset := parseRateLimit(tt.text, now)
+			if found != tt.wantFound {
+				t.Fatalf("found = %v, want %v", found, tt.wantFound)
+			}
+			if !reset.Equal(tt.wantReset) {
+				t.Errorf("reset = %v, want %v", reset, tt.wantReset)
+			}
+		})
+	}
+}
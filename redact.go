@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// redactedMark 替换敏感信息的占位符
+const redactedMark = "[REDACTED]"
+
+// redactRule 单条脱敏规则
+type redactRule struct {
+	name string
+	re   *regexp.Regexp
+	repl string
+}
+
+// 内置脱敏规则
+var builtinRedactRules = []redactRule{
+	{
+		name: "private-key",
+		re:   regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+		repl: redactedMark,
+	},
+	{
+		name: "proxy-userinfo",
+		re:   regexp.MustCompile(`(?i)\b([a-z][a-z0-9+.\-]*://)[^/\s:@]+(:[^/\s@]*)?@`),
+		repl: "${1}" + redactedMark + "@",
+	},
+	{
+		name: "anthropic-key",
+		re:   regexp.MustCompile(`sk-ant-[A-Za-z0-9_\-]{20,}`),
+		repl: redactedMark,
+	},
+	{
+		name: "aws-access-key",
+		re:   regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+		repl: redactedMark,
+	},
+	{
+		name: "aws-secret-key",
+		re:   regexp.MustCompile(`(?i)(aws_secret_access_key\s*[=:]\s*["']?)[A-Za-z0-9/+=]{40}`),
+		repl: "${1}" + redactedMark,
+	},
+	{
+		name: "github-token",
+		re:   regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`),
+		repl: redactedMark,
+	},
+}
+
+var (
+	privateKeyBegin = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)
+	privateKeyEnd   = regexp.MustCompile(`-----END [A-Z ]*PRIVATE KEY-----`)
+)
+
+// redactor 对离开进程的内容（Web帧、消息历史等）进行脱敏，本地控制台不经过它
+type redactor struct {
+	mu    sync.RWMutex
+	rules []redactRule
+}
+
+// newRedactor 创建脱敏器，custom为用户自定义正则
+func newRedactor(custom []string) (*redactor, error) {
+	r := &redactor{}
+	if err := r.SetCustom(custom); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetCustom 替换用户自定义规则，内置规则始终生效
+func (r *redactor) SetCustom(custom []string) error {
+	rules := append([]redactRule(nil), builtinRedactRules...)
+	for _, expr := range custom {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("无效的脱敏正则 %q: %v", expr, err)
+		}
+		rules = append(rules, redactRule{name: "custom", re: re, repl: redactedMark})
+	}
+
+	r.mu.Lock()
+	r.rules = rules
+	r.mu.Unlock()
+	return nil
+}
+
+// Redact 对一段完整文本脱敏
+func (r *redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, rule := range r.rules {
+		s = rule.re.ReplaceAllString(s, rule.repl)
+	}
+	return s
+}
+
+// redactTerminal 对含ANSI转义序列的终端输出脱敏：在去除转义序列后的文本上匹配，
+// 被转义序列（如逐段着色）打断的敏感信息也能识别。匹配范围内的转义序列保留在占位符之后，
+// 终端状态不受影响。raw必须从转义序列之外开始
+func (r *redactor) redactTerminal(raw []byte) string {
+	text := stripTerminal(raw)
+
+	r.mu.RLock()
+	var matches []redactMatch
+	for _, rule := range r.rules {
+		for _, loc := range rule.re.FindAllSubmatchIndex(text.plain, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			repl := rule.re.Expand(nil, []byte(rule.repl), text.plain, loc)
+			matches = append(matches, redactMatch{start: loc[0], end: loc[1], repl: repl})
+		}
+	}
+	r.mu.RUnlock()
+	if len(matches) == 0 {
+		return string(raw)
+	}
+
+	// 不同规则的匹配可能重叠，按位置保留先出现（同位置取较长）的匹配
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].end > matches[j].end
+	})
+
+	var out strings.Builder
+	rawPos, plainPos := 0, 0
+	for _, m := range matches {
+		if m.start < plainPos {
+			continue
+		}
+		start, end := text.unitStart(m.start), text.unitStart(m.end)
+		out.Write(raw[rawPos:start])
+		out.Write(m.repl)
+		for i := start; i < end; i++ {
+			if !text.isText[i] {
+				out.WriteByte(raw[i])
+			}
+		}
+		rawPos, plainPos = end, m.end
+	}
+	out.Write(raw[rawPos:])
+	return out.String()
+}
+
+// redactMatch 纯文本中的一处匹配及其替换内容
+type redactMatch struct {
+	start, end int
+	repl       []byte
+}
+
+// terminalText 终端输出去除转义序列后的纯文本，及纯文本与原始字节的对应关系
+type terminalText struct {
+	plain  []byte
+	idx    []int  // plain[i] 对应（或产生它的转义序列末字节）在原始输出中的下标
+	isText []bool // 原始字节是否原样出现在纯文本中
+	open   bool   // 是否停在未结束的转义序列中
+}
+
+// stripTerminal 从转义序列之外开始解析终端输出
+func stripTerminal(raw []byte) terminalText {
+	t := terminalText{isText: make([]bool, len(raw))}
+	var stripper protocol.TextStripper
+	stripper.Strip(raw, func(b byte, i int) {
+		t.plain = append(t.plain, b)
+		t.idx = append(t.idx, i)
+		if raw[i] == b {
+			t.isText[i] = true
+		}
+	})
+	t.open = stripper.InSequence()
+	return t
+}
+
+// unitStart 返回纯文本位置p在原始输出中的切分点：第p-1个纯文本字节之后。
+// p之前的转义序列归入p所在的部分，切分点总在转义序列之外
+func (t terminalText) unitStart(p int) int {
+	if p == 0 {
+		return 0
+	}
+	return t.idx[p-1] + 1
+}
+
+// 流式脱敏参数
+const (
+	redactHoldLimit    = 1024                  // 为跨块匹配最多保留的未完成行（纯文本字节）
+	redactTokenLimit   = 256                   // 保留部分超长时，向前补齐被截断的token最多的字节数
+	redactFlushDelay   = 20 * time.Millisecond // 输出暂停多久后补发保留的尾部
+	privateKeyMaxBytes = 16 << 10              // 私钥块最多隐藏的纯文本字节数，防止无结束标记时隐藏全部输出
+)
+
+// streamRedactor 对分块到达的PTY输出脱敏。末尾未完成的行暂不输出，与下一块拼接后再匹配，
+// 跨块的token和私钥标记不会漏掉；输出暂停redactFlushDelay后补发，交互回显不会卡住
+type streamRedactor struct {
+	r    *redactor
+	emit func(string) // 输出脱敏后的内容，在mu内调用以保证顺序
+
+	mu        sync.Mutex
+	pending   []byte      // 暂未输出的尾部（原始字节）
+	inKey     bool        // 是否处于未结束的私钥块中
+	keyHidden int         // 当前私钥块已隐藏的纯文本字节数
+	timer     *time.Timer // 补发pending的定时器
+}
+
+// newStreamRedactor 创建流式脱敏器
+func newStreamRedactor(r *redactor, emit func(string)) *streamRedactor {
+	return &streamRedactor{r: r, emit: emit}
+}
+
+// Write 对一个输出块脱敏后输出，可能与下一块组成敏感信息的尾部留到之后输出
+func (s *streamRedactor) Write(chunk []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := append(s.pending, chunk...)
+	text := stripTerminal(buf)
+	cut := len(buf)
+	if hold := holdPoint(text.plain); hold < len(text.plain) || text.open {
+		cut = text.unitStart(hold)
+	}
+	s.pending = append([]byte(nil), buf[cut:]...)
+	s.output(buf[:cut])
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if len(s.pending) > 0 {
+		s.timer = time.AfterFunc(redactFlushDelay, s.flush)
+	}
+}
+
+// flush 输出暂停后补发保留的尾部
+func (s *streamRedactor) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := s.pending
+	s.pending = nil
+	s.output(buf)
+}
+
+// output 脱敏并输出一段完整内容（起止都在转义序列之外），调用方需持有mu
+func (s *streamRedactor) output(raw []byte) {
+	if out := s.redactSegment(raw); out != "" {
+		s.emit(out)
+	}
+}
+
+// redactSegment 隐藏私钥块并对其余内容按规则脱敏
+func (s *streamRedactor) redactSegment(raw []byte) string {
+	text := stripTerminal(raw)
+	var out strings.Builder
+	pos := 0 // 已处理到的纯文本位置
+	for {
+		if s.inKey {
+			limit := len(text.plain)
+			if rest := privateKeyMaxBytes - s.keyHidden; pos+rest < limit {
+				limit = pos + rest
+			}
+			next := limit
+			end := privateKeyEnd.FindIndex(text.plain[pos:limit])
+			if end != nil {
+				next = pos + end[1]
+			}
+			s.keyHidden += next - pos
+			pos = next
+			if end == nil && s.keyHidden < privateKeyMaxBytes {
+				return out.String() // 私钥块在本段中未结束
+			}
+			s.inKey, s.keyHidden = false, 0
+			continue
+		}
+
+		rawPos := text.unitStart(pos)
+		begin := privateKeyBegin.FindIndex(text.plain[pos:])
+		if begin == nil {
+			out.WriteString(s.r.redactTerminal(raw[rawPos:]))
+			return out.String()
+		}
+		out.WriteString(s.r.redactTerminal(raw[rawPos:text.unitStart(pos+begin[0])]))
+		out.WriteString(redactedMark)
+		pos += begin[1]
+		s.inKey, s.keyHidden = true, 0
+	}
+}
+
+// holdPoint 返回需要保留到下一块的纯文本起点：最后一个未完成的行，
+// 超过redactHoldLimit时只保留末尾部分，并向前补齐被截断的token
+func holdPoint(plain []byte) int {
+	start := bytes.LastIndexByte(plain, '\n') + 1
+	if len(plain)-start > redactHoldLimit {
+		start = len(plain) - redactHoldLimit
+		floor := start - redactTokenLimit
+		for start > 0 && start > floor && isTokenByte(plain[start-1]) {
+			start--
+		}
+	}
+	return start
+}
+
+// isTokenByte 判断字节是否可能是密钥、token或URL凭据的一部分
+func isTokenByte(b byte) bool {
+	switch {
+	case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9':
+		return true
+	}
+	return strings.IndexByte("-_./+=:@%~", b) >= 0
+}
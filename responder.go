@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// 自动应答的时间参数
+const (
+	responderInterval        = 250 * time.Millisecond // 规则检查间隔
+	responderSettle          = 500 * time.Millisecond // 输出静默多久后才检查，避免在提示绘制一半时应答
+	defaultResponderCooldown = 5 * time.Second
+)
+
+// ResponderRule 自动应答规则：屏幕文本匹配或检测到提示时自动回复（支持SIGHUP热加载）
+type ResponderRule struct {
+	Name         string         `json:"name"`
+	Match        string         `json:"match,omitempty"`     // 屏幕文本正则（已去除ANSI转义序列）
+	Prompt       string         `json:"prompt,omitempty"`    // input / approval：检测到对应提示时触发
+	Reply        string         `json:"reply,omitempty"`     // 回复文本，原样写入
+	Keys         []string       `json:"keys,omitempty"`      // 回复文本之后发送的按键，如 ["enter"]
+	States       []SessionState `json:"states,omitempty"`    // 仅在这些状态下触发
+	MaxFires     int            `json:"max_fires,omitempty"` // 最多触发次数，0表示不限
+	Cooldown     Duration       `json:"cooldown"`            // 两次触发的最小间隔，默认5s
+	ExpiresAfter Duration       `json:"expires_after"`       // 会话启动（或规则加入）多久后失效，0表示不失效
+	Disabled     bool           `json:"disabled,omitempty"`  // 初始禁用，可在Web界面启用
+}
+
+// validateResponders 校验自动应答规则
+func validateResponders(rules []ResponderRule) []error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			errs = append(errs, fmt.Errorf("responders[#%d].name 不能为空", i+1))
+			name = fmt.Sprintf("#%d", i+1)
+		} else if seen[name] {
+			errs = append(errs, fmt.Errorf("responders[%s] 名称重复", name))
+		}
+		seen[name] = true
+
+		if rule.Match == "" && rule.Prompt == "" {
+			errs = append(errs, fmt.Errorf("responders[%s] 需要设置 match 或 prompt", name))
+		}
+		if _, err := regexp.Compile(rule.Match); err != nil {
+			errs = append(errs, fmt.Errorf("responders[%s].match 无效: %v", name, err))
+		}
+		if rule.Prompt != "" && rule.Prompt != protocol.PromptInput && rule.Prompt != protocol.PromptApproval {
+			errs = append(errs, fmt.Errorf("responders[%s].prompt 必须是 input 或 approval", name))
+		}
+		if rule.Reply == "" && len(rule.Keys) == 0 {
+			errs = append(errs, fmt.Errorf("responders[%s] 需要设置 reply 或 keys", name))
+		}
+		for _, key := range rule.Keys {
+			if _, err := protocol.KeySequence(key); err != nil {
+				errs = append(errs, fmt.Errorf("responders[%s].keys: %v", name, err))
+			}
+		}
+		if rule.MaxFires < 0 || rule.Cooldown.Duration < 0 || rule.ExpiresAfter.Duration < 0 {
+			errs = append(errs, fmt.Errorf("responders[%s] 的 max_fires、cooldown、expires_after 不能为负数", name))
+		}
+	}
+	return errs
+}
+
+// responderState 规则及其运行状态
+type responderState struct {
+	rule        ResponderRule
+	re          *regexp.Regexp
+	reply       string // 回复文本加按键序列
+	enabled     bool
+	fires       int
+	lastFired   time.Time
+	expiresAt   time.Time
+	seen        int64     // 已应答过的屏幕文本位置，-1表示下次检查时从当前位置开始
+	promptSince time.Time // 已应答过的提示对应的状态进入时间
+}
+
+// responderFire 一次规则触发
+type responderFire struct {
+	Name  string
+	Reply string
+	Fires int
+}
+
+// responders 自动应答引擎
+type responders struct {
+	mu     sync.Mutex
+	rules  []*responderState
+	loaded bool // 已加载过规则，之后新增的规则不匹配加入前的文本
+}
+
+// newResponders 创建自动应答引擎
+func newResponders(rules []ResponderRule) (*responders, error) {
+	r := &responders{}
+	if err := r.update(rules); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// update 应用新的规则，同名规则保留启用状态、触发次数和失效时间
+func (r *responders) update(rules []ResponderRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := make(map[string]*responderState, len(r.rules))
+	for _, st := range r.rules {
+		old[st.rule.Name] = st
+	}
+
+	states := make([]*responderState, 0, len(rules))
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return fmt.Errorf("自动应答规则 %q 的正则无效: %v", rule.Name, err)
+		}
+		reply := rule.Reply
+		for _, key := range rule.Keys {
+			seq, err := protocol.KeySequence(key)
+			if err != nil {
+				return fmt.Errorf("自动应答规则 %q: %v", rule.Name, err)
+			}
+			reply += seq
+		}
+		if rule.Cooldown.Duration == 0 {
+			rule.Cooldown.Duration = defaultResponderCooldown
+		}
+
+		st := &responderState{rule: rule, re: re, reply: reply, enabled: !rule.Disabled}
+		if r.loaded {
+			st.seen = -1
+		}
+		if prev, ok := old[rule.Name]; ok {
+			st.enabled, st.fires, st.lastFired = prev.enabled, prev.fires, prev.lastFired
+			st.seen, st.promptSince = prev.seen, prev.promptSince
+			if prev.rule.ExpiresAfter == rule.ExpiresAfter {
+				st.expiresAt = prev.expiresAt
+			}
+		}
+		if st.expiresAt.IsZero() && rule.ExpiresAfter.Duration > 0 {
+			st.expiresAt = time.Now().Add(rule.ExpiresAfter.Duration)
+		}
+		states = append(states, st)
+	}
+	r.rules = states
+	r.loaded = true
+	return nil
+}
+
+// setEnabled 启用或禁用规则，返回规则是否存在
+func (r *responders) setEnabled(name string, enabled bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, st := range r.rules {
+		if st.rule.Name == name {
+			if enabled && !st.enabled {
+				// 重新启用时忽略禁用期间已经出现的文本
+				st.seen = -1
+			}
+			st.enabled = enabled
+			return true
+		}
+	}
+	return false
+}
+
+// check 根据屏幕内容和会话状态返回需要触发的规则
+func (r *responders) check(screen *screenBuffer, state SessionState, since, lastOutput time.Time) []responderFire {
+	now := time.Now()
+	if state == StateExited || now.Sub(lastOutput) < responderSettle {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var fires []responderFire
+	total := screen.Total()
+	for _, st := range r.rules {
+		if st.seen < 0 {
+			st.seen = total
+		}
+		rule := st.rule
+		if !st.enabled || st.exhausted(now) {
+			continue
+		}
+		if len(rule.States) > 0 && !containsState(rule.States, state) {
+			continue
+		}
+		if !st.lastFired.IsZero() && now.Sub(st.lastFired) < rule.Cooldown.Duration {
+			continue
+		}
+
+		// 只匹配上次触发之后出现的文本，避免对屏幕上残留的旧提示重复应答
+		text := screen.Since(st.seen, screenTailSize)
+		if text == "" {
+			continue
+		}
+		if rule.Prompt != "" {
+			// 每次出现的提示只应答一次，且提示必须在上次触发后重新出现
+			if promptState(rule.Prompt) != state || !since.After(st.promptSince) ||
+				!matchAny(promptPatterns(rule.Prompt), text) {
+				continue
+			}
+		}
+		if rule.Match != "" && !st.re.MatchString(text) {
+			continue
+		}
+
+		st.fires++
+		st.lastFired = now
+		st.seen = total
+		st.promptSince = since
+		fires = append(fires, responderFire{Name: rule.Name, Reply: st.reply, Fires: st.fires})
+	}
+	return fires
+}
+
+// exhausted 规则已失效或达到触发上限
+func (st *responderState) exhausted(now time.Time) bool {
+	if !st.expiresAt.IsZero() && now.After(st.expiresAt) {
+		return true
+	}
+	return st.rule.MaxFires > 0 && st.fires >= st.rule.MaxFires
+}
+
+// promptState 返回提示类型对应的会话状态
+func promptState(kind string) SessionState {
+	if kind == protocol.PromptApproval {
+		return StateAwaitingApproval
+	}
+	return StateIdle
+}
+
+// promptPatterns 返回识别提示类型的屏幕特征
+func promptPatterns(kind string) []*regexp.Regexp {
+	if kind == protocol.PromptApproval {
+		return approvalPatterns
+	}
+	return inputBoxPatterns
+}
+
+// list 返回规则及其运行状态
+func (r *responders) list() []protocol.Responder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	views := make([]protocol.Responder, 0, len(r.rules))
+	for _, st := range r.rules {
+		v := protocol.Responder{
+			Name:     st.rule.Name,
+			Match:    st.rule.Match,
+			Prompt:   st.rule.Prompt,
+			Reply:    st.rule.Reply,
+			Keys:     st.rule.Keys,
+			States:   st.rule.States,
+			MaxFires: st.rule.MaxFires,
+			Cooldown: st.rule.Cooldown.String(),
+			Enabled:  st.enabled,
+			Expired:  st.exhausted(now),
+			Fires:    st.fires,
+		}
+		if !st.expiresAt.IsZero() {
+			t := st.expiresAt
+			v.ExpiresAt = &t
+		}
+		if !st.lastFired.IsZero() {
+			t := st.lastFired
+			v.LastFired = &t
+		}
+		views = append(views, v)
+	}
+	return views
+}
+
+// runResponders 定期检查自动应答规则，触发的回复经由输入通道写入（同样受输入策略约束）
+func (w *ClaudeWarp) runResponders() {
+	ticker := time.NewTicker(responderInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		state, since := w.tracker.Current()
+		if state == StateExited {
+			continue // 会话可能被恢复
+		}
+		fires := w.responders.check(w.screen, state, since, w.tracker.LastOutput())
+		for _, fire := range fires {
+			w.addMessage("output", fmt.Sprintf("🤖 自动应答规则 %s 第%d次触发，回复 %q", fire.Name, fire.Fires, fire.Reply))
+			in := WebInput{
+				Content:   fire.Reply,
+				Source:    SourceResponder,
+				Transport: SourceResponder,
+				User:      "responder:" + fire.Name,
+				Role:      RoleController,
+				ID:        newInputID(),
+			}
+			select {
+			case w.inputChan <- in:
+			default:
+				w.metrics.inputRejected.Add(1)
+				w.addMessage("error", fmt.Sprintf("自动应答规则 %s 的回复被丢弃：输入队列已满", fire.Name))
+			}
+		}
+		if len(fires) > 0 {
+			w.broadcastResponders()
+		}
+	}
+}
+
+// broadcastResponders 广播自动应答规则状态
+func (w *ClaudeWarp) broadcastResponders() {
+	w.broadcastEvent(protocol.RespondersEvent{
+		Type:       protocol.EventResponders,
+		Responders: w.responders.list(),
+	})
+}
+
+// handleResponders 处理 GET /api/responders 与 POST /api/responders/{name}/enable|disable
+func (w *ClaudeWarp) handleResponders(wr http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/responders"), "/")
+	if rest == "" {
+		data, _ := json.Marshal(w.responders.list())
+		wr.Header().Set("Content-Type", "application/json")
+		wr.Write(data)
+		return
+	}
+
+	i := strings.LastIndex(rest, "/")
+	if i < 0 || (rest[i+1:] != "enable" && rest[i+1:] != "disable") {
+		http.NotFound(wr, r)
+		return
+	}
+	name, action := rest[:i], rest[i+1:]
+	if r.Method != "POST" {
+		http.Error(wr, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := w.requireController(wr, r)
+	if !ok {
+		return
+	}
+	if !w.responders.setEnabled(name, action == "enable") {
+		http.Error(wr, "自动应答规则不存在", http.StatusNotFound)
+		return
+	}
+
+	label := "禁用"
+	if action == "enable" {
+		label = "启用"
+	}
+	w.addMessage("output", fmt.Sprintf("🤖 %s%s了自动应答规则 %s", requestIdentity(user, r.RemoteAddr), label, name))
+	w.broadcastResponders()
+
+	data, _ := json.Marshal(w.responders.list())
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
@@ -0,0 +1,851 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/imneov/claudewarp/client"
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// 定时任务的时间参数
+const (
+	scheduleInterval     = 15 * time.Second // 检查到期任务的间隔，同时也是争取执行权的间隔
+	scheduleStartTimeout = 30 * time.Second // 等待新启动的会话就绪的最长时间
+	scheduleRunsShown    = 50               // /api/schedules 返回的执行记录数
+)
+
+// ScheduleRule 配置文件中的定时任务（支持SIGHUP热加载）
+type ScheduleRule struct {
+	Name    string `json:"name"`
+	Cron    string `json:"cron,omitempty"`    // 5段cron表达式，如 "0 9 * * 1-5"
+	At      string `json:"at,omitempty"`      // RFC3339时间，一次性执行
+	Prompt  string `json:"prompt"`            // 加入目标会话任务队列的提示
+	Session string `json:"session,omitempty"` // 目标会话名
+	Profile string `json:"profile,omitempty"` // 目标会话配置，没有运行中的会话时用它启动新会话
+}
+
+// job 转换为定时任务
+func (r ScheduleRule) job() (protocol.ScheduleJob, error) {
+	job := protocol.ScheduleJob{
+		Name:    r.Name,
+		Cron:    r.Cron,
+		Prompt:  r.Prompt,
+		Session: r.Session,
+		Profile: r.Profile,
+		Origin:  protocol.ScheduleFromConfig,
+	}
+	if r.At != "" {
+		at, err := time.Parse(time.RFC3339, r.At)
+		if err != nil {
+			return job, fmt.Errorf("at 必须是RFC3339时间（如 2024-05-01T09:00:00+08:00）: %v", err)
+		}
+		job.At = &at
+	}
+	return job, nil
+}
+
+// validateSchedules 校验配置中的定时任务
+func (c *Config) validateSchedules() []error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i, rule := range c.Schedules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		} else if seen[name] {
+			errs = append(errs, fmt.Errorf("schedules[%s] 名称重复", name))
+		}
+		seen[name] = true
+
+		job, err := rule.job()
+		if err == nil {
+			_, err = compileSchedule(job)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schedules[%s]: %v", name, err))
+			continue
+		}
+		if job.Profile != "" && !c.hasProfile(job.Profile) {
+			errs = append(errs, fmt.Errorf("schedules[%s].profile 未找到会话配置 %q", name, job.Profile))
+		}
+	}
+	return errs
+}
+
+// hasProfile 判断会话配置是否存在
+func (c *Config) hasProfile(name string) bool {
+	_, ok := c.Profiles[name]
+	return ok || name == defaultProfileName
+}
+
+// compileSchedule 校验定时任务，cron任务返回解析后的表达式
+func compileSchedule(job protocol.ScheduleJob) (*cronSpec, error) {
+	switch {
+	case !validSessionName(job.Name):
+		return nil, fmt.Errorf("name 只能包含字母、数字、'.'、'_' 和 '-'，当前为 %q", job.Name)
+	case strings.TrimSpace(job.Prompt) == "":
+		return nil, fmt.Errorf("prompt 不能为空")
+	case (job.Cron == "") == (job.At == nil):
+		return nil, fmt.Errorf("cron 和 at 必须且只能设置一个")
+	case job.Session != "" && !validSessionName(job.Session):
+		return nil, fmt.Errorf("session 只能包含字母、数字、'.'、'_' 和 '-'，当前为 %q", job.Session)
+	case job.Session == "" && job.Profile == "":
+		return nil, fmt.Errorf("需要设置 session 或 profile")
+	}
+	if job.Cron == "" {
+		return nil, nil
+	}
+	spec, err := parseCron(job.Cron)
+	if err != nil {
+		return nil, err
+	}
+	if spec.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron表达式 %q 永远不会触发", job.Cron)
+	}
+	return spec, nil
+}
+
+// scheduledJob 定时任务及解析后的cron表达式
+type scheduledJob struct {
+	protocol.ScheduleJob
+	spec *cronSpec
+}
+
+// cronNext 执行进程记录的cron任务下次执行时间
+type cronNext struct {
+	expr string
+	at   time.Time
+}
+
+// scheduler 定时任务调度器。
+// 同一状态目录下可能运行多个claudewarp，通过 scheduler.lock 上的文件锁保证只有一个进程执行任务；
+// 任务定义与执行状态都保存在 <state_dir>/schedules 下，所有进程都能查看。
+type scheduler struct {
+	mu         sync.Mutex
+	cfg        *Config
+	configPath string
+	warp       *ClaudeWarp // 所在会话，独立运行（claudewarp scheduler）时为nil
+	lock       *os.File    // 持有文件锁时为执行进程
+	next       map[string]cronNext
+}
+
+// newScheduler 创建调度器
+func newScheduler(cfg *Config, configPath string, warp *ClaudeWarp) *scheduler {
+	return &scheduler{cfg: cfg, configPath: configPath, warp: warp}
+}
+
+// setConfig 更新配置（SIGHUP后）
+func (s *scheduler) setConfig(cfg *Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = cfg
+}
+
+// dir 返回定时任务目录
+func (s *scheduler) dir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return filepath.Join(s.cfg.StateDir, "schedules")
+}
+
+// logf 输出调度日志：在会话中运行时写入消息历史
+func (s *scheduler) logf(format string, args ...interface{}) {
+	if s.warp != nil {
+		s.warp.addMessage("output", fmt.Sprintf(format, args...))
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// jobs 返回配置文件与API添加的全部定时任务
+func (s *scheduler) jobs() ([]scheduledJob, error) {
+	s.mu.Lock()
+	rules := s.cfg.Schedules
+	s.mu.Unlock()
+
+	var jobs []scheduledJob
+	for _, rule := range rules {
+		job, err := rule.job()
+		if err != nil {
+			continue // 配置已校验
+		}
+		spec, _ := compileSchedule(job)
+		jobs = append(jobs, scheduledJob{job, spec})
+	}
+	stored, err := s.loadStoredJobs()
+	if err != nil {
+		return jobs, err
+	}
+	for _, job := range stored {
+		spec, err := compileSchedule(job)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, scheduledJob{job, spec})
+	}
+	return jobs, nil
+}
+
+// loadStoredJobs 读取API添加的定时任务
+func (s *scheduler) loadStoredJobs() ([]protocol.ScheduleJob, error) {
+	var jobs []protocol.ScheduleJob
+	if err := readJSONFile(filepath.Join(s.dir(), "jobs.json"), &jobs); err != nil {
+		return nil, fmt.Errorf("读取定时任务失败: %v", err)
+	}
+	return jobs, nil
+}
+
+// saveStoredJobs 保存API添加的定时任务
+func (s *scheduler) saveStoredJobs(jobs []protocol.ScheduleJob) error {
+	if err := writeJSONFile(filepath.Join(s.dir(), "jobs.json"), jobs); err != nil {
+		return fmt.Errorf("保存定时任务失败: %v", err)
+	}
+	return nil
+}
+
+// lastRuns 读取各任务上次执行时间
+func (s *scheduler) lastRuns() map[string]time.Time {
+	last := make(map[string]time.Time)
+	readJSONFile(filepath.Join(s.dir(), "state.json"), &last)
+	return last
+}
+
+// errScheduleNotFound 定时任务不存在
+var errScheduleNotFound = errors.New("定时任务不存在")
+
+// add 添加定时任务
+func (s *scheduler) add(job protocol.ScheduleJob) error {
+	if _, err := compileSchedule(job); err != nil {
+		return err
+	}
+	jobs, err := s.jobs()
+	if err != nil {
+		return err
+	}
+	for _, existing := range jobs {
+		if existing.Name == job.Name {
+			return fmt.Errorf("定时任务 %q 已存在", job.Name)
+		}
+	}
+	stored, _ := s.loadStoredJobs()
+	return s.saveStoredJobs(append(stored, job))
+}
+
+// remove 删除API添加的定时任务
+func (s *scheduler) remove(name string) error {
+	stored, err := s.loadStoredJobs()
+	if err != nil {
+		return err
+	}
+	for i, job := range stored {
+		if job.Name == name {
+			return s.saveStoredJobs(append(stored[:i], stored[i+1:]...))
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rule := range s.cfg.Schedules {
+		if rule.Name == name {
+			return fmt.Errorf("定时任务 %q 来自配置文件，请修改配置后发送SIGHUP", name)
+		}
+	}
+	return errScheduleNotFound
+}
+
+// find 按名称查找定时任务
+func (s *scheduler) find(name string) (scheduledJob, error) {
+	jobs, err := s.jobs()
+	for _, job := range jobs {
+		if job.Name == name {
+			return job, nil
+		}
+	}
+	if err != nil {
+		return scheduledJob{}, err
+	}
+	return scheduledJob{}, errScheduleNotFound
+}
+
+// tryLead 尝试获取执行权，返回本进程是否负责执行定时任务
+func (s *scheduler) tryLead() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lock != nil {
+		return true
+	}
+	dir := filepath.Join(s.cfg.StateDir, "schedules")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return false
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "scheduler.lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return false
+	}
+	// 持有锁的进程退出后锁自动释放，其他进程在下一轮接手
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return false
+	}
+	f.Truncate(0)
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	s.lock = f
+	s.next = make(map[string]cronNext)
+	return true
+}
+
+// isLeader 返回本进程是否负责执行定时任务
+func (s *scheduler) isLeader() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lock != nil
+}
+
+// due 返回到期的任务并记录执行时间。
+// cron任务只在执行进程运行期间按时触发，错过的时间点不补执行；
+// 一次性任务即使错过（如进程未运行）也会在之后执行一次。
+func (s *scheduler) due(now time.Time) []protocol.ScheduleJob {
+	jobs, err := s.jobs()
+	if err != nil {
+		s.logf("⚠️ %v", err)
+	}
+	last := s.lastRuns()
+
+	s.mu.Lock()
+	var fired []protocol.ScheduleJob
+	for _, job := range jobs {
+		if job.spec == nil {
+			if last[job.Name].Before(*job.At) && !job.At.After(now) {
+				fired = append(fired, job.ScheduleJob)
+			}
+			continue
+		}
+		n, ok := s.next[job.Name]
+		if !ok || n.expr != job.Cron {
+			base := now
+			if last[job.Name].After(base) {
+				base = last[job.Name]
+			}
+			n = cronNext{expr: job.Cron, at: job.spec.next(base)}
+		}
+		if !n.at.IsZero() && !n.at.After(now) {
+			fired = append(fired, job.ScheduleJob)
+			n.at = job.spec.next(now)
+		}
+		s.next[job.Name] = n
+	}
+	s.mu.Unlock()
+
+	if len(fired) > 0 {
+		for _, job := range fired {
+			last[job.Name] = now
+		}
+		if err := writeJSONFile(filepath.Join(s.dir(), "state.json"), last); err != nil {
+			s.logf("⚠️ 保存定时任务状态失败: %v", err)
+		}
+	}
+	return fired
+}
+
+// run 定期争取执行权并执行到期任务
+func (s *scheduler) run() {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	leading := false
+	for ; ; <-ticker.C {
+		if !s.tryLead() {
+			continue
+		}
+		if !leading {
+			leading = true
+			s.logf("⏰ 本进程负责执行定时任务")
+			s.changed()
+		}
+		for _, job := range s.due(time.Now()) {
+			go s.fire(job, newScheduleRun(job))
+		}
+	}
+}
+
+// newScheduleRun 为一次执行生成记录
+func newScheduleRun(job protocol.ScheduleJob) protocol.ScheduleRun {
+	return protocol.ScheduleRun{ID: newInputID(), Job: job.Name, At: time.Now(), Status: protocol.RunPending}
+}
+
+// fire 执行一次定时任务：把提示加入目标会话的任务队列，并记录执行结果。
+// 启动目标会话可能需要较长时间，调用方应在单独的goroutine中执行
+func (s *scheduler) fire(job protocol.ScheduleJob, run protocol.ScheduleRun) {
+	run.Status = protocol.RunDelivered
+	item, err := s.deliver(job, &run)
+	if err != nil {
+		run.Status, run.Error = protocol.RunFailed, err.Error()
+		s.logf("⏰ 定时任务 %s 执行失败: %v", job.Name, err)
+	} else {
+		run.ItemID = item.ID
+		s.logf("⏰ 定时任务 %s 已加入会话 %s 的任务队列（%s）", job.Name, run.Session, item.ID)
+	}
+	if err := s.appendRun(run); err != nil {
+		s.logf("⚠️ %v", err)
+	}
+	s.changed()
+}
+
+// deliver 找到（必要时启动）目标会话并加入任务队列，Claude空闲时由队列提交
+func (s *scheduler) deliver(job protocol.ScheduleJob, run *protocol.ScheduleRun) (QueueItem, error) {
+	s.mu.Lock()
+	cfg, configPath := s.cfg, s.configPath
+	s.mu.Unlock()
+
+	rec, own, err := s.target(cfg, job)
+	if err != nil {
+		return QueueItem{}, err
+	}
+	if own {
+		run.Session = cfg.SessionName()
+		return s.warp.enqueue(job.Prompt, "schedule:"+job.Name)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	if rec.PID == 0 {
+		if rec, err = startHeadlessSession(cfg, configPath, rec.Name, job.Profile); err != nil {
+			return QueueItem{}, err
+		}
+		run.Started = true
+		deadline = time.Now().Add(scheduleStartTimeout)
+	}
+	run.Session = rec.Name
+
+	opts, err := rec.clientOptions()
+	if err != nil {
+		return QueueItem{}, err
+	}
+	c, err := client.New(rec.ClientURL(), opts)
+	if err != nil {
+		return QueueItem{}, err
+	}
+	defer c.Close()
+
+	// 刚启动的会话可能还没开始监听，连接失败时重试到期限为止
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	for {
+		item, err := c.Enqueue(ctx, job.Prompt)
+		var apiErr *client.APIError
+		if err == nil || errors.As(err, &apiErr) || ctx.Err() != nil {
+			return item, err
+		}
+		select {
+		case <-ctx.Done():
+			return item, err
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// target 确定投递的会话：优先使用本会话或运行中的同名/同配置会话。
+// 返回的登记PID为0表示需要启动新会话，此时 rec.Name 为要使用的会话名。
+func (s *scheduler) target(cfg *Config, job protocol.ScheduleJob) (rec sessionRecord, own bool, err error) {
+	self := ""
+	if s.warp != nil {
+		self = cfg.SessionName()
+	}
+
+	name := job.Session
+	if name == "" {
+		if self != "" && cfg.Profile == job.Profile {
+			return rec, true, nil
+		}
+		sessions, err := listSessions(cfg.StateDir)
+		if err != nil {
+			return rec, false, fmt.Errorf("读取会话登记失败: %v", err)
+		}
+		for _, sess := range sessions {
+			if sess.Profile == job.Profile {
+				return sess, false, nil
+			}
+		}
+		name = job.Profile
+	}
+	if name == self {
+		return rec, true, nil
+	}
+	if existing, err := readSession(filepath.Join(sessionDir(cfg.StateDir), name+".json")); err == nil && existing.alive() {
+		return existing, false, nil
+	}
+	if job.Profile == "" {
+		return rec, false, fmt.Errorf("会话 %q 未运行，且任务未指定用于启动会话的profile", name)
+	}
+	return sessionRecord{Name: name}, false, nil
+}
+
+// startHeadlessSession 在后台启动一个无控制台的claudewarp会话，只监听Unix socket，
+// 输出写入 <state_dir>/sessions/<name>.log
+func startHeadlessSession(cfg *Config, configPath, name, profile string) (sessionRecord, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return sessionRecord{}, fmt.Errorf("无法定位claudewarp可执行文件: %v", err)
+	}
+	dir := sessionDir(cfg.StateDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return sessionRecord{}, fmt.Errorf("创建会话目录失败: %v", err)
+	}
+	logPath := filepath.Join(dir, name+".log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return sessionRecord{}, fmt.Errorf("创建会话日志失败: %v", err)
+	}
+	defer logFile.Close()
+
+	var args []string
+	if configPath != "" {
+		args = append(args, "-config", configPath)
+	}
+	args = append(args,
+		"-headless",
+		"-profile", profile,
+		"-session", name,
+		"-state-dir", cfg.StateDir,
+		"-unix-only",
+		"-unix-socket", filepath.Join(dir, name+".sock"),
+	)
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true} // 脱离当前终端，不随本进程退出
+	if err := cmd.Start(); err != nil {
+		return sessionRecord{}, fmt.Errorf("启动会话失败: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	// 等待新进程登记会话
+	path := filepath.Join(dir, name+".json")
+	deadline := time.After(scheduleStartTimeout)
+	for {
+		if rec, err := readSession(path); err == nil && rec.PID == cmd.Process.Pid {
+			return rec, nil
+		}
+		select {
+		case <-exited:
+			return sessionRecord{}, fmt.Errorf("会话 %s 启动失败，详见 %s", name, logPath)
+		case <-deadline:
+			return sessionRecord{}, fmt.Errorf("等待会话 %s 启动超时，详见 %s", name, logPath)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// appendRun 追加执行记录
+func (s *scheduler) appendRun(run protocol.ScheduleRun) error {
+	dir := s.dir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("记录定时任务执行失败: %v", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "runs.jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("记录定时任务执行失败: %v", err)
+	}
+	defer f.Close()
+	data, _ := json.Marshal(run)
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// recentRuns 返回最近的n条执行记录，最近的在前
+func (s *scheduler) recentRuns(n int) []protocol.ScheduleRun {
+	runs := []protocol.ScheduleRun{}
+	f, err := os.Open(filepath.Join(s.dir(), "runs.jsonl"))
+	if err != nil {
+		return runs
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var run protocol.ScheduleRun
+		if json.Unmarshal(scanner.Bytes(), &run) == nil {
+			runs = append(runs, run)
+		}
+	}
+	if len(runs) > n {
+		runs = runs[len(runs)-n:]
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].At.After(runs[j].At) })
+	return runs
+}
+
+// snapshot 返回定时任务及最近的执行记录
+func (s *scheduler) snapshot() protocol.Schedules {
+	jobs, _ := s.jobs()
+	last := s.lastRuns()
+	now := time.Now()
+
+	view := protocol.Schedules{
+		Leader: s.isLeader(),
+		Jobs:   make([]protocol.ScheduleJob, 0, len(jobs)),
+		Runs:   s.recentRuns(scheduleRunsShown),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range jobs {
+		v := job.ScheduleJob
+		if t, ok := last[job.Name]; ok {
+			v.LastRun = &t
+		}
+		var next time.Time
+		switch {
+		case job.spec == nil:
+			if v.LastRun == nil || v.LastRun.Before(*job.At) {
+				next = *job.At
+			}
+		case s.next[job.Name].expr == job.Cron && !s.next[job.Name].at.IsZero():
+			next = s.next[job.Name].at
+		default:
+			base := now
+			if v.LastRun != nil && v.LastRun.After(base) {
+				base = *v.LastRun
+			}
+			next = job.spec.next(base)
+		}
+		if !next.IsZero() {
+			v.Next = &next
+		}
+		view.Jobs = append(view.Jobs, v)
+	}
+	return view
+}
+
+// changed 定时任务或执行记录变化时通知Web客户端
+func (s *scheduler) changed() {
+	if s.warp != nil {
+		s.warp.broadcastSchedules()
+	}
+}
+
+// readJSONFile 读取JSON文件，文件不存在时保持v不变
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSONFile 原子写入JSON文件
+func writeJSONFile(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, _ := json.MarshalIndent(v, "", "  ")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// enqueue 把提示加入本会话的任务队列，会话空闲时立即提交
+func (w *ClaudeWarp) enqueue(prompt, by string) (QueueItem, error) {
+	item, err := w.queue.add(prompt, by)
+	if err != nil {
+		return item, err
+	}
+	w.broadcastQueue()
+	if state, _ := w.tracker.Current(); state == StateIdle {
+		w.advanceQueue(state)
+	}
+	return item, nil
+}
+
+// broadcastSchedules 广播定时任务
+func (w *ClaudeWarp) broadcastSchedules() {
+	w.broadcastEvent(protocol.SchedulesEvent{Type: protocol.EventSchedules, Schedules: w.scheduler.snapshot()})
+}
+
+// scheduleRequest 添加定时任务的请求体，in 为相对当前时间的延迟（如 "2h"）
+type scheduleRequest struct {
+	Name    string     `json:"name"`
+	Cron    string     `json:"cron"`
+	At      *time.Time `json:"at"`
+	In      string     `json:"in"`
+	Prompt  string     `json:"prompt"`
+	Session string     `json:"session"`
+	Profile string     `json:"profile"`
+}
+
+// handleSchedules 处理定时任务API：
+//
+//	GET  /api/schedules               定时任务及最近的执行记录
+//	POST /api/schedules               添加任务 {"name", "cron" | "at" | "in", "prompt", "session", "profile"}
+//	POST /api/schedules/{name}/run    立即执行一次
+//	POST /api/schedules/{name}/delete 删除API添加的任务
+func (w *ClaudeWarp) handleSchedules(wr http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/schedules"), "/")
+	if r.Method == "GET" && rest == "" {
+		data, _ := json.Marshal(w.scheduler.snapshot())
+		wr.Header().Set("Content-Type", "application/json")
+		wr.Write(data)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(wr, "仅支持GET和POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := w.requireController(wr, r)
+	if !ok {
+		return
+	}
+	who := requestIdentity(user, r.RemoteAddr)
+
+	var err error
+	name, action, _ := strings.Cut(rest, "/")
+	switch {
+	case rest == "":
+		var req scheduleRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&req); err != nil {
+			http.Error(wr, "无效的JSON", http.StatusBadRequest)
+			return
+		}
+		job, err := w.scheduleFromRequest(req, who)
+		if err == nil {
+			err = w.scheduler.add(job)
+		}
+		if err != nil {
+			http.Error(wr, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.addMessage("output", fmt.Sprintf("⏰ %s 添加了定时任务 %s", who, job.Name))
+	case action == "run":
+		var job scheduledJob
+		if job, err = w.scheduler.find(name); err == nil {
+			w.addMessage("output", fmt.Sprintf("⏰ %s 手动执行了定时任务 %s", who, name))
+			// 在后台执行，结果通过 schedules 事件和执行记录查看
+			run := newScheduleRun(job.ScheduleJob)
+			go w.scheduler.fire(job.ScheduleJob, run)
+			data, _ := json.Marshal(run)
+			wr.Header().Set("Content-Type", "application/json")
+			wr.WriteHeader(http.StatusAccepted)
+			wr.Write(data)
+			return
+		}
+	case action == "delete":
+		if err = w.scheduler.remove(name); err == nil {
+			w.addMessage("output", fmt.Sprintf("⏰ %s 删除了定时任务 %s", who, name))
+		}
+	default:
+		http.NotFound(wr, r)
+		return
+	}
+	if err == errScheduleNotFound {
+		http.Error(wr, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(wr, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.broadcastSchedules()
+	data, _ := json.Marshal(w.scheduler.snapshot())
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
+
+// scheduleFromRequest 根据API请求构造定时任务，未指定目标时投递到本会话
+func (w *ClaudeWarp) scheduleFromRequest(req scheduleRequest, who string) (protocol.ScheduleJob, error) {
+	job := protocol.ScheduleJob{
+		Name:      req.Name,
+		Cron:      req.Cron,
+		At:        req.At,
+		Prompt:    req.Prompt,
+		Session:   req.Session,
+		Profile:   req.Profile,
+		Origin:    protocol.ScheduleFromAPI,
+		CreatedBy: who,
+	}
+	if req.In != "" {
+		if req.At != nil {
+			return job, fmt.Errorf("at 和 in 不能同时设置")
+		}
+		d, err := time.ParseDuration(req.In)
+		if err != nil || d <= 0 {
+			return job, fmt.Errorf("in 必须是正的时长（如 \"2h\"）")
+		}
+		at := time.Now().Add(d).Truncate(time.Second)
+		job.At = &at
+	}
+	if job.At != nil && !job.At.After(time.Now()) {
+		return job, fmt.Errorf("at 必须是将来的时间")
+	}
+	if job.Profile != "" && !w.config().hasProfile(job.Profile) {
+		return job, fmt.Errorf("未找到会话配置 %q", job.Profile)
+	}
+	if job.Session == "" && job.Profile == "" {
+		job.Session = w.config().SessionName()
+	}
+	return job, nil
+}
+
+// runSchedulerCommand 处理 claudewarp scheduler：不启动会话，只执行定时任务，
+// 适合在没有常驻会话时由systemd等托管，需要时按profile启动后台会话
+func runSchedulerCommand(args []string) int {
+	cfg, path, err := loadConfig("claudewarp scheduler", args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 配置无效:\n%v\n", err)
+		return 1
+	}
+
+	s := newScheduler(cfg, path, nil)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			cfg, _, err := loadConfig("claudewarp scheduler", args)
+			if err == nil {
+				err = cfg.Validate()
+			}
+			if err != nil {
+				log.Printf("重新加载配置失败，保留原配置: %v", err)
+				continue
+			}
+			s.setConfig(cfg)
+			log.Printf("🔄 配置已重新加载")
+		}
+	}()
+
+	log.Printf("⏰ 定时任务调度器已启动（%s）", s.dir())
+	s.run()
+	return 0
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// screenBuffer 保存去除ANSI转义序列后的最近输出，供屏幕启发式判断使用
+type screenBuffer struct {
+	mu       sync.Mutex
+	data     []byte                // 纯文本输出（已去除转义序列）
+	limit    int                   // 最多保留的字节数
+	stripper protocol.TextStripper // 转义序列解析状态
+	total    int64                 // 累计写入的纯文本字节数，即data末尾在纯文本流中的位置
+}
+
+// newScreenBuffer 创建屏幕缓冲区
+func newScreenBuffer(limit int) *screenBuffer {
+	return &screenBuffer{limit: limit}
+}
+
+// Write 解析终端输出并追加纯文本内容
+func (s *screenBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := len(s.data)
+	s.data = s.stripper.AppendText(s.data, p)
+	s.total += int64(len(s.data) - before)
+	if len(s.data) > s.limit {
+		s.data = append(s.data[:0], s.data[len(s.data)-s.limit:]...)
+	}
+	return len(p), nil
+}
+
+// Tail 返回最近n字节的纯文本内容
+func (s *screenBuffer) Tail(n int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n <= 0 || n > len(s.data) {
+		n = len(s.data)
+	}
+	return strings.ToValidUTF8(string(s.data[len(s.data)-n:]), "")
+}
+
+// Total 返回纯文本流的末尾位置
+func (s *screenBuffer) Total() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// Since 返回纯文本流中pos之后的内容，最多返回最近n字节
+func (s *screenBuffer) Since(pos int64, n int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	avail := s.total - pos
+	if avail <= 0 {
+		return ""
+	}
+	if avail > int64(len(s.data)) {
+		avail = int64(len(s.data))
+	}
+	if n > 0 && avail > int64(n) {
+		avail = int64(n)
+	}
+	return strings.ToValidUTF8(string(s.data[len(s.data)-int(avail):]), "")
+}
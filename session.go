@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/imneov/claudewarp/client"
+)
+
+// sessionNamePattern 会话名只允许可安全用作文件名的字符
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// validSessionName 判断会话名是否合法
+func validSessionName(name string) bool {
+	return sessionNamePattern.MatchString(name) && name != "." && name != ".."
+}
+
+// SessionName 返回会话名，未设置时使用profile名
+func (c *Config) SessionName() string {
+	if c.Session != "" {
+		return c.Session
+	}
+	return c.Profile
+}
+
+// sessionRecord 登记在 <state_dir>/sessions/<name>.json 中的运行中会话
+type sessionRecord struct {
+	Name      string    `json:"name"`
+	PID       int       `json:"pid"`
+	Profile   string    `json:"profile"`
+	Cwd       string    `json:"cwd"`
+	URL       string    `json:"url,omitempty"`     // TCP地址，如 http://127.0.0.1:8080
+	Socket    string    `json:"socket,omitempty"`  // Unix socket路径
+	CAFile    string    `json:"ca_file,omitempty"` // 自签名证书，供CLI校验HTTPS
+	StartedAt time.Time `json:"started_at"`
+}
+
+// sessionDir 会话登记目录
+func sessionDir(stateDir string) string {
+	return filepath.Join(stateDir, "sessions")
+}
+
+// alive 判断登记会话的进程是否仍在运行
+func (s sessionRecord) alive() bool {
+	if s.PID <= 0 {
+		return false
+	}
+	err := syscall.Kill(s.PID, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// ClientURL 返回CLI连接会话使用的地址，优先使用Unix socket
+func (s sessionRecord) ClientURL() string {
+	if s.Socket != "" {
+		return "unix://" + s.Socket
+	}
+	return s.URL
+}
+
+// clientOptions 返回连接会话使用的客户端选项，自签名证书会加入信任列表
+func (s sessionRecord) clientOptions() (*client.Options, error) {
+	opts := &client.Options{}
+	if s.CAFile != "" {
+		pem, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取会话证书失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(pem)
+		opts.TLSConfig = &tls.Config{RootCAs: pool}
+	}
+	return opts, nil
+}
+
+// writeSessionRecord 写入会话登记，同名会话仍在运行时返回错误
+func writeSessionRecord(stateDir string, rec sessionRecord) (string, error) {
+	dir := sessionDir(stateDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("创建会话目录失败: %v", err)
+	}
+	path := filepath.Join(dir, rec.Name+".json")
+	if old, err := readSession(path); err == nil && old.alive() && old.PID != rec.PID {
+		return "", fmt.Errorf("会话 %q 已在运行（pid %d），请用 -session 指定其他名称", rec.Name, old.PID)
+	}
+
+	data, _ := json.MarshalIndent(rec, "", "  ")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return "", fmt.Errorf("写入会话登记失败: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("写入会话登记失败: %v", err)
+	}
+	return path, nil
+}
+
+// registerSession 登记当前会话
+func (w *ClaudeWarp) registerSession(cfg *Config, profile Profile, tlsEnabled bool) (string, error) {
+	rec := sessionRecord{
+		Name:      cfg.SessionName(),
+		PID:       os.Getpid(),
+		Profile:   cfg.Profile,
+		Cwd:       profile.Cwd,
+		Socket:    cfg.Unix.Path,
+		StartedAt: time.Now(),
+	}
+	if rec.Cwd == "" {
+		rec.Cwd, _ = os.Getwd()
+	}
+	if rec.Socket != "" {
+		rec.Socket, _ = filepath.Abs(rec.Socket)
+	}
+	if !cfg.Unix.Only {
+		rec.URL = sessionListenURL(cfg.Host, cfg.Port, tlsEnabled)
+		if tlsEnabled && cfg.TLS.Cert == "" {
+			rec.CAFile = filepath.Join(cfg.StateDir, "tls", "cert.pem")
+		}
+	}
+	return writeSessionRecord(cfg.StateDir, rec)
+}
+
+// readSession 读取一个会话登记文件
+func readSession(path string) (sessionRecord, error) {
+	var rec sessionRecord
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rec, err
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, fmt.Errorf("%s: %v", path, err)
+	}
+	return rec, nil
+}
+
+// listSessions 列出登记的会话，已退出进程遗留的登记文件会被清理
+func listSessions(stateDir string) ([]sessionRecord, error) {
+	paths, err := filepath.Glob(filepath.Join(sessionDir(stateDir), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var sessions []sessionRecord
+	for _, path := range paths {
+		rec, err := readSession(path)
+		if err != nil {
+			continue
+		}
+		if !rec.alive() {
+			os.Remove(path)
+			continue
+		}
+		sessions = append(sessions, rec)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Name < sessions[j].Name })
+	return sessions, nil
+}
+
+// sessionListenURL 返回本机CLI访问TCP监听地址使用的URL
+func sessionListenURL(host string, port int, tls bool) string {
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	// 监听所有地址时通过回环地址访问
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		if ip.To4() != nil {
+			host = "127.0.0.1"
+		} else {
+			host = "::1"
+		}
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return scheme + "://" + host + ":" + strconv.Itoa(port)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// SessionState 表示Claude会话的当前状态
+type SessionState = protocol.State
+
+const (
+	StateRunning          = protocol.StateRunning
+	StateIdle             = protocol.StateIdle
+	StateAwaitingApproval = protocol.StateAwaitingApproval
+	StateRateLimited      = protocol.StateRateLimited
+	StateExited           = protocol.StateExited
+)
+
+// 屏幕启发式：Claude输入框
+var inputBoxPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\? for shortcuts`),
+	regexp.MustCompile(`│\s*>\s`),
+	regexp.MustCompile(`(?m)^\s*[─━]{10,}\s*\n\s*>`),
+}
+
+// 屏幕启发式：Claude等待确认
+var approvalPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`Do you want to (proceed|make this edit|create|run)`),
+	regexp.MustCompile(`Do you trust the files in this folder`),
+	regexp.MustCompile(`❯\s*1\.\s*Yes`),
+}
+
+// screenTailSize 启发式判断时查看的屏幕尾部字节数
+const screenTailSize = 2048
+
+// promptRows 读取Claude当前提示时查看的屏幕底部非空行数，足以容纳确认对话框中的命令和问题
+const promptRows = 20
+
+// stateTracker 根据PTY输出静默时间和屏幕内容推断会话状态
+type stateTracker struct {
+	mu         sync.RWMutex
+	state      SessionState
+	since      time.Time // 进入当前状态的时间
+	lastOutput time.Time // 最后一次收到PTY输出的时间
+	lastInput  time.Time // 最后一次向PTY输入的时间
+	idleAfter  time.Duration
+	screen     *screenBuffer
+	resetAt    time.Time     // rate_limited 状态下的用量重置时间
+	limitFrom  int64         // 只在纯文本流此位置之后查找用量限制提示，避免重复识别已处理的提示
+	fallback   time.Duration // 无法解析重置时间时的等待时间
+	mode       Mode          // 屏幕上识别到的权限模式
+	bypassSeen bool          // 出现过bypass模式，说明它在Shift+Tab循环中
+	onChange   func(from, to SessionState, since time.Time)
+	onMode     func(mode Mode)
+}
+
+// StateEvent 是通过WebSocket推送的状态变化事件
+type StateEvent = protocol.StateEvent
+
+// newStateTracker 创建状态跟踪器
+func newStateTracker(screen *screenBuffer, idleAfter, fallback time.Duration) *stateTracker {
+	now := time.Now()
+	return &stateTracker{
+		state:      StateRunning,
+		since:      now,
+		lastOutput: now,
+		idleAfter:  idleAfter,
+		screen:     screen,
+		fallback:   fallback,
+	}
+}
+
+// noteOutput 记录一次PTY输出
+func (t *stateTracker) noteOutput() {
+	t.mu.Lock()
+	t.lastOutput = time.Now()
+	t.mu.Unlock()
+}
+
+// setIdleAfter 调整判定空闲所需的静默时间
+func (t *stateTracker) setIdleAfter(d time.Duration) {
+	t.mu.Lock()
+	t.idleAfter = d
+	t.mu.Unlock()
+}
+
+// setRateLimitFallback 调整无法解析重置时间时的等待时间
+func (t *stateTracker) setRateLimitFallback(d time.Duration) {
+	t.mu.Lock()
+	t.fallback = d
+	t.mu.Unlock()
+}
+
+// ResetAt 返回最近一次用量限制的重置时间
+func (t *stateTracker) ResetAt() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.resetAt
+}
+
+// endRateLimit 用量重置后离开 rate_limited 状态，之后按输出重新判断
+func (t *stateTracker) endRateLimit() {
+	if state, _ := t.Current(); state == StateRateLimited {
+		t.set(StateRunning)
+	}
+}
+
+// restart 子进程重新启动后回到running状态，忽略之前输出中的用量限制提示
+func (t *stateTracker) restart() {
+	t.mu.Lock()
+	t.lastOutput = time.Now()
+	t.limitFrom = t.screen.Total()
+	t.mu.Unlock()
+	t.set(StateRunning)
+}
+
+// Mode 返回最近识别到的权限模式
+func (t *stateTracker) Mode() Mode {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.mode
+}
+
+// updateMode 从屏幕尾部识别权限模式，变化时回调onMode；识别不到时保留上次结果
+func (t *stateTracker) updateMode() {
+	mode := parseMode(t.screen.Tail(screenTailSize))
+	if mode == "" {
+		return
+	}
+	t.mu.Lock()
+	if mode == protocol.ModeBypassPermissions {
+		t.bypassSeen = true
+	}
+	changed := mode != t.mode
+	t.mode = mode
+	onMode := t.onMode
+	t.mu.Unlock()
+
+	if changed && onMode != nil {
+		onMode(mode)
+	}
+}
+
+// noteInput 记录一次向PTY的输入
+func (t *stateTracker) noteInput() {
+	t.mu.Lock()
+	t.lastInput = time.Now()
+	t.mu.Unlock()
+}
+
+// LastInput 返回最后一次输入时间
+func (t *stateTracker) LastInput() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.lastInput
+}
+
+// Current 返回当前状态及进入时间
+func (t *stateTracker) Current() (SessionState, time.Time) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.state, t.since
+}
+
+// Prompt 返回Claude当前显示的提示，即屏幕底部的若干非空行
+func (t *stateTracker) Prompt() string {
+	return strings.Join(bottomRows(t.screen.Tail(screenTailSize), promptRows), "\n")
+}
+
+// LastOutput 返回最后一次输出时间
+func (t *stateTracker) LastOutput() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.lastOutput
+}
+
+// set 切换状态，状态变化时回调onChange。
+// 用量限制期间再次识别到新的限制提示（如手动输入后）也会回调，以便重新计时。
+func (t *stateTracker) set(state SessionState) {
+	t.mu.Lock()
+	if t.state == state && state != StateRateLimited {
+		t.mu.Unlock()
+		return
+	}
+	prev := t.state
+	t.state = state
+	t.since = time.Now()
+	since := t.since
+	onChange := t.onChange
+	t.mu.Unlock()
+
+	if onChange != nil {
+		onChange(prev, state, since)
+	}
+}
+
+// evaluate 根据静默时间和屏幕内容重新判断状态
+func (t *stateTracker) evaluate() {
+	t.mu.RLock()
+	current, since := t.state, t.since
+	quiet := time.Since(t.lastOutput)
+	idleAfter := t.idleAfter
+	inputSince := t.lastInput.After(since)
+	limitFrom, fallback := t.limitFrom, t.fallback
+	t.mu.RUnlock()
+
+	if current == StateExited {
+		return
+	}
+	t.updateMode()
+
+	// 用量限制期间保持状态，直到自动继续或有人手动输入
+	if current == StateRateLimited && !inputSince {
+		return
+	}
+	if quiet < idleAfter {
+		t.set(StateRunning)
+		return
+	}
+
+	if found, resetAt := parseRateLimit(t.screen.Since(limitFrom, screenTailSize), time.Now()); found {
+		if resetAt.IsZero() {
+			resetAt = time.Now().Add(fallback)
+		}
+		t.mu.Lock()
+		t.resetAt = resetAt
+		t.limitFrom = t.screen.Total()
+		t.mu.Unlock()
+		t.set(StateRateLimited)
+		return
+	}
+
+	tail := t.screen.Tail(screenTailSize)
+	switch {
+	case matchAny(approvalPatterns, tail):
+		t.set(StateAwaitingApproval)
+	case matchAny(inputBoxPatterns, tail):
+		t.set(StateIdle)
+	case quiet >= 4*idleAfter:
+		// 识别不到输入框时，长时间静默也视为空闲
+		t.set(StateIdle)
+	}
+}
+
+// run 周期性评估状态；会话退出后暂停评估，恢复会话后继续
+func (t *stateTracker) run() {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		t.evaluate()
+	}
+}
+
+// matchAny 判断文本是否匹配任一正则
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// 客户端角色
+const (
+	RoleController = "controller" // 可以向Claude发送输入
+	RoleViewer     = "viewer"     // 只读监控
+)
+
+// clientInfo 记录WebSocket客户端信息
+type clientInfo = protocol.ClientInfo
+
+// childInfo 记录Claude子进程信息
+type childInfo = protocol.ChildInfo
+
+// ptySize PTY窗口大小
+type ptySize = protocol.PTYSize
+
+// SessionStatus 是/api/status返回的会话描述
+type SessionStatus = protocol.Status
+
+// claudeChild 一次启动的Claude子进程及其PTY主端。
+// 恢复会话时整体替换，其他goroutine经currentChild取得后使用，不直接读ClaudeWarp字段
+type claudeChild struct {
+	cmd  *exec.Cmd
+	ptmx *os.File
+
+	waitOnce sync.Once
+	done     chan struct{} // Wait返回后关闭，此后才能读取cmd.ProcessState
+}
+
+// wait 等待子进程退出，可被多个goroutine同时调用，Wait只执行一次
+func (c *claudeChild) wait() {
+	c.waitOnce.Do(func() {
+		c.cmd.Wait()
+		close(c.done)
+	})
+}
+
+// exited 子进程是否已退出并被回收
+func (c *claudeChild) exited() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// currentChild 返回当前Claude子进程，尚未启动或已清理时返回nil
+func (w *ClaudeWarp) currentChild() *claudeChild {
+	w.childMux.RLock()
+	defer w.childMux.RUnlock()
+	return w.proc
+}
+
+// sessionProfile 返回会话配置（不含 --resume），worktree处理完后工作目录会改回主仓库
+func (w *ClaudeWarp) sessionProfile() Profile {
+	w.childMux.RLock()
+	defer w.childMux.RUnlock()
+	return w.profile
+}
+
+// writePTY 写入当前Claude子进程的PTY
+func (w *ClaudeWarp) writePTY(p []byte) (int, error) {
+	child := w.currentChild()
+	if child == nil {
+		return 0, fmt.Errorf("Claude子进程未运行")
+	}
+	return child.ptmx.Write(p)
+}
+
+// recordChildStart 设置当前子进程并记录启动信息
+func (w *ClaudeWarp) recordChildStart(child *claudeChild) {
+	w.childMux.Lock()
+	defer w.childMux.Unlock()
+
+	cmd := child.cmd
+	// 命令行中可能带有令牌，/api/status 只返回脱敏后的参数
+	args := make([]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		args[i] = w.redactor.Redact(arg)
+	}
+	w.proc = child
+	w.child = childInfo{
+		PID:       cmd.Process.Pid,
+		Command:   args,
+		Cwd:       cmd.Dir,
+		StartedAt: time.Now(),
+	}
+}
+
+// waitChild 等待子进程退出并记录退出状态
+func (w *ClaudeWarp) waitChild() {
+	// 收到信号时cleanup可能同时清空当前子进程
+	child := w.currentChild()
+	if child == nil {
+		return
+	}
+	child.wait()
+	w.recordChildExit(child.cmd)
+}
+
+// recordChildExit 记录子进程退出码或终止信号
+func (w *ClaudeWarp) recordChildExit(cmd *exec.Cmd) {
+	if cmd.ProcessState == nil {
+		return
+	}
+
+	w.childMux.Lock()
+	defer w.childMux.Unlock()
+
+	now := time.Now()
+	w.child.Exited = true
+	w.child.ExitedAt = &now
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		w.child.Signal = ws.Signal().String()
+		return
+	}
+	code := cmd.ProcessState.ExitCode()
+	w.child.ExitCode = &code
+}
+
+// status 汇总当前会话状态
+func (w *ClaudeWarp) status() SessionStatus {
+	state, since := w.tracker.Current()
+	st := SessionStatus{
+		State:      state,
+		StateSince: since,
+		Mode:       w.tracker.Mode(),
+		LastOutput: w.tracker.LastOutput(),
+	}
+
+	w.childMux.RLock()
+	st.Child = w.child
+	child := w.proc
+	w.childMux.RUnlock()
+
+	if child != nil && !st.Child.Exited {
+		if rows, cols, err := pty.Getsize(child.ptmx); err == nil {
+			st.PTY = &ptySize{Rows: rows, Cols: cols}
+		}
+	}
+
+	w.clientsMux.RLock()
+	st.Clients = make([]clientInfo, 0, len(w.clients))
+	for _, info := range w.clients {
+		st.Clients = append(st.Clients, *info)
+	}
+	w.clientsMux.RUnlock()
+	sort.Slice(st.Clients, func(i, j int) bool {
+		return st.Clients[i].ConnectedAt.Before(st.Clients[j].ConnectedAt)
+	})
+
+	st.ClaudeSession = w.claudeSessions.get()
+	st.Worktree = w.worktree.get()
+
+	st.LastActivity = st.LastOutput
+	if lastInput := w.tracker.LastInput(); !lastInput.IsZero() {
+		st.LastInput = &lastInput
+		if lastInput.After(st.LastActivity) {
+			st.LastActivity = lastInput
+		}
+	}
+	return st
+}
+
+// handleStatus 处理会话状态描述API
+func (w *ClaudeWarp) handleStatus(wr http.ResponseWriter, r *http.Request) {
+	data, _ := json.Marshal(w.status())
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
+
+// handleHealthz 存活检查：进程能响应即健康
+func (w *ClaudeWarp) handleHealthz(wr http.ResponseWriter, r *http.Request) {
+	wr.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	wr.Write([]byte("ok\n"))
+}
+
+// handleReadyz 就绪检查：Claude子进程在运行时才就绪
+func (w *ClaudeWarp) handleReadyz(wr http.ResponseWriter, r *http.Request) {
+	w.childMux.RLock()
+	child := w.child
+	w.childMux.RUnlock()
+
+	wr.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if child.PID == 0 || child.Exited {
+		http.Error(wr, "Claude子进程未运行", http.StatusServiceUnavailable)
+		return
+	}
+	wr.Write([]byte("ready\n"))
+}
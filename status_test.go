@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRecordChildStartRedactsCommand(t *testing.T) {
+	r, err := newRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &ClaudeWarp{redactor: r}
+	cmd := exec.Command("sh", "-c", "ANTHROPIC_API_KEY="+testAnthropicKey+" true")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+
+	w.recordChildStart(&claudeChild{cmd: cmd, done: make(chan struct{})})
+	got := strings.Join(w.child.Command, " ")
+	if strings.Contains(got, testAnthropicKey) || !strings.Contains(got, "[REDACTED]") {
+		t.Errorf("Command = %q, want the key redacted", got)
+	}
+	if cmd.Args[2] != "ANTHROPIC_API_KEY="+testAnthropicKey+" true" {
+		t.Errorf("recordChildStart modified cmd.Args: %q", cmd.Args)
+	}
+}
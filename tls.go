@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// tlsOptions TLS相关配置
+type tlsOptions struct {
+	CertFile     string // 用户提供的证书
+	KeyFile      string // 用户提供的私钥
+	SelfSigned   bool   // 自动生成自签名证书
+	ClientCAFile string // 客户端证书CA，设置后启用mTLS
+	StateDir     string // 自签名证书保存目录
+	Host         string // 监听主机，写入证书SAN
+}
+
+// enabled 判断是否需要启用TLS
+func (o tlsOptions) enabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.SelfSigned || o.ClientCAFile != ""
+}
+
+// buildTLSConfig 根据配置构建TLS配置，未启用时返回nil
+func buildTLSConfig(opts tlsOptions) (*tls.Config, error) {
+	if !opts.enabled() {
+		return nil, nil
+	}
+
+	certFile, keyFile := opts.CertFile, opts.KeyFile
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("-tls-cert 和 -tls-key 必须同时指定")
+	}
+	if certFile == "" {
+		var err error
+		certFile, keyFile, err = ensureSelfSignedCert(filepath.Join(opts.StateDir, "tls"), opts.Host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("加载证书失败: %v", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if opts.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取客户端CA失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("客户端CA文件中没有有效证书: %s", opts.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// ensureSelfSignedCert 返回持久化的自签名证书，不存在或即将过期时重新生成
+func ensureSelfSignedCert(dir, host string) (certFile, keyFile string, err error) {
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil &&
+			time.Now().Add(7*24*time.Hour).Before(leaf.NotAfter) && certCovers(leaf, host) {
+			return certFile, keyFile, nil
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", fmt.Errorf("创建证书目录失败: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("生成私钥失败: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", fmt.Errorf("生成证书序列号失败: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"ClaudeWarp"}, CommonName: "claudewarp"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, name := range certHostnames(host) {
+		if ip := net.ParseIP(name); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, name)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return "", "", fmt.Errorf("生成自签名证书失败: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", fmt.Errorf("编码私钥失败: %v", err)
+	}
+
+	if err := writePEM(keyFile, "EC PRIVATE KEY", keyDER, 0600); err != nil {
+		return "", "", err
+	}
+	if err := writePEM(certFile, "CERTIFICATE", der, 0644); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+// certHostnames 自签名证书包含的主机名和IP
+func certHostnames(host string) []string {
+	names := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil {
+		names = append(names, hostname)
+	}
+	if host != "" && host != "0.0.0.0" && host != "::" {
+		names = append(names, host)
+	}
+
+	seen := make(map[string]bool)
+	result := names[:0]
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// certCovers 判断证书是否覆盖所有需要的主机名
+func certCovers(leaf *x509.Certificate, host string) bool {
+	for _, name := range certHostnames(host) {
+		if leaf.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// writePEM 写入PEM文件
+func writePEM(path, blockType string, der []byte, mode os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return fmt.Errorf("写入 %s 失败: %v", path, err)
+	}
+	return nil
+}
+
+// requestUser 返回请求的认证用户：Unix socket对端用户或mTLS客户端证书的CommonName
+func requestUser(r *http.Request) string {
+	if cred := peerCredFrom(r); cred != nil {
+		return cred.User()
+	}
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return r.TLS.PeerCertificates[0].Subject.CommonName
+}
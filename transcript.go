@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+const (
+	transcriptInterval     = time.Second // 读取Claude对话记录新增内容的间隔
+	transcriptReadLimit    = 4 << 20     // 每次最多读取的字节数，首次导入大文件时分多次完成
+	transcriptContentLimit = 8 << 10     // 单条消息内容的最大字节数，超出部分截断
+	transcriptHeadLimit    = 64 << 10    // 判断文件创建时间时读取的开头字节数
+)
+
+// transcriptEntry Claude对话记录（~/.claude/projects/<目录>/<会话ID>.jsonl）中的一行
+type transcriptEntry struct {
+	Type      string    `json:"type"` // user / assistant / summary / system ...
+	UUID      string    `json:"uuid"`
+	SessionID string    `json:"sessionId"`
+	Timestamp time.Time `json:"timestamp"`
+	IsMeta    bool      `json:"isMeta"` // Claude自动插入的元信息，不是真实的用户轮次
+	Message   struct {
+		ID      string               `json:"id"`
+		Model   string               `json:"model"`
+		Content json.RawMessage      `json:"content"` // 字符串或内容块数组
+		Usage   *protocol.TokenUsage `json:"usage"`
+	} `json:"message"`
+}
+
+// transcriptBlock 消息中的内容块
+type transcriptBlock struct {
+	Type      string          `json:"type"` // text / tool_use / tool_result / thinking
+	Text      string          `json:"text"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"` // tool_result：字符串或内容块数组
+	IsError   bool            `json:"is_error"`
+}
+
+// parseTranscriptLine 把对话记录中的一行转换为消息，非对话条目返回nil
+func parseTranscriptLine(line []byte) []Message {
+	var entry transcriptEntry
+	if err := json.Unmarshal(line, &entry); err != nil || entry.IsMeta {
+		return nil
+	}
+	if entry.Type != protocol.MessageUser && entry.Type != protocol.MessageAssistant {
+		return nil
+	}
+
+	base := Message{
+		Timestamp: entry.Timestamp,
+		SessionID: entry.SessionID,
+		UUID:      entry.UUID,
+		MessageID: entry.Message.ID,
+		Model:     entry.Message.Model,
+	}
+	if entry.Type == protocol.MessageAssistant {
+		base.Usage = entry.Message.Usage
+	}
+
+	var msgs []Message
+	for _, block := range contentBlocks(entry.Message.Content) {
+		msg := base
+		switch block.Type {
+		case "text":
+			if strings.TrimSpace(block.Text) == "" {
+				continue
+			}
+			msg.Type, msg.Content = entry.Type, block.Text
+		case "tool_use":
+			msg.Type, msg.Tool, msg.ToolUseID = protocol.MessageToolUse, block.Name, block.ID
+			msg.Content = block.Name + " " + string(block.Input)
+			if len(block.Input) <= transcriptContentLimit {
+				msg.ToolInput = block.Input
+			}
+		case "tool_result":
+			msg.Type, msg.ToolUseID, msg.IsError = protocol.MessageToolResult, block.ToolUseID, block.IsError
+			msg.Content = blocksText(contentBlocks(block.Content))
+		default:
+			continue
+		}
+		msg.Content = truncateText(msg.Content, transcriptContentLimit)
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// contentBlocks 解析内容，纯字符串视为一个文本块
+func contentBlocks(raw json.RawMessage) []transcriptBlock {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []transcriptBlock{{Type: "text", Text: text}}
+	}
+	var blocks []transcriptBlock
+	json.Unmarshal(raw, &blocks)
+	return blocks
+}
+
+// blocksText 拼接内容块中的文本
+func blocksText(blocks []transcriptBlock) string {
+	var parts []string
+	for _, block := range blocks {
+		if block.Type == "text" && block.Text != "" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// truncateText 按字节数截断文本，不切断UTF-8字符
+func truncateText(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "…（已截断）"
+}
+
+// transcriptTail 记录每个对话记录文件已读取到的位置
+type transcriptTail struct {
+	offsets map[string]int64
+	since   time.Time // 只导入此时间之后有更新的文件，避免导入与本次运行无关的旧会话
+}
+
+// read 读取文件新增的完整行并转换为消息
+func (t *transcriptTail) read(path string) ([]Message, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset, seen := t.offsets[path]
+	if !seen {
+		if info.ModTime().Before(t.since) {
+			return nil, nil
+		}
+		// 启动前已存在的文件（如恢复的会话）只导入之后新增的内容
+		if started := transcriptStarted(f); !started.IsZero() && started.Before(t.since) {
+			offset = info.Size()
+		}
+	}
+	if info.Size() < offset {
+		offset = 0 // 文件被截断或替换
+	}
+	if info.Size() == offset {
+		t.offsets[path] = offset
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(io.NewSectionReader(f, offset, info.Size()-offset), transcriptReadLimit))
+	if err != nil {
+		return nil, err
+	}
+	// 只处理完整的行，末尾未写完的行留到下次
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		if len(data) == transcriptReadLimit {
+			// 单行超过读取上限，跳过
+			t.offsets[path] = offset + int64(len(data))
+		}
+		return nil, nil
+	}
+	t.offsets[path] = offset + int64(end) + 1
+
+	var msgs []Message
+	for _, line := range bytes.Split(data[:end], []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			msgs = append(msgs, parseTranscriptLine(line)...)
+		}
+	}
+	return msgs, nil
+}
+
+// transcriptStarted 返回对话记录中第一条带时间的条目的时间，即文件的创建时间，读不到时返回零值
+func transcriptStarted(f *os.File) time.Time {
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, transcriptHeadLimit))
+	if err != nil {
+		return time.Time{}
+	}
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		var entry transcriptEntry
+		if json.Unmarshal(line, &entry) == nil && !entry.Timestamp.IsZero() {
+			return entry.Timestamp
+		}
+	}
+	return time.Time{}
+}
+
+// importTranscripts 持续读取当前Claude会话的对话记录，把对话轮次、工具调用和token用量加入消息历史
+func (w *ClaudeWarp) importTranscripts() {
+	tail := &transcriptTail{offsets: make(map[string]int64), since: w.metrics.startTime.Add(-transcriptSlack)}
+	failed := make(map[string]bool) // 每个文件只报告一次读取错误
+	ticker := time.NewTicker(transcriptInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rec := w.claudeSessions.get()
+		if rec == nil {
+			continue
+		}
+		path := rec.Transcript
+		if path == "" {
+			path = filepath.Join(claudeProjectDir(w.sessionProfile(), rec.Cwd), rec.ID+".jsonl")
+		}
+		msgs, err := tail.read(path)
+		if err != nil {
+			if !failed[path] {
+				failed[path] = true
+				w.addMessage(protocol.MessageError, "读取Claude对话记录失败: "+err.Error())
+			}
+			continue
+		}
+		delete(failed, path)
+		for _, msg := range msgs {
+			w.appendMessage(msg)
+		}
+		w.recordUsage(msgs)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// peerCred Unix socket对端进程凭据
+type peerCred struct {
+	PID int `json:"pid"`
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+}
+
+// User 返回对端用户名，无法解析时返回 uid:N
+func (c *peerCred) User() string {
+	if u, err := user.LookupId(strconv.Itoa(c.UID)); err == nil {
+		return u.Username
+	}
+	return fmt.Sprintf("uid:%d", c.UID)
+}
+
+// peerCredKey 连接上下文中保存对端凭据的键
+type peerCredKey struct{}
+
+// unixConnContext 为Unix socket连接读取对端凭据并保存到上下文
+func unixConnContext(ctx context.Context, c net.Conn) context.Context {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	cred, err := readPeerCred(uc)
+	if err != nil {
+		// 读取失败时记录一个不可能被允许的凭据，避免被当作TCP连接处理
+		cred = &peerCred{PID: -1, UID: -1, GID: -1}
+	}
+	return context.WithValue(ctx, peerCredKey{}, cred)
+}
+
+// peerCredFrom 返回请求的对端凭据，非Unix socket请求返回nil
+func peerCredFrom(r *http.Request) *peerCred {
+	cred, _ := r.Context().Value(peerCredKey{}).(*peerCred)
+	return cred
+}
+
+// requestTransport 返回请求的传输方式
+func requestTransport(r *http.Request) string {
+	switch {
+	case peerCredFrom(r) != nil:
+		return "unix"
+	case r.TLS != nil:
+		return "https"
+	}
+	return "http"
+}
+
+// listenUnix 监听Unix socket并设置权限与属主
+func listenUnix(cfg UnixConfig) (net.Listener, error) {
+	// 清理上次异常退出遗留的socket文件
+	if info, err := os.Lstat(cfg.Path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s 已存在且不是socket文件", cfg.Path)
+		}
+		if conn, err := net.Dial("unix", cfg.Path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s 正被其他进程监听", cfg.Path)
+		}
+		os.Remove(cfg.Path)
+	}
+
+	ln, err := net.Listen("unix", cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, _ := cfg.fileMode()
+	if err := os.Chmod(cfg.Path, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("设置socket权限失败: %v", err)
+	}
+	if cfg.Owner != "" {
+		uid, gid, err := parseOwner(cfg.Owner)
+		if err == nil {
+			err = os.Chown(cfg.Path, uid, gid)
+		}
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("设置socket属主失败: %v", err)
+		}
+	}
+	return ln, nil
+}
+
+// fileMode 解析八进制权限，默认0600
+func (c UnixConfig) fileMode() (os.FileMode, error) {
+	if c.Mode == "" {
+		return 0600, nil
+	}
+	v, err := strconv.ParseUint(c.Mode, 8, 32)
+	if err != nil || v > 0777 {
+		return 0, fmt.Errorf("unix.mode 必须是八进制权限（如 0660），当前为 %q", c.Mode)
+	}
+	return os.FileMode(v), nil
+}
+
+// parseOwner 解析 "用户[:组]"，用户和组可以是名称或数字ID，-1表示不修改
+func parseOwner(owner string) (int, int, error) {
+	userPart, groupPart, _ := strings.Cut(owner, ":")
+	uid, gid := -1, -1
+
+	if userPart != "" {
+		if id, err := strconv.Atoi(userPart); err == nil {
+			uid = id
+		} else if u, err := user.Lookup(userPart); err == nil {
+			uid, _ = strconv.Atoi(u.Uid)
+		} else {
+			return 0, 0, fmt.Errorf("未知用户 %q", userPart)
+		}
+	}
+	if groupPart != "" {
+		if id, err := strconv.Atoi(groupPart); err == nil {
+			gid = id
+		} else if g, err := user.LookupGroup(groupPart); err == nil {
+			gid, _ = strconv.Atoi(g.Gid)
+		} else {
+			return 0, 0, fmt.Errorf("未知用户组 %q", groupPart)
+		}
+	}
+	return uid, gid, nil
+}
+
+// peerAllowed 判断Unix socket对端是否允许发送输入，TCP请求不受此限制
+func (c UnixConfig) peerAllowed(cred *peerCred) bool {
+	if cred == nil {
+		return true
+	}
+	if len(c.AllowedUIDs) == 0 {
+		return cred.UID == os.Getuid()
+	}
+	for _, uid := range c.AllowedUIDs {
+		if cred.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// validate 校验Unix socket配置
+func (c UnixConfig) validate() []error {
+	var errs []error
+	if c.Only && c.Path == "" {
+		errs = append(errs, fmt.Errorf("unix.only 需要同时设置 unix.path"))
+	}
+	if _, err := c.fileMode(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Owner != "" {
+		if _, _, err := parseOwner(c.Owner); err != nil {
+			errs = append(errs, fmt.Errorf("unix.owner 无效: %v", err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+const (
+	usageDefaultDays = 30  // /api/usage 默认统计天数
+	usageMaxDays     = 366 // /api/usage 最多统计天数
+)
+
+// ModelPrice 模型价格，单位为美元/百万token
+type ModelPrice struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheWrite float64 `json:"cache_write"`
+	CacheRead  float64 `json:"cache_read"`
+}
+
+// defaultPrices 内置价格表，按模型名前缀匹配（最长前缀优先）
+var defaultPrices = map[string]ModelPrice{
+	"claude-opus-4-5":   {Input: 5, Output: 25, CacheWrite: 6.25, CacheRead: 0.5},
+	"claude-opus":       {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.5},
+	"claude-3-opus":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.5},
+	"claude-sonnet":     {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+	"claude-3-5-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+	"claude-haiku":      {Input: 1, Output: 5, CacheWrite: 1.25, CacheRead: 0.1},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+}
+
+// UsageBudget 费用预算
+type UsageBudget struct {
+	Name     string  `json:"name"`
+	Scope    string  `json:"scope"`  // session（默认）/ profile / all
+	Period   string  `json:"period"` // day（默认）/ month
+	LimitUSD float64 `json:"limit_usd"`
+	Action   string  `json:"action"` // warn（默认）/ pause
+}
+
+// UsageConfig token用量统计配置（支持SIGHUP热加载）
+type UsageConfig struct {
+	Prices  map[string]ModelPrice `json:"prices"`  // 模型名前缀 -> 价格，覆盖或补充内置价格表
+	Budgets []UsageBudget         `json:"budgets"` // 超出时提示或暂停任务队列
+}
+
+// validate 校验用量配置并补全默认值
+func (c *UsageConfig) validate() []error {
+	var errs []error
+	for model, price := range c.Prices {
+		if price.Input < 0 || price.Output < 0 || price.CacheWrite < 0 || price.CacheRead < 0 {
+			errs = append(errs, fmt.Errorf("usage.prices.%s 价格不能为负数", model))
+		}
+	}
+	seen := make(map[string]bool)
+	for i := range c.Budgets {
+		b := &c.Budgets[i]
+		if b.Name == "" {
+			errs = append(errs, fmt.Errorf("usage.budgets[%d].name 不能为空", i))
+		} else if seen[b.Name] {
+			errs = append(errs, fmt.Errorf("usage.budgets 名称重复: %s", b.Name))
+		}
+		seen[b.Name] = true
+		if b.Scope == "" {
+			b.Scope = protocol.BudgetScopeSession
+		}
+		if b.Period == "" {
+			b.Period = protocol.BudgetPeriodDay
+		}
+		if b.Action == "" {
+			b.Action = protocol.BudgetWarn
+		}
+		switch b.Scope {
+		case protocol.BudgetScopeSession, protocol.BudgetScopeProfile, protocol.BudgetScopeAll:
+		default:
+			errs = append(errs, fmt.Errorf("usage.budgets.%s.scope 必须是 session、profile 或 all", b.Name))
+		}
+		if b.Period != protocol.BudgetPeriodDay && b.Period != protocol.BudgetPeriodMonth {
+			errs = append(errs, fmt.Errorf("usage.budgets.%s.period 必须是 day 或 month", b.Name))
+		}
+		if b.Action != protocol.BudgetWarn && b.Action != protocol.BudgetPause {
+			errs = append(errs, fmt.Errorf("usage.budgets.%s.action 必须是 warn 或 pause", b.Name))
+		}
+		if b.LimitUSD <= 0 {
+			errs = append(errs, fmt.Errorf("usage.budgets.%s.limit_usd 必须大于0", b.Name))
+		}
+	}
+	return errs
+}
+
+// usageCount 某天某个模型的累计用量
+type usageCount struct {
+	protocol.TokenUsage
+	Requests int64 `json:"requests"`
+}
+
+// add 累加一次API调用
+func (c *usageCount) add(u protocol.TokenUsage) {
+	c.InputTokens += u.InputTokens
+	c.OutputTokens += u.OutputTokens
+	c.CacheCreationInputTokens += u.CacheCreationInputTokens
+	c.CacheReadInputTokens += u.CacheReadInputTokens
+	c.Requests++
+}
+
+// usageFile 保存在 <state_dir>/usage/<session>.json 的会话用量
+type usageFile struct {
+	Session string                            `json:"session"`
+	Profile string                            `json:"profile"`
+	Days    map[string]map[string]*usageCount `json:"days"` // 日期(本地时间) -> 模型 -> 用量
+	Last    map[string]time.Time              `json:"last"` // Claude会话ID -> 已统计的最后一条记录时间，重启后重新导入时避免重复计数
+}
+
+// usageTracker 统计本会话的token用量并检查预算
+type usageTracker struct {
+	mu       sync.Mutex
+	dir      string
+	file     usageFile
+	seen     map[string]bool // 本次运行已统计的API消息ID，同一回复拆成多条记录时只计一次
+	prices   map[string]ModelPrice
+	budgets  []UsageBudget
+	exceeded map[string]string // 预算名 -> 已处理超出的周期，每个周期只提示一次
+}
+
+// openUsageTracker 读取会话已有的用量记录
+func openUsageTracker(dir, session, profile string, cfg UsageConfig) (*usageTracker, error) {
+	t := &usageTracker{
+		dir:      dir,
+		seen:     make(map[string]bool),
+		exceeded: make(map[string]string),
+	}
+	if err := readJSONFile(filepath.Join(dir, session+".json"), &t.file); err != nil {
+		return nil, fmt.Errorf("读取用量记录失败: %v", err)
+	}
+	t.file.Session, t.file.Profile = session, profile
+	if t.file.Days == nil {
+		t.file.Days = make(map[string]map[string]*usageCount)
+	}
+	if t.file.Last == nil {
+		t.file.Last = make(map[string]time.Time)
+	}
+	t.update(cfg)
+	return t, nil
+}
+
+// update 应用价格表和预算配置
+func (t *usageTracker) update(cfg UsageConfig) {
+	prices := make(map[string]ModelPrice, len(defaultPrices)+len(cfg.Prices))
+	for model, price := range defaultPrices {
+		prices[model] = price
+	}
+	for model, price := range cfg.Prices {
+		prices[model] = price
+	}
+
+	t.mu.Lock()
+	t.prices = prices
+	t.budgets = append([]UsageBudget(nil), cfg.Budgets...)
+	t.mu.Unlock()
+}
+
+// record 统计对话记录中的一条消息，返回用量是否变化
+func (t *usageTracker) record(msg Message) bool {
+	if msg.Usage == nil || msg.MessageID == "" {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last := t.file.Last[msg.SessionID]
+	if t.seen[msg.MessageID] || !msg.Timestamp.After(last) {
+		if msg.Timestamp.After(last) {
+			t.file.Last[msg.SessionID] = msg.Timestamp
+		}
+		return false
+	}
+	t.seen[msg.MessageID] = true
+	t.file.Last[msg.SessionID] = msg.Timestamp
+
+	day := msg.Timestamp.Local().Format("2006-01-02")
+	models := t.file.Days[day]
+	if models == nil {
+		models = make(map[string]*usageCount)
+		t.file.Days[day] = models
+	}
+	model := msg.Model
+	if model == "" {
+		model = "unknown"
+	}
+	if models[model] == nil {
+		models[model] = &usageCount{}
+	}
+	models[model].add(*msg.Usage)
+	return true
+}
+
+// save 持久化本会话用量
+func (t *usageTracker) save() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := writeJSONFile(filepath.Join(t.dir, t.file.Session+".json"), t.file); err != nil {
+		return fmt.Errorf("保存用量记录失败: %v", err)
+	}
+	return nil
+}
+
+// priceFor 按最长前缀匹配模型价格
+func priceFor(prices map[string]ModelPrice, model string) (ModelPrice, bool) {
+	best, found := "", false
+	for prefix := range prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) >= len(best) {
+			best, found = prefix, true
+		}
+	}
+	return prices[best], found
+}
+
+// cost 按价格折算费用
+func (p ModelPrice) cost(c *usageCount) float64 {
+	return (float64(c.InputTokens)*p.Input + float64(c.OutputTokens)*p.Output +
+		float64(c.CacheCreationInputTokens)*p.CacheWrite + float64(c.CacheReadInputTokens)*p.CacheRead) / 1e6
+}
+
+// addTotals 把一个模型的用量累加到汇总中
+func addTotals(dst *protocol.UsageTotals, c *usageCount, cost float64) {
+	dst.InputTokens += c.InputTokens
+	dst.OutputTokens += c.OutputTokens
+	dst.CacheCreationInputTokens += c.CacheCreationInputTokens
+	dst.CacheReadInputTokens += c.CacheReadInputTokens
+	dst.Requests += c.Requests
+	dst.CostUSD += cost
+}
+
+// allFiles 返回所有会话的用量记录，本会话使用内存中的最新数据
+func (t *usageTracker) allFiles() []usageFile {
+	paths, _ := filepath.Glob(filepath.Join(t.dir, "*.json"))
+	files := []usageFile{t.file}
+	for _, path := range paths {
+		if filepath.Base(path) == t.file.Session+".json" {
+			continue
+		}
+		var f usageFile
+		if err := readJSONFile(path, &f); err == nil && f.Session != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// snapshot 汇总最近days天的用量及预算状态
+func (t *usageTracker) snapshot(days int, now time.Time) protocol.Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	u := protocol.Usage{Session: t.file.Session, Profile: t.file.Profile, Days: days}
+	from := now.AddDate(0, 0, -days+1).Format("2006-01-02")
+	today := now.Format("2006-01-02")
+	month := now.Format("2006-01")
+
+	sessions := make(map[string]*protocol.UsageTotals)
+	profiles := make(map[string]*protocol.UsageTotals)
+	daily := make(map[string]*protocol.UsageTotals)
+	models := make(map[string]*protocol.UsageTotals)
+	spent := make([]float64, len(t.budgets))
+	unpriced := make(map[string]bool)
+	group := func(m map[string]*protocol.UsageTotals, key string) *protocol.UsageTotals {
+		if m[key] == nil {
+			m[key] = &protocol.UsageTotals{}
+		}
+		return m[key]
+	}
+
+	for _, f := range t.allFiles() {
+		own := f.Session == t.file.Session
+		for day, byModel := range f.Days {
+			for model, c := range byModel {
+				price, ok := priceFor(t.prices, model)
+				if !ok {
+					unpriced[model] = true
+				}
+				cost := price.cost(c)
+				for i, b := range t.budgets {
+					inScope := b.Scope == protocol.BudgetScopeAll || (b.Scope == protocol.BudgetScopeSession && own) ||
+						(b.Scope == protocol.BudgetScopeProfile && f.Profile == t.file.Profile)
+					inPeriod := day == today || (b.Period == protocol.BudgetPeriodMonth && strings.HasPrefix(day, month))
+					if inScope && inPeriod {
+						spent[i] += cost
+					}
+				}
+				if own && day == today {
+					addTotals(&u.Today, c, cost)
+				}
+				if day < from {
+					continue
+				}
+				addTotals(&u.Total, c, cost)
+				addTotals(group(sessions, f.Session), c, cost)
+				addTotals(group(profiles, f.Profile), c, cost)
+				addTotals(group(daily, day), c, cost)
+				addTotals(group(models, model), c, cost)
+			}
+		}
+	}
+
+	u.Sessions = usageSummaries(sessions)
+	u.Profiles = usageSummaries(profiles)
+	u.Daily = usageSummaries(daily)
+	u.Models = usageSummaries(models)
+	for i, b := range t.budgets {
+		u.Budgets = append(u.Budgets, protocol.BudgetStatus{
+			Name:     b.Name,
+			Scope:    b.Scope,
+			Period:   b.Period,
+			LimitUSD: b.LimitUSD,
+			SpentUSD: spent[i],
+			Action:   b.Action,
+			Exceeded: spent[i] >= b.LimitUSD,
+		})
+	}
+	for model := range unpriced {
+		u.Unpriced = append(u.Unpriced, model)
+	}
+	sort.Strings(u.Unpriced)
+	return u
+}
+
+// usageSummaries 把分组结果按key排序
+func usageSummaries(m map[string]*protocol.UsageTotals) []protocol.UsageSummary {
+	list := make([]protocol.UsageSummary, 0, len(m))
+	for key, totals := range m {
+		list = append(list, protocol.UsageSummary{Key: key, UsageTotals: *totals})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// newlyExceeded 返回本周期内首次超出的预算
+func (t *usageTracker) newlyExceeded(budgets []protocol.BudgetStatus, now time.Time) []protocol.BudgetStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var list []protocol.BudgetStatus
+	for _, b := range budgets {
+		period := now.Format("2006-01-02")
+		if b.Period == protocol.BudgetPeriodMonth {
+			period = now.Format("2006-01")
+		}
+		if !b.Exceeded || t.exceeded[b.Name] == period {
+			continue
+		}
+		t.exceeded[b.Name] = period
+		list = append(list, b)
+	}
+	return list
+}
+
+// recordUsage 统计导入的对话记录消息，用量变化时保存、推送并检查预算
+func (w *ClaudeWarp) recordUsage(msgs []Message) {
+	changed := false
+	for _, msg := range msgs {
+		if w.usage.record(msg) {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := w.usage.save(); err != nil {
+		w.addMessage("error", err.Error())
+	}
+
+	now := time.Now()
+	usage := w.usage.snapshot(usageDefaultDays, now)
+	w.broadcastEvent(protocol.UsageEvent{Type: protocol.EventUsage, Usage: usage})
+	for _, b := range w.usage.newlyExceeded(usage.Budgets, now) {
+		w.onBudgetExceeded(b)
+	}
+}
+
+// onBudgetExceeded 预算超出时提示、通知，并按配置暂停任务队列
+func (w *ClaudeWarp) onBudgetExceeded(b protocol.BudgetStatus) {
+	w.addMessage("error", fmt.Sprintf("💰 预算 %s 已超出：%s内 $%.2f / $%.2f", b.Name, budgetPeriodLabel(b.Period), b.SpentUSD, b.LimitUSD))
+	w.notifier.notifyBudget(b)
+	if b.Action != protocol.BudgetPause {
+		return
+	}
+	if err := w.queue.setPaused(true); err != nil {
+		w.addMessage("error", fmt.Sprintf("暂停任务队列失败: %v", err))
+		return
+	}
+	w.broadcastQueue()
+	w.addMessage("output", "⏸️ 超出预算，任务队列已暂停，可在Web界面或 POST /api/queue/resume 恢复")
+}
+
+// budgetPeriodLabel 预算周期的显示名
+func budgetPeriodLabel(period string) string {
+	if period == protocol.BudgetPeriodMonth {
+		return "本月"
+	}
+	return "今日"
+}
+
+// handleUsage 处理用量查询：GET /api/usage?days=30
+func (w *ClaudeWarp) handleUsage(wr http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(wr, "仅支持GET方法", http.StatusMethodNotAllowed)
+		return
+	}
+	days := usageDefaultDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > usageMaxDays {
+			http.Error(wr, fmt.Sprintf("days 必须是 1-%d 之间的整数", usageMaxDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	data, _ := json.Marshal(w.usage.snapshot(days, time.Now()))
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+//go:generate sh web/fetch-vendor.sh
+
+//go:embed web/index.html web/static
+var webFS embed.FS
+
+// 前端依赖的CDN地址，仅在未内置且启用 web.cdn（默认开启）时使用，版本与 web/fetch-vendor.sh 一致
+const (
+	xtermCDN    = "https://cdn.jsdelivr.net/npm/xterm@5.3.0"
+	xtermFitCDN = "https://cdn.jsdelivr.net/npm/xterm-addon-fit@0.8.0"
+	hljsCDN     = "https://cdn.jsdelivr.net/gh/highlightjs/cdn-release@11.9.0/build"
+)
+
+var (
+	staticFS      fs.FS              // 静态文件（web/static）
+	staticVersion string             // 静态文件内容哈希，用于带版本的URL
+	indexTemplate *template.Template // 主页模板
+)
+
+func init() {
+	var err error
+	staticFS, err = fs.Sub(webFS, "web/static")
+	if err != nil {
+		panic(err)
+	}
+	staticVersion = hashFS(staticFS)
+	indexTemplate = template.Must(template.ParseFS(webFS, "web/index.html"))
+}
+
+// indexData 主页模板参数
+type indexData struct {
+	Static   string // 带版本的静态文件前缀
+	XtermJS  string
+	XtermCSS string
+	FitJS    string
+	HljsJS   string // 文件浏览的语法高亮
+	HljsCSS  string
+}
+
+// hashFS 计算文件系统中所有文件内容的哈希
+func hashFS(fsys fs.FS) string {
+	var paths []string
+	fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, path := range paths {
+		data, _ := fs.ReadFile(fsys, path)
+		h.Write([]byte(path))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// vendorFiles 前端依赖文件（由 web/fetch-vendor.sh 下载到 web/static/vendor）
+var vendorFiles = []string{
+	"xterm.min.js",
+	"xterm.min.css",
+	"xterm-addon-fit.min.js",
+	"highlight.min.js",
+	"highlight-vs2015.min.css",
+}
+
+// missingVendorFiles 返回未内置的前端依赖
+func missingVendorFiles() []string {
+	var missing []string
+	for _, name := range vendorFiles {
+		if _, err := fs.Stat(staticFS, "vendor/"+name); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// vendorURL 返回内置依赖的URL；未内置且允许CDN时返回CDN地址
+func vendorURL(static, name, cdn string, allowCDN bool) string {
+	if _, err := fs.Stat(staticFS, "vendor/"+name); err != nil && allowCDN {
+		return cdn
+	}
+	return static + "/vendor/" + name
+}
+
+// newIndexData 生成主页模板参数，cdn为是否允许未内置的依赖从CDN加载
+func newIndexData(cdn bool) indexData {
+	static := "/static/" + staticVersion
+	return indexData{
+		Static:   static,
+		XtermJS:  vendorURL(static, "xterm.min.js", xtermCDN+"/lib/xterm.min.js", cdn),
+		XtermCSS: vendorURL(static, "xterm.min.css", xtermCDN+"/css/xterm.min.css", cdn),
+		FitJS:    vendorURL(static, "xterm-addon-fit.min.js", xtermFitCDN+"/lib/xterm-addon-fit.min.js", cdn),
+		HljsJS:   vendorURL(static, "highlight.min.js", hljsCDN+"/highlight.min.js", cdn),
+		HljsCSS:  vendorURL(static, "highlight-vs2015.min.css", hljsCDN+"/styles/vs2015.min.css", cdn),
+	}
+}
+
+// handleIndex 处理主页
+func (w *ClaudeWarp) handleIndex(wr http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(wr, r)
+		return
+	}
+
+	data := newIndexData(w.config().Web.CDN)
+	var buf bytes.Buffer
+	if err := indexTemplate.Execute(&buf, data); err != nil {
+		log.Printf("渲染主页失败: %v", err)
+		http.Error(wr, "渲染主页失败", http.StatusInternalServerError)
+		return
+	}
+	wr.Header().Set("Content-Type", "text/html; charset=utf-8")
+	wr.Header().Set("Cache-Control", "no-cache")
+	wr.Write(buf.Bytes())
+}
+
+// handleStatic 处理 /static/<版本>/<文件>，版本匹配时允许长期缓存
+func (w *ClaudeWarp) handleStatic(wr http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/static/")
+	version, name, ok := strings.Cut(rest, "/")
+	if !ok || name == "" {
+		http.NotFound(wr, r)
+		return
+	}
+
+	if version == staticVersion {
+		wr.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		wr.Header().Set("Cache-Control", "no-cache")
+	}
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = "/" + name
+	http.FileServer(http.FS(staticFS)).ServeHTTP(wr, r2)
+}
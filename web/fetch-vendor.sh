@@ -0,0 +1,19 @@
+#!/bin/sh
+# 下载前端依赖到 web/static/vendor，提交后二进制即可离线使用Web界面
+set -e
+
+cd "$(dirname "$0")/static/vendor"
+
+XTERM_VERSION=5.3.0
+FIT_VERSION=0.8.0
+HLJS_VERSION=11.9.0
+CDN=https://cdn.jsdelivr.net/npm
+GH_CDN=https://cdn.jsdelivr.net/gh
+
+curl -fsSL -o xterm.min.js "$CDN/xterm@$XTERM_VERSION/lib/xterm.min.js"
+curl -fsSL -o xterm.min.css "$CDN/xterm@$XTERM_VERSION/css/xterm.min.css"
+curl -fsSL -o xterm-addon-fit.min.js "$CDN/xterm-addon-fit@$FIT_VERSION/lib/xterm-addon-fit.min.js"
+curl -fsSL -o highlight.min.js "$GH_CDN/highlightjs/cdn-release@$HLJS_VERSION/build/highlight.min.js"
+curl -fsSL -o highlight-vs2015.min.css "$GH_CDN/highlightjs/cdn-release@$HLJS_VERSION/build/styles/vs2015.min.css"
+
+echo "已更新 xterm@$XTERM_VERSION、xterm-addon-fit@$FIT_VERSION 与 highlight.js@$HLJS_VERSION"
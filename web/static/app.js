@@ -0,0 +1,904 @@
+const terminalContainer = document.getElementById('terminal-container');
+const terminalDiv = document.getElementById('terminal');
+const inputBox = document.getElementById('inputBox');
+const sendBtn = document.getElementById('sendBtn');
+const newlineCheckbox = document.getElementById('newlineCheckbox');
+const statusDiv = document.getElementById('status');
+const sessionStateSpan = document.getElementById('sessionState');
+const notifyBtn = document.getElementById('notifyBtn');
+const resumeBtn = document.getElementById('resumeBtn');
+const modeSelect = document.getElementById('modeSelect');
+const worktreeInfo = document.getElementById('worktreeInfo');
+const worktreePanel = document.getElementById('worktreePanel');
+const worktreeSummary = document.getElementById('worktreeSummary');
+const inputStatus = document.getElementById('inputStatus');
+const commandSuggestions = document.getElementById('commandSuggestions');
+const pendingPanel = document.getElementById('pendingPanel');
+const pendingList = document.getElementById('pendingList');
+const respondersPanel = document.getElementById('respondersPanel');
+const queuePauseBtn = document.getElementById('queuePauseBtn');
+const queueInput = document.getElementById('queueInput');
+const queueAddBtn = document.getElementById('queueAddBtn');
+const queueList = document.getElementById('queueList');
+const queueHistory = document.getElementById('queueHistory');
+const respondersList = document.getElementById('respondersList');
+const schedulesLeader = document.getElementById('schedulesLeader');
+const scheduleName = document.getElementById('scheduleName');
+const scheduleKind = document.getElementById('scheduleKind');
+const scheduleWhen = document.getElementById('scheduleWhen');
+const scheduleTarget = document.getElementById('scheduleTarget');
+const schedulePrompt = document.getElementById('schedulePrompt');
+const scheduleAddBtn = document.getElementById('scheduleAddBtn');
+const schedulesList = document.getElementById('schedulesList');
+const scheduleRuns = document.getElementById('scheduleRuns');
+const usageToday = document.getElementById('usageToday');
+const workspacePanel = document.getElementById('workspacePanel');
+const workspaceBranch = document.getElementById('workspaceBranch');
+const workspaceFiles = document.getElementById('workspaceFiles');
+const workspaceDiff = document.getElementById('workspaceDiff');
+const checkpointsList = document.getElementById('checkpointsList');
+const checkpointDiff = document.getElementById('checkpointDiff');
+const filesPath = document.getElementById('filesPath');
+const filesList = document.getElementById('filesList');
+const fileView = document.getElementById('fileView');
+const fileMeta = document.getElementById('fileMeta');
+const fileDownload = document.getElementById('fileDownload');
+const fileContent = document.getElementById('fileContent');
+const usageBudgets = document.getElementById('usageBudgets');
+const usageGroups = document.getElementById('usageGroups');
+
+const stateLabels = {
+    running: '运行中',
+    idle: '空闲，等待输入',
+    awaiting_approval: '等待确认',
+    rate_limited: '用量已达上限',
+    exited: '已退出',
+};
+
+function notify(title, body) {
+    if (!('Notification' in window) || Notification.permission !== 'granted') return;
+    if (!document.hidden) return;
+    new Notification(title, { body: body });
+}
+
+function updateNotifyBtn() {
+    if (!('Notification' in window) || Notification.permission !== 'default') {
+        notifyBtn.style.display = 'none';
+    }
+}
+
+notifyBtn.addEventListener('click', function() {
+    Notification.requestPermission().then(updateNotifyBtn);
+});
+updateNotifyBtn();
+
+let claudeSession = null;
+let currentState = null;
+
+// renderClaudeSession 识别到Claude会话ID后显示恢复按钮
+function renderClaudeSession(session) {
+    claudeSession = session;
+    resumeBtn.hidden = !session;
+    if (session) resumeBtn.title = 'claude --resume ' + session.id + '（' + session.cwd + '）';
+}
+
+resumeBtn.addEventListener('click', function() {
+    if (!claudeSession) return;
+    if (currentState !== 'exited' && !confirm('Claude仍在运行，确定结束当前进程并恢复会话 ' + claudeSession.id + '？')) return;
+    fetch('/api/resume', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify({ session_id: claudeSession.id })
+    }).then(function(resp) {
+        if (resp.ok) return;
+        return resp.text().then(function(text) {
+            inputStatus.textContent = '❌ 恢复会话失败: ' + text.trim();
+            inputStatus.className = 'input-status denied';
+        });
+    });
+});
+
+let worktree = null;
+const worktreeLabels = { active: '使用中', merged: '已合并', kept: '已保留', removed: '已删除' };
+
+// renderWorktree 显示会话worktree，Claude退出后提供合并、保留、删除选项
+function renderWorktree(wt) {
+    worktree = wt || worktree;
+    if (!worktree) return;
+    worktreeInfo.hidden = false;
+    worktreeInfo.textContent = '🌿 ' + worktree.branch + '（' + (worktreeLabels[worktree.status] || worktree.status) + '）';
+    worktreeInfo.title = worktree.path;
+    worktreePanel.hidden = !(worktree.status === 'active' && currentState === 'exited');
+    worktreeSummary.textContent = worktree.path + ' · 基于 ' + (worktree.base_branch || worktree.base.slice(0, 8));
+}
+
+worktreePanel.querySelectorAll('button').forEach(function(btn) {
+    btn.addEventListener('click', function() {
+        const action = btn.getAttribute('data-action');
+        if (action !== 'keep' && !confirm(btn.textContent + '？')) return;
+        fetch('/api/worktree', {
+            method: 'POST',
+            headers: {'Content-Type': 'application/json'},
+            body: JSON.stringify({ action: action })
+        }).then(function(resp) {
+            if (!resp.ok) return resp.text().then(function(t) { alert(t); });
+        });
+    });
+});
+
+let currentMode = '';
+
+function showMode(mode) {
+    if (!mode) return;
+    currentMode = mode;
+    modeSelect.hidden = false;
+    modeSelect.value = mode;
+}
+
+modeSelect.addEventListener('change', function() {
+    const target = modeSelect.value;
+    if (!ws || ws.readyState !== WebSocket.OPEN) {
+        modeSelect.value = currentMode;
+        return;
+    }
+    modeSelect.disabled = true;
+    wsRequest({ type: 'mode', mode: target }, function(result) {
+        modeSelect.disabled = false;
+        if (result.error) {
+            inputStatus.textContent = '❌ 切换模式失败: ' + result.error;
+            inputStatus.className = 'input-status denied';
+            modeSelect.value = currentMode;
+            return;
+        }
+        showMode(result.mode);
+    });
+});
+
+let resetTimer = null;
+
+// showResetCountdown 在 rate_limited 状态下显示距离用量重置的时间
+function showResetCountdown(label, resetAt) {
+    const update = function() {
+        const minutes = Math.max(0, Math.ceil((new Date(resetAt) - new Date()) / 60000));
+        const left = minutes >= 60 ? Math.floor(minutes / 60) + '小时' + (minutes % 60) + '分钟' : minutes + '分钟';
+        sessionStateSpan.textContent = label + '，' + left + '后重置（' + new Date(resetAt).toLocaleTimeString() + '）';
+    };
+    update();
+    resetTimer = setInterval(update, 30000);
+}
+
+function handleState(data) {
+    clearInterval(resetTimer);
+    currentState = data.state;
+    showMode(data.mode);
+    sessionStateSpan.textContent = stateLabels[data.state] || data.state;
+    sessionStateSpan.className = 'state-' + data.state;
+    renderWorktree(null);
+    if (data.state === 'rate_limited' && data.reset_at) {
+        showResetCountdown(sessionStateSpan.textContent, data.reset_at);
+    }
+    // 仅在状态变化时通知，连接时的初始状态不通知
+    if (data.previous && data.state !== 'running') {
+        notify('ClaudeWarp: ' + (stateLabels[data.state] || data.state), 'Claude会话状态已变化');
+    }
+}
+
+const term = new Terminal({
+    cursorBlink: true,
+    fontSize: 14,
+    fontFamily: 'Menlo, "DejaVu Sans Mono", Consolas, "Lucida Console", monospace',
+    theme: {
+        background: '#0c0c0c',
+        foreground: '#d4d4d4',
+        cursor: '#d4d4d4',
+    },
+    rows: 30, // Default, will be adjusted by fit addon
+    convertEol: true, // Automatically convert \n to \r\n
+});
+
+const fitAddon = new FitAddon.FitAddon();
+term.loadAddon(fitAddon);
+term.open(terminalDiv);
+
+function fitTerminal() {
+    try {
+        fitAddon.fit();
+    } catch (e) {
+        console.error("Fit addon error:", e);
+    }
+}
+
+window.addEventListener('load', fitTerminal);
+window.addEventListener('resize', fitTerminal);
+
+const decisionLabels = {
+    queued: '已排队',
+    allowed: '已发送',
+    denied: '已拒绝',
+    held: '等待其他用户审批',
+    approved: '已审批并发送',
+    rejected: '审批被拒绝',
+    expired: '审批超时',
+};
+
+// 本页面发送的输入ID，用于显示后续审批结果
+const myInputs = new Set();
+// 经WebSocket发出、等待直接回复的请求：ref -> 回调
+const wsReplies = new Map();
+let wsRef = 0;
+
+// wsRequest 经WebSocket发送请求，服务端据此把来源记为 web
+function wsRequest(req, callback) {
+    req.ref = String(++wsRef);
+    wsReplies.set(req.ref, callback);
+    ws.send(JSON.stringify(req));
+}
+
+// takeReply 取出带ref的直接回复对应的回调
+function takeReply(data) {
+    if (!data.ref || !wsReplies.has(data.ref)) return null;
+    const callback = wsReplies.get(data.ref);
+    wsReplies.delete(data.ref);
+    return callback;
+}
+
+function showDecision(decision) {
+    let text = (decisionLabels[decision.decision] || decision.decision);
+    if (decision.rule && decision.rule !== 'default') text += '（规则 ' + decision.rule + '）';
+    if (decision.by) text += ' by ' + decision.by;
+    if (decision.reason) text += ': ' + decision.reason;
+    inputStatus.textContent = text;
+    inputStatus.className = 'input-status ' + decision.decision;
+}
+
+function renderPending(items) {
+    pendingList.innerHTML = '';
+    pendingPanel.hidden = !items || items.length === 0;
+    (items || []).forEach(function(item) {
+        const li = document.createElement('li');
+        const code = document.createElement('code');
+        code.textContent = item.input;
+        const meta = document.createElement('span');
+        meta.className = 'pending-meta';
+        meta.textContent = (item.user || item.remote_addr) + ' · ' + item.rule;
+        li.appendChild(code);
+        li.appendChild(meta);
+        ['approve', 'reject'].forEach(function(action) {
+            const btn = document.createElement('button');
+            btn.className = 'send-btn';
+            btn.textContent = action === 'approve' ? '批准' : '拒绝';
+            btn.addEventListener('click', function() {
+                fetch('/api/input/pending/' + item.id + '/' + action, { method: 'POST' })
+                    .then(function(resp) {
+                        if (!resp.ok) return resp.text().then(function(t) { alert(t); });
+                    });
+            });
+            li.appendChild(btn);
+        });
+        pendingList.appendChild(li);
+    });
+}
+
+function loadPending() {
+    fetch('/api/input/pending')
+        .then(function(resp) { return resp.json(); })
+        .then(renderPending)
+        .catch(function() {});
+}
+
+function renderResponders(items) {
+    respondersList.innerHTML = '';
+    respondersPanel.hidden = !items || items.length === 0;
+    (items || []).forEach(function(item) {
+        const li = document.createElement('li');
+        const toggle = document.createElement('input');
+        toggle.type = 'checkbox';
+        toggle.checked = item.enabled;
+        toggle.title = item.enabled ? '点击禁用' : '点击启用';
+        toggle.addEventListener('change', function() {
+            const action = toggle.checked ? 'enable' : 'disable';
+            fetch('/api/responders/' + encodeURIComponent(item.name) + '/' + action, { method: 'POST' })
+                .then(function(resp) {
+                    if (!resp.ok) {
+                        toggle.checked = !toggle.checked;
+                        return resp.text().then(function(t) { alert(t); });
+                    }
+                });
+        });
+        const name = document.createElement('code');
+        name.textContent = item.name;
+        const meta = document.createElement('span');
+        meta.className = 'pending-meta';
+        let text = (item.prompt ? '提示 ' + item.prompt : '') + (item.match ? ' /' + item.match + '/' : '');
+        text += ' · 已触发 ' + item.fires + (item.max_fires ? '/' + item.max_fires : '') + ' 次';
+        if (item.expired) text += ' · 已失效';
+        meta.textContent = text;
+        li.appendChild(toggle);
+        li.appendChild(name);
+        li.appendChild(meta);
+        respondersList.appendChild(li);
+    });
+}
+
+function loadResponders() {
+    fetch('/api/responders')
+        .then(function(resp) { return resp.json(); })
+        .then(renderResponders)
+        .catch(function() {});
+}
+
+const taskLabels = {
+    pending: '排队中',
+    running: '执行中',
+    done: '已完成',
+    failed: '失败',
+    cancelled: '已取消',
+};
+
+let queuePaused = false;
+
+function queueAction(path, body) {
+    return fetch('/api/queue' + path, {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: body ? JSON.stringify(body) : undefined,
+    }).then(function(resp) {
+        if (!resp.ok) return resp.text().then(function(t) { alert(t); });
+    });
+}
+
+function queueButton(label, onClick) {
+    const btn = document.createElement('button');
+    btn.className = 'notify-btn';
+    btn.textContent = label;
+    btn.addEventListener('click', onClick);
+    return btn;
+}
+
+function queueEntry(item) {
+    const li = document.createElement('li');
+    const code = document.createElement('code');
+    code.textContent = item.prompt;
+    const meta = document.createElement('span');
+    meta.className = 'pending-meta task-' + item.status;
+    let text = taskLabels[item.status] || item.status;
+    if (item.reason) text += ': ' + item.reason;
+    if (item.started_at && item.finished_at) {
+        text += ' · ' + Math.round((new Date(item.finished_at) - new Date(item.started_at)) / 1000) + 's';
+    }
+    meta.textContent = text;
+    li.appendChild(code);
+    li.appendChild(meta);
+    return li;
+}
+
+function renderQueue(queue) {
+    queuePaused = queue.paused;
+    queuePauseBtn.textContent = queuePaused ? '▶️ 恢复' : '⏸️ 暂停';
+    queueList.innerHTML = '';
+    const pending = (queue.items || []).filter(function(item) { return item.status === 'pending'; });
+    (queue.items || []).forEach(function(item) {
+        const li = queueEntry(item);
+        if (item.status === 'pending') {
+            const pos = pending.indexOf(item);
+            if (pos > 0) li.appendChild(queueButton('↑', function() { queueAction('/' + item.id + '/move', { position: pos - 1 }); }));
+            if (pos < pending.length - 1) li.appendChild(queueButton('↓', function() { queueAction('/' + item.id + '/move', { position: pos + 1 }); }));
+            li.appendChild(queueButton('取消', function() { queueAction('/' + item.id + '/cancel'); }));
+        } else {
+            li.appendChild(queueButton('输出', function() { window.open('/api/queue/' + item.id + '/output'); }));
+        }
+        queueList.appendChild(li);
+    });
+    queueHistory.innerHTML = '';
+    (queue.history || []).slice(0, 20).forEach(function(item) {
+        const li = queueEntry(item);
+        if (item.started_at) {
+            li.appendChild(queueButton('输出', function() { window.open('/api/queue/' + item.id + '/output'); }));
+        }
+        queueHistory.appendChild(li);
+    });
+}
+
+function loadQueue() {
+    fetch('/api/queue')
+        .then(function(resp) { return resp.json(); })
+        .then(renderQueue)
+        .catch(function() {});
+}
+
+queuePauseBtn.addEventListener('click', function() {
+    queueAction(queuePaused ? '/resume' : '/pause');
+});
+
+queueAddBtn.addEventListener('click', function() {
+    const prompt = queueInput.value.trim();
+    if (!prompt) return;
+    queueAction('', { prompt: prompt }).then(function() { queueInput.value = ''; });
+});
+
+function scheduleAction(path, body) {
+    return fetch('/api/schedules' + path, {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: body ? JSON.stringify(body) : undefined,
+    }).then(function(resp) {
+        if (!resp.ok) return resp.text().then(function(t) { alert(t); return false; });
+        return true;
+    });
+}
+
+function formatTime(value) {
+    return value ? new Date(value).toLocaleString() : '-';
+}
+
+function renderSchedules(schedules) {
+    schedulesLeader.textContent = schedules.leader ? '由本会话执行' : '由同一状态目录下的其他进程执行';
+    schedulesList.innerHTML = '';
+    (schedules.jobs || []).forEach(function(job) {
+        const li = document.createElement('li');
+        const code = document.createElement('code');
+        code.textContent = job.name + ': ' + job.prompt;
+        const meta = document.createElement('span');
+        meta.className = 'pending-meta';
+        const when = job.cron ? job.cron : '一次性 ' + formatTime(job.at);
+        const target = job.session || ('profile ' + job.profile);
+        meta.textContent = when + ' → ' + target + ' · 下次 ' + formatTime(job.next) + ' · 上次 ' + formatTime(job.last_run);
+        li.appendChild(code);
+        li.appendChild(meta);
+        li.appendChild(queueButton('立即执行', function() { scheduleAction('/' + job.name + '/run'); }));
+        if (job.origin === 'api') {
+            li.appendChild(queueButton('删除', function() { scheduleAction('/' + job.name + '/delete'); }));
+        }
+        schedulesList.appendChild(li);
+    });
+    scheduleRuns.innerHTML = '';
+    (schedules.runs || []).forEach(function(run) {
+        const li = document.createElement('li');
+        const code = document.createElement('code');
+        code.textContent = formatTime(run.at) + ' ' + run.job;
+        const meta = document.createElement('span');
+        meta.className = 'pending-meta task-' + (run.status === 'delivered' ? 'done' : 'failed');
+        let text = run.status === 'delivered' ? '已加入 ' + run.session + ' 的队列' : '失败: ' + run.error;
+        if (run.started) text += '（新启动会话）';
+        meta.textContent = text;
+        li.appendChild(code);
+        li.appendChild(meta);
+        scheduleRuns.appendChild(li);
+    });
+}
+
+function loadSchedules() {
+    fetch('/api/schedules')
+        .then(function(resp) { return resp.json(); })
+        .then(renderSchedules)
+        .catch(function() {});
+}
+
+scheduleKind.addEventListener('change', function() {
+    scheduleWhen.placeholder = scheduleKind.value === 'cron' ? '0 9 * * 1-5' : '2h';
+});
+
+scheduleAddBtn.addEventListener('click', function() {
+    const job = { name: scheduleName.value.trim(), prompt: schedulePrompt.value.trim() };
+    job[scheduleKind.value] = scheduleWhen.value.trim();
+    if (scheduleTarget.value.trim()) job.session = scheduleTarget.value.trim();
+    if (!job.name || !job.prompt || !job[scheduleKind.value]) return;
+    scheduleAction('', job).then(function(ok) {
+        if (!ok) return;
+        scheduleName.value = '';
+        scheduleWhen.value = '';
+        schedulePrompt.value = '';
+    });
+});
+
+// formatTokens 以 k/M 为单位显示token数
+function formatTokens(n) {
+    if (n >= 1e6) return (n / 1e6).toFixed(1) + 'M';
+    if (n >= 1e3) return (n / 1e3).toFixed(1) + 'k';
+    return String(n);
+}
+
+function formatUsage(totals) {
+    return '$' + totals.cost_usd.toFixed(2) + ' · 输入 ' + formatTokens(totals.input_tokens) +
+        ' · 输出 ' + formatTokens(totals.output_tokens) +
+        ' · 缓存写/读 ' + formatTokens(totals.cache_creation_input_tokens) + '/' + formatTokens(totals.cache_read_input_tokens) +
+        ' · ' + totals.requests + '次调用';
+}
+
+function renderUsage(usage) {
+    usageToday.textContent = '本会话今日 ' + formatUsage(usage.today);
+    usageBudgets.innerHTML = '';
+    (usage.budgets || []).forEach(function(budget) {
+        const li = document.createElement('li');
+        const code = document.createElement('code');
+        code.textContent = budget.name + '（' + budget.scope + ' / ' + (budget.period === 'month' ? '每月' : '每日') + '）';
+        const meta = document.createElement('span');
+        meta.className = 'pending-meta task-' + (budget.exceeded ? 'failed' : 'done');
+        meta.textContent = '$' + budget.spent_usd.toFixed(2) + ' / $' + budget.limit_usd.toFixed(2) +
+            (budget.exceeded ? (budget.action === 'pause' ? ' · 已超出，队列已暂停' : ' · 已超出') : '');
+        li.appendChild(code);
+        li.appendChild(meta);
+        usageBudgets.appendChild(li);
+    });
+    usageGroups.innerHTML = '';
+    const groups = [['合计', [Object.assign({ key: '全部会话' }, usage.total)]], ['会话', usage.sessions], ['Profile', usage.profiles], ['模型', usage.models], ['日期', (usage.daily || []).slice().reverse()]];
+    groups.forEach(function(group) {
+        (group[1] || []).forEach(function(item) {
+            const li = document.createElement('li');
+            const code = document.createElement('code');
+            code.textContent = group[0] + ' ' + item.key;
+            const meta = document.createElement('span');
+            meta.className = 'pending-meta';
+            meta.textContent = formatUsage(item);
+            li.appendChild(code);
+            li.appendChild(meta);
+            usageGroups.appendChild(li);
+        });
+    });
+    if (usage.unpriced && usage.unpriced.length) {
+        const li = document.createElement('li');
+        li.className = 'pending-meta';
+        li.textContent = '⚠️ 以下模型没有价格，费用按0计: ' + usage.unpriced.join(', ');
+        usageGroups.appendChild(li);
+    }
+}
+
+function loadUsage() {
+    fetch('/api/usage')
+        .then(function(resp) { return resp.json(); })
+        .then(renderUsage)
+        .catch(function() {});
+}
+
+const fileStatusLabels = { modified: 'M', added: 'A', deleted: 'D', untracked: '?' };
+let selectedWorkspaceFile = '';
+
+function renderWorkspace(ws) {
+    const show = !!ws.root;
+    if (workspacePanel.hidden === show) {
+        workspacePanel.hidden = !show;
+        fitTerminal();
+    }
+    if (!show) return;
+    workspaceBranch.textContent = (ws.branch || '分离HEAD') + (ws.head ? ' @ ' + ws.head.slice(0, 8) : '') +
+        ' · ' + ws.files.length + ' 个文件' + (ws.error ? ' · ⚠️ ' + ws.error : '');
+    workspaceFiles.innerHTML = '';
+    ws.files.forEach(function(f) {
+        const li = document.createElement('li');
+        li.className = f.path === selectedWorkspaceFile ? 'selected' : '';
+        const code = document.createElement('code');
+        code.textContent = fileStatusLabels[f.status] + ' ' + f.path;
+        const meta = document.createElement('span');
+        meta.className = 'pending-meta';
+        meta.textContent = f.binary ? '二进制' : '+' + f.additions + ' -' + f.deletions;
+        li.appendChild(code);
+        li.appendChild(meta);
+        li.addEventListener('click', function() {
+            selectedWorkspaceFile = f.path === selectedWorkspaceFile ? '' : f.path;
+            renderWorkspace(ws);
+        });
+        workspaceFiles.appendChild(li);
+    });
+    if (selectedWorkspaceFile && !ws.files.some(function(f) { return f.path === selectedWorkspaceFile; })) {
+        selectedWorkspaceFile = '';
+    }
+    loadWorkspaceDiff();
+}
+
+function loadWorkspaceDiff() {
+    if (!selectedWorkspaceFile) {
+        workspaceDiff.textContent = '';
+        return;
+    }
+    fetch('/api/workspace/changes?path=' + encodeURIComponent(selectedWorkspaceFile))
+        .then(function(resp) { return resp.ok ? resp.json() : null; })
+        .then(function(ws) {
+            if (ws) renderDiff(workspaceDiff, ws.diff || '', ws.truncated);
+        })
+        .catch(function() {});
+}
+
+// renderDiff 按行着色统一格式diff
+function renderDiff(el, diff, truncated) {
+    el.innerHTML = '';
+    diff.split('\n').forEach(function(line) {
+        const span = document.createElement('span');
+        if (line.indexOf('@@') === 0) {
+            span.className = 'diff-hunk';
+        } else if (line.indexOf('+++') === 0 || line.indexOf('---') === 0 || line.indexOf('diff ') === 0) {
+            span.className = 'diff-meta';
+        } else if (line.charAt(0) === '+') {
+            span.className = 'diff-add';
+        } else if (line.charAt(0) === '-') {
+            span.className = 'diff-del';
+        }
+        span.textContent = line + '\n';
+        el.appendChild(span);
+    });
+    if (truncated) {
+        const span = document.createElement('span');
+        span.className = 'diff-meta';
+        span.textContent = '…（diff过长，已截断）';
+        el.appendChild(span);
+    }
+}
+
+function renderCheckpoints(checkpoints) {
+    checkpointsList.innerHTML = '';
+    checkpoints.slice().reverse().slice(0, 30).forEach(function(cp) {
+        const li = document.createElement('li');
+        const code = document.createElement('code');
+        code.textContent = '#' + cp.id + ' ' + cp.prompt;
+        const meta = document.createElement('span');
+        meta.className = 'pending-meta';
+        meta.textContent = formatTime(cp.created_at) + ' · ' + cp.source + (cp.user ? ' · ' + cp.user : '') +
+            (cp.branch ? ' · ' + cp.branch : '');
+        li.appendChild(code);
+        li.appendChild(meta);
+        li.appendChild(queueButton('变化', function() { loadCheckpointDiff(cp.id); }));
+        li.appendChild(queueButton('恢复', function() { restoreCheckpoint(cp.id); }));
+        checkpointsList.appendChild(li);
+    });
+}
+
+function loadCheckpoints() {
+    fetch('/api/checkpoints')
+        .then(function(resp) { return resp.json(); })
+        .then(renderCheckpoints)
+        .catch(function() {});
+}
+
+// loadCheckpointDiff 显示检查点到下一个检查点（最新的到当前工作目录）之间的变化
+function loadCheckpointDiff(id) {
+    fetch('/api/checkpoints/' + id + '/diff')
+        .then(function(resp) {
+            if (!resp.ok) return resp.text().then(function(t) { alert(t); });
+            return resp.json().then(function(result) {
+                const header = '# 检查点 #' + result.from + ' → ' + (result.to ? '#' + result.to : '当前工作目录') + '\n';
+                renderDiff(checkpointDiff, header + (result.diff || '（没有变化）'), result.truncated);
+            });
+        });
+}
+
+function restoreCheckpoint(id) {
+    if (!confirm('将工作目录恢复到检查点 #' + id + '？当前状态会先保存为新的检查点，HEAD和暂存区不变。')) return;
+    fetch('/api/checkpoints/' + id + '/restore', { method: 'POST' })
+        .then(function(resp) {
+            if (!resp.ok) return resp.text().then(function(t) { alert(t); });
+            checkpointDiff.textContent = '';
+        });
+}
+
+function formatSize(size) {
+    if (size < 1024) return size + ' B';
+    if (size < 1024 * 1024) return (size / 1024).toFixed(1) + ' KiB';
+    return (size / 1024 / 1024).toFixed(1) + ' MiB';
+}
+
+// loadFiles 列出会话工作目录下的目录，path为相对路径
+function loadFiles(path) {
+    fetch('/api/files?path=' + encodeURIComponent(path || '.'))
+        .then(function(resp) {
+            if (!resp.ok) return resp.text().then(function(t) { alert(t); });
+            return resp.json().then(renderFiles);
+        })
+        .catch(function() {});
+}
+
+function renderFiles(listing) {
+    filesPath.textContent = listing.path === '.' ? './' : './' + listing.path + '/';
+    filesList.innerHTML = '';
+    if (listing.path !== '.') {
+        const parent = listing.path.split('/').slice(0, -1).join('/') || '.';
+        const li = document.createElement('li');
+        const code = document.createElement('code');
+        code.textContent = '📁 ..';
+        li.appendChild(code);
+        li.addEventListener('click', function() { loadFiles(parent); });
+        filesList.appendChild(li);
+    }
+    listing.entries.forEach(function(entry) {
+        const li = document.createElement('li');
+        const code = document.createElement('code');
+        const dir = entry.type === 'dir';
+        code.textContent = (dir ? '📁 ' : entry.type === 'symlink' ? '🔗 ' : '📄 ') + entry.name;
+        const meta = document.createElement('span');
+        meta.className = 'pending-meta';
+        meta.textContent = (dir ? '' : formatSize(entry.size) + ' · ') + formatTime(entry.mod_time);
+        li.appendChild(code);
+        li.appendChild(meta);
+        li.addEventListener('click', function() {
+            if (dir) loadFiles(entry.path); else loadFile(entry.path);
+        });
+        filesList.appendChild(li);
+    });
+    if (listing.truncated) {
+        const li = document.createElement('li');
+        li.className = 'pending-meta';
+        li.textContent = '…（条目过多，已截断）';
+        filesList.appendChild(li);
+    }
+}
+
+// loadFile 查看文件，highlight.js可用时按扩展名高亮
+function loadFile(path) {
+    fetch('/api/files?path=' + encodeURIComponent(path))
+        .then(function(resp) {
+            if (!resp.ok) return resp.text().then(function(t) { alert(t); });
+            return resp.json().then(function(file) {
+                fileView.hidden = false;
+                fileMeta.textContent = file.path + ' · ' + formatSize(file.size) + ' · ' + formatTime(file.mod_time) +
+                    (file.truncated ? ' · 仅显示前1 MiB' : '');
+                fileDownload.href = '/api/files?path=' + encodeURIComponent(file.path) + '&download=1';
+                fileContent.className = '';
+                if (file.binary) {
+                    fileContent.textContent = '（二进制文件，请下载查看）';
+                    return;
+                }
+                fileContent.textContent = file.content;
+                const ext = file.path.indexOf('.') >= 0 ? file.path.split('.').pop().toLowerCase() : '';
+                if (window.hljs && ext && hljs.getLanguage(ext)) {
+                    fileContent.className = 'language-' + ext;
+                    delete fileContent.dataset.highlighted;
+                    hljs.highlightElement(fileContent);
+                }
+            });
+        });
+}
+
+let slashCommands = [];
+
+function loadCommands() {
+    fetch('/api/commands')
+        .then(function(resp) { return resp.json(); })
+        .then(function(commands) { slashCommands = commands || []; })
+        .catch(function() {});
+}
+
+// 输入以 / 开头且还没有参数时，按前缀筛选斜杠命令
+function matchCommands() {
+    const value = inputBox.value;
+    if (value.charAt(0) !== '/' || value.indexOf(' ') >= 0) return [];
+    const prefix = value.slice(1).toLowerCase();
+    return slashCommands.filter(function(cmd) {
+        return cmd.name.toLowerCase().indexOf(prefix) === 0;
+    });
+}
+
+function renderCommandSuggestions() {
+    const matches = matchCommands();
+    commandSuggestions.innerHTML = '';
+    commandSuggestions.hidden = matches.length === 0;
+    matches.slice(0, 12).forEach(function(cmd) {
+        const li = document.createElement('li');
+        const name = document.createElement('code');
+        name.textContent = '/' + cmd.name + (cmd.argument_hint ? ' ' + cmd.argument_hint : '');
+        const meta = document.createElement('span');
+        meta.className = 'pending-meta';
+        meta.textContent = (cmd.description || '') + ' · ' + cmd.source + (cmd.namespace ? ':' + cmd.namespace : '');
+        li.appendChild(name);
+        li.appendChild(meta);
+        li.addEventListener('click', function() { chooseCommand(cmd); });
+        commandSuggestions.appendChild(li);
+    });
+}
+
+// 需要参数的命令填入输入框等待补充，其余直接发送
+function chooseCommand(cmd) {
+    commandSuggestions.hidden = true;
+    if (cmd.argument_hint) {
+        inputBox.value = '/' + cmd.name + ' ';
+        inputBox.focus();
+        return;
+    }
+    inputBox.value = '/' + cmd.name;
+    sendInput();
+}
+
+let ws;
+
+function connect() {
+    const wsScheme = window.location.protocol === 'https:' ? 'wss://' : 'ws://';
+    ws = new WebSocket(wsScheme + window.location.host + '/ws');
+
+    ws.onopen = function() {
+        statusDiv.textContent = '● 终端劫持已连接';
+        statusDiv.className = 'status connected';
+        fitTerminal();
+        loadPending();
+        loadResponders();
+        loadQueue();
+        loadSchedules();
+        loadUsage();
+        loadCommands();
+        loadCheckpoints();
+        loadFiles('.');
+    };
+
+    ws.onmessage = function(event) {
+        const data = JSON.parse(event.data);
+        if (data.type === 'terminal_data' && typeof data.content === 'string') {
+            term.write(data.content);
+        } else if (data.type === 'state') {
+            handleState(data);
+        } else if (data.type === 'input_pending') {
+            renderPending(data.pending);
+        } else if (data.type === 'queue') {
+            renderQueue(data.queue);
+        } else if (data.type === 'worktree') {
+            renderWorktree(data.worktree);
+        } else if (data.type === 'checkpoints') {
+            renderCheckpoints(data.checkpoints);
+        } else if (data.type === 'workspace') {
+            renderWorkspace(data.workspace);
+        } else if (data.type === 'usage') {
+            renderUsage(data.usage);
+        } else if (data.type === 'claude_session') {
+            renderClaudeSession(data.session);
+        } else if (data.type === 'schedules') {
+            renderSchedules(data.schedules);
+        } else if (data.type === 'responders') {
+            renderResponders(data.responders);
+        } else if (data.type === 'input_decision') {
+            const callback = takeReply(data);
+            if (callback) callback(data);
+            else if (myInputs.has(data.id)) showDecision(data);
+        } else if (data.type === 'mode_result') {
+            const callback = takeReply(data);
+            if (callback) callback(data);
+        } else if (data.type === 'bell') {
+            notify('ClaudeWarp', '终端响铃');
+        }
+    };
+
+    ws.onclose = function() {
+        wsReplies.clear();
+        modeSelect.disabled = false;
+        statusDiv.textContent = '● 终端劫持连接断开';
+        statusDiv.className = 'status disconnected';
+        setTimeout(connect, 3000);
+    };
+
+    ws.onerror = function(error) {
+        console.error('WebSocket Error: ', error);
+        statusDiv.textContent = '● 终端劫持连接错误';
+        statusDiv.className = 'status disconnected';
+    };
+}
+
+function sendInput() {
+    const input = inputBox.value; // Don't trim, to allow sending just spaces if needed
+    if (!input) return;
+
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        wsRequest({ type: 'input', input: input, add_newline: newlineCheckbox.checked }, function(decision) {
+            if (decision.id) myInputs.add(decision.id);
+            showDecision(decision);
+        });
+        inputBox.value = '';
+    }
+}
+
+sendBtn.addEventListener('click', sendInput);
+inputBox.addEventListener('keypress', function(e) {
+    if (e.key === 'Enter') {
+        commandSuggestions.hidden = true;
+        sendInput();
+    }
+});
+inputBox.addEventListener('input', renderCommandSuggestions);
+inputBox.addEventListener('focus', loadCommands);
+inputBox.addEventListener('keydown', function(e) {
+    if (e.key === 'Tab' && !commandSuggestions.hidden) {
+        const matches = matchCommands();
+        if (matches.length) {
+            e.preventDefault();
+            inputBox.value = '/' + matches[0].name + ' ';
+            commandSuggestions.hidden = true;
+        }
+    } else if (e.key === 'Escape') {
+        commandSuggestions.hidden = true;
+    }
+});
+
+connect();
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestVendorFilesEmbedded 前端依赖须全部内置；尚未提交时只允许在默认开启CDN回退的情况下缺失
+func TestVendorFilesEmbedded(t *testing.T) {
+	missing := missingVendorFiles()
+	if len(missing) == 0 {
+		return
+	}
+	if len(missing) < len(vendorFiles) {
+		t.Errorf("前端依赖只内置了一部分，缺少 %s，请运行 go generate ./... 重新下载", strings.Join(missing, ", "))
+	}
+	if !defaultConfig().Web.CDN {
+		t.Errorf("前端依赖未内置（%s）且默认关闭了CDN回退，Web界面无法加载", strings.Join(missing, ", "))
+	}
+}
+
+func TestIndexVendorURLs(t *testing.T) {
+	static := "/static/" + staticVersion + "/"
+	tests := []struct {
+		name string
+		cdn  bool
+	}{
+		{"cdn fallback", true},
+		{"offline", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := newIndexData(tt.cdn)
+			for _, url := range []string{data.XtermJS, data.XtermCSS, data.FitJS, data.HljsJS, data.HljsCSS} {
+				if name, ok := strings.CutPrefix(url, static); ok {
+					if _, err := fs.Stat(staticFS, name); err != nil && tt.cdn {
+						t.Errorf("%s 未内置却未回退到CDN", url)
+					}
+					continue
+				}
+				if !tt.cdn || !strings.HasPrefix(url, "https://cdn.jsdelivr.net/") {
+					t.Errorf("unexpected vendor URL %q", url)
+				}
+			}
+		})
+	}
+}
+
+// TestVendorVersions CDN地址与下载脚本使用同一版本
+func TestVendorVersions(t *testing.T) {
+	script, err := os.ReadFile("web/fetch-vendor.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		variable, cdn string
+	}{
+		{"XTERM_VERSION", xtermCDN},
+		{"FIT_VERSION", xtermFitCDN},
+		{"HLJS_VERSION", hljsCDN},
+	}
+	for _, tt := range tests {
+		m := regexp.MustCompile(`(?m)^` + tt.variable + `=(\S+)$`).FindSubmatch(script)
+		if m == nil {
+			t.Errorf("fetch-vendor.sh 中没有 %s", tt.variable)
+			continue
+		}
+		if !strings.Contains(tt.cdn, "@"+string(m[1])) {
+			t.Errorf("%s=%s 与CDN地址 %s 不一致", tt.variable, m[1], tt.cdn)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+const (
+	workspaceDebounce   = 500 * time.Millisecond // 文件变化后等待写入平静再执行 git status
+	workspaceGitTimeout = 10 * time.Second       // 单次git命令的超时
+	workspaceDiffLimit  = 512 << 10              // 返回的diff最大字节数
+	workspaceCountLimit = 1 << 20                // 统计未跟踪文件行数时读取的最大字节数
+	gitEmptyTree        = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+)
+
+// WorkspaceChanges Claude工作目录相对HEAD的变化
+type WorkspaceChanges = protocol.WorkspaceChanges
+
+// FileChange 有变化的文件
+type FileChange = protocol.FileChange
+
+// WorkspaceConfig 工作目录变化跟踪配置
+type WorkspaceConfig struct {
+	Enabled  bool     `json:"enabled"`  // 跟踪Claude工作目录中的文件变化，默认开启
+	Interval Duration `json:"interval"` // 定期执行 git status 的间隔，默认10s（支持SIGHUP热加载）
+}
+
+// validate 校验工作目录跟踪配置
+func (c WorkspaceConfig) validate() []error {
+	if c.Interval.Duration <= 0 {
+		return []error{fmt.Errorf("workspace.interval 必须大于0")}
+	}
+	return nil
+}
+
+// runGit 在dir中执行git命令，失败时错误中带有git的错误输出
+func runGit(dir string, args ...string) ([]byte, error) {
+	return runGitEnv(dir, nil, args...)
+}
+
+// runGitEnv 以额外的环境变量执行git命令
+func runGitEnv(dir string, env []string, args ...string) ([]byte, error) {
+	return runGitInput(dir, env, nil, args...)
+}
+
+// runGitInput 以额外的环境变量执行git命令，input非nil时作为标准输入
+func runGitInput(dir string, env []string, input []byte, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), workspaceGitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	// 不抢占index锁，避免与Claude自己执行的git命令冲突
+	cmd.Env = append(append(os.Environ(), "GIT_OPTIONAL_LOCKS=0"), env...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return out, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return out, fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return out, nil
+}
+
+// gitLine 执行git命令并返回去掉首尾空白的输出
+func gitLine(dir string, args ...string) (string, error) {
+	out, err := runGit(dir, args...)
+	return strings.TrimSpace(string(out)), err
+}
+
+// scanWorkspace 用 git status 和 git diff --numstat 收集工作目录相对HEAD的变化（含暂存区和未跟踪文件）
+func scanWorkspace(cwd string) WorkspaceChanges {
+	changes := WorkspaceChanges{Cwd: cwd, Files: []FileChange{}, UpdatedAt: time.Now()}
+	root, err := gitLine(cwd, "rev-parse", "--show-toplevel")
+	if err != nil {
+		changes.Error = "工作目录不是git仓库"
+		return changes
+	}
+	changes.Root = root
+	changes.Head, _ = gitLine(root, "rev-parse", "--verify", "-q", "HEAD")
+	changes.Branch, _ = gitLine(root, "symbolic-ref", "--short", "-q", "HEAD")
+
+	status, err := runGit(root, "status", "--porcelain=v1", "-z", "--untracked-files=all", "--no-renames")
+	if err != nil {
+		changes.Error = err.Error()
+		return changes
+	}
+	files := make(map[string]*FileChange)
+	for _, entry := range strings.Split(string(status), "\x00") {
+		if len(entry) < 4 {
+			continue
+		}
+		f := &FileChange{Path: entry[3:], Status: protocol.FileModified}
+		switch xy := entry[:2]; {
+		case xy == "??":
+			f.Status = protocol.FileUntracked
+			f.Additions, f.Binary = countLines(filepath.Join(root, f.Path))
+		case strings.Contains(xy, "D"):
+			f.Status = protocol.FileDeleted
+		case strings.Contains(xy, "A"):
+			f.Status = protocol.FileAdded
+		}
+		files[f.Path] = f
+	}
+
+	numstat, err := runGit(root, "diff", "--numstat", "-z", "--no-renames", baseRev(changes.Head))
+	if err != nil {
+		changes.Error = err.Error()
+	}
+	for _, entry := range strings.Split(string(numstat), "\x00") {
+		parts := strings.SplitN(entry, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		f, ok := files[parts[2]]
+		if !ok {
+			continue
+		}
+		if parts[0] == "-" {
+			f.Binary = true
+			continue
+		}
+		f.Additions, _ = strconv.Atoi(parts[0])
+		f.Deletions, _ = strconv.Atoi(parts[1])
+	}
+
+	for _, f := range files {
+		changes.Files = append(changes.Files, *f)
+	}
+	sort.Slice(changes.Files, func(i, j int) bool { return changes.Files[i].Path < changes.Files[j].Path })
+	return changes
+}
+
+// baseRev 返回diff的比较基准，新仓库尚无提交时使用空树
+func baseRev(head string) string {
+	if head == "" {
+		return gitEmptyTree
+	}
+	return head
+}
+
+// countLines 统计未跟踪文件的行数，包含NUL字节的视为二进制文件
+func countLines(path string) (int, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	buf := make([]byte, workspaceCountLimit)
+	n, _ := f.Read(buf)
+	if bytes.IndexByte(buf[:n], 0) >= 0 {
+		return 0, true
+	}
+	lines := bytes.Count(buf[:n], []byte{'\n'})
+	if n > 0 && buf[n-1] != '\n' {
+		lines++
+	}
+	return lines, false
+}
+
+// workspaceDiff 生成相对HEAD的统一格式diff，path不为空时只包含该文件
+func workspaceDiff(changes WorkspaceChanges, path string) (string, bool, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--no-renames", baseRev(changes.Head), "--"}
+	if path != "" {
+		args = append(args, path)
+	}
+	out, err := runGit(changes.Root, args...)
+	if err != nil {
+		return "", false, err
+	}
+	diff := bytes.NewBuffer(out)
+
+	// 未跟踪文件不在 git diff 中，逐个与空文件比较
+	for _, f := range changes.Files {
+		if f.Status != protocol.FileUntracked || (path != "" && f.Path != path) {
+			continue
+		}
+		if diff.Len() >= workspaceDiffLimit {
+			break
+		}
+		// 有差异时 git diff --no-index 以状态码1退出
+		out, err := runGit(changes.Root, "diff", "--no-color", "--no-ext-diff", "--no-index", "--", os.DevNull, f.Path)
+		if err != nil && len(out) == 0 {
+			return "", false, err
+		}
+		diff.Write(out)
+	}
+
+	if diff.Len() > workspaceDiffLimit {
+		return truncateText(diff.String(), workspaceDiffLimit), true, nil
+	}
+	return diff.String(), false, nil
+}
+
+// watchWorkspace 跟踪Claude工作目录中的文件变化：文件系统通知（不支持时仅定期检查）触发 git status，
+// 变化时推送 workspace 事件
+func (w *ClaudeWarp) watchWorkspace() {
+	var (
+		watcher *fsWatcher
+		watched string
+		events  <-chan struct{}
+		warned  bool
+	)
+	for {
+		w.childMux.RLock()
+		cwd := w.child.Cwd
+		w.childMux.RUnlock()
+
+		changes := w.refreshWorkspace(cwd)
+		if root := changes.Root; root != watched {
+			if watcher != nil {
+				watcher.Close()
+				watcher, events = nil, nil
+			}
+			watched = root
+			if root != "" {
+				var err error
+				if watcher, err = newFSWatcher(root); err != nil {
+					if !warned {
+						warned = true
+						w.addMessage("output", fmt.Sprintf("📂 无法监听工作目录变化，改为每 %s 检查一次: %v", w.config().Workspace.Interval.Duration, err))
+					}
+				} else {
+					events = watcher.Events()
+				}
+			}
+		}
+
+		select {
+		case <-time.After(w.config().Workspace.Interval.Duration):
+		case <-events:
+			time.Sleep(workspaceDebounce)
+			// 合并等待期间的其他变化
+			select {
+			case <-events:
+			default:
+			}
+		}
+	}
+}
+
+// refreshWorkspace 重新扫描工作目录，变化时更新记录并推送事件
+func (w *ClaudeWarp) refreshWorkspace(cwd string) WorkspaceChanges {
+	changes := scanWorkspace(cwd)
+
+	w.workspaceMux.Lock()
+	prev := w.workspace
+	w.workspace = changes
+	w.workspaceMux.Unlock()
+
+	if prev.UpdatedAt.IsZero() || prev.Root != changes.Root || prev.Head != changes.Head ||
+		prev.Branch != changes.Branch || prev.Error != changes.Error || !reflect.DeepEqual(prev.Files, changes.Files) {
+		w.broadcastEvent(protocol.WorkspaceEvent{Type: protocol.EventWorkspace, Workspace: changes})
+	}
+	return changes
+}
+
+// currentWorkspace 返回最近一次扫描的工作目录变化
+func (w *ClaudeWarp) currentWorkspace() WorkspaceChanges {
+	w.workspaceMux.RLock()
+	defer w.workspaceMux.RUnlock()
+	return w.workspace
+}
+
+// handleWorkspaceChanges 返回工作目录变化及diff：GET /api/workspace/changes[?path=文件]
+func (w *ClaudeWarp) handleWorkspaceChanges(wr http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(wr, "仅支持GET方法", http.StatusMethodNotAllowed)
+		return
+	}
+	if !w.config().Workspace.Enabled {
+		http.Error(wr, "未启用工作目录跟踪", http.StatusNotFound)
+		return
+	}
+	w.childMux.RLock()
+	cwd := w.child.Cwd
+	w.childMux.RUnlock()
+
+	changes := w.refreshWorkspace(cwd)
+	if changes.Root != "" {
+		path := r.URL.Query().Get("path")
+		if path != "" {
+			found := false
+			for _, f := range changes.Files {
+				found = found || f.Path == path
+			}
+			if !found {
+				http.Error(wr, "文件没有变化: "+path, http.StatusNotFound)
+				return
+			}
+		}
+		diff, truncated, err := workspaceDiff(changes, path)
+		if err != nil {
+			changes.Error = err.Error()
+		}
+		changes.Diff, changes.Truncated = w.redactor.Redact(diff), truncated
+	}
+
+	data, _ := json.Marshal(changes)
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// testRepo 在临时目录中创建git仓库，files为初始提交的内容，为空时不提交
+func testRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+	if _, err := runGit(dir, "init", "-q"); err != nil {
+		t.Skip("git不可用:", err)
+	}
+	if len(files) == 0 {
+		return dir
+	}
+	for name, content := range files {
+		writeTestFile(t, dir, name, content)
+	}
+	if _, err := runGit(dir, "add", "-A"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGitEnv(dir, checkpointIdentity, "commit", "-q", "-m", "init"); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanWorkspace(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial map[string]string
+		change  func(t *testing.T, dir string)
+		want    []FileChange
+	}{
+		{
+			name:    "clean",
+			initial: map[string]string{"a.txt": "a\n"},
+			change:  func(t *testing.T, dir string) {},
+			want:    []FileChange{},
+		},
+		{
+			name:    "modified",
+			initial: map[string]string{"a.txt": "one\ntwo\nthree\n"},
+			change: func(t *testing.T, dir string) {
+				writeTestFile(t, dir, "a.txt", "one\n2\nthree\nfour\n")
+			},
+			want: []FileChange{{Path: "a.txt", Status: protocol.FileModified, Additions: 2, Deletions: 1}},
+		},
+		{
+			name:    "deleted and untracked",
+			initial: map[string]string{"old.txt": "x\ny\n"},
+			change: func(t *testing.T, dir string) {
+				os.Remove(filepath.Join(dir, "old.txt"))
+				writeTestFile(t, dir, "sub/new file.txt", "1\n2\n3")
+			},
+			want: []FileChange{
+				{Path: "old.txt", Status: protocol.FileDeleted, Deletions: 2},
+				{Path: "sub/new file.txt", Status: protocol.FileUntracked, Additions: 3},
+			},
+		},
+		{
+			name:    "staged add and binary",
+			initial: map[string]string{"a.txt": "a\n"},
+			change: func(t *testing.T, dir string) {
+				writeTestFile(t, dir, "added.txt", "hello\n")
+				writeTestFile(t, dir, "blob.bin", "\x00\x01\x02")
+				runGit(dir, "add", "added.txt", "blob.bin")
+			},
+			want: []FileChange{
+				{Path: "added.txt", Status: protocol.FileAdded, Additions: 1},
+				{Path: "blob.bin", Status: protocol.FileAdded, Binary: true},
+			},
+		},
+		{
+			name:    "ignored files skipped",
+			initial: map[string]string{".gitignore": "*.log\n"},
+			change: func(t *testing.T, dir string) {
+				writeTestFile(t, dir, "debug.log", "noise\n")
+			},
+			want: []FileChange{},
+		},
+		{
+			name: "no commits yet",
+			change: func(t *testing.T, dir string) {
+				writeTestFile(t, dir, "first.txt", "a\nb\n")
+				runGit(dir, "add", "first.txt")
+			},
+			want: []FileChange{{Path: "first.txt", Status: protocol.FileAdded, Additions: 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testRepo(t, tt.initial)
+			tt.change(t, dir)
+			got := scanWorkspace(dir)
+			if got.Error != "" {
+				t.Fatalf("Error = %q", got.Error)
+			}
+			if got.Root != dir {
+				t.Errorf("Root = %q, want %q", got.Root, dir)
+			}
+			if !reflect.DeepEqual(got.Files, tt.want) {
+				t.Errorf("Files = %+v, want %+v", got.Files, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanWorkspaceNotRepo(t *testing.T) {
+	got := scanWorkspace(t.TempDir())
+	if got.Error == "" || len(got.Files) != 0 {
+		t.Errorf("scanWorkspace outside a repository = %+v, want error", got)
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imneov/claudewarp/protocol"
+)
+
+// worktreeBranchPrefix 会话分支名前缀
+const worktreeBranchPrefix = "claudewarp/"
+
+// Worktree 会话专用的git worktree
+type Worktree = protocol.Worktree
+
+// sessionWorktree 记录会话的worktree，持久化到 <state_dir>/worktree/<session>.json，
+// 以 -resume 重启时继续使用同一个worktree
+type sessionWorktree struct {
+	mu      sync.Mutex
+	path    string
+	current *Worktree
+}
+
+// openSessionWorktree 读取上次记录的worktree
+func openSessionWorktree(path string) (*sessionWorktree, error) {
+	s := &sessionWorktree{path: path}
+	var wt Worktree
+	if err := readJSONFile(path, &wt); err != nil {
+		return nil, fmt.Errorf("读取worktree记录失败: %v", err)
+	}
+	if wt.Path != "" {
+		s.current = &wt
+	}
+	return s, nil
+}
+
+// get 返回当前记录，没有时为nil
+func (s *sessionWorktree) get() *Worktree {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		return nil
+	}
+	wt := *s.current
+	return &wt
+}
+
+// active 判断是否有使用中的worktree
+func (s *sessionWorktree) active() bool {
+	wt := s.get()
+	return wt != nil && wt.Status == protocol.WorktreeActive
+}
+
+// prepare 在cwd所在仓库的HEAD上新建分支和worktree，返回Claude应使用的工作目录。
+// 上次记录的worktree仍在使用中且目录存在时直接复用。
+func (s *sessionWorktree) prepare(cwd, session, stateDir string) (*Worktree, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if wt := s.current; wt != nil && wt.Status == protocol.WorktreeActive {
+		if info, err := os.Stat(wt.Cwd); err == nil && info.IsDir() {
+			reused := *wt
+			return &reused, nil
+		}
+	}
+
+	if real, err := filepath.EvalSymlinks(cwd); err == nil {
+		cwd = real
+	}
+	root, err := gitLine(cwd, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("工作目录 %s 不是git仓库，无法创建worktree", cwd)
+	}
+	rel, err := filepath.Rel(root, cwd)
+	if err != nil {
+		rel = "."
+	}
+	base, err := gitLine(root, "rev-parse", "--verify", "-q", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("仓库 %s 尚无提交，无法创建worktree", root)
+	}
+	baseBranch, _ := gitLine(root, "symbolic-ref", "--short", "-q", "HEAD")
+
+	if stateDir, err = filepath.Abs(stateDir); err != nil {
+		return nil, err
+	}
+	stamp := time.Now().Format("20060102-150405")
+	wt := Worktree{
+		Path:       filepath.Join(stateDir, "worktrees", session+"-"+stamp),
+		Branch:     worktreeBranchPrefix + session + "-" + stamp,
+		Repo:       root,
+		Base:       base,
+		BaseBranch: baseBranch,
+		Status:     protocol.WorktreeActive,
+		CreatedAt:  time.Now(),
+	}
+	wt.Cwd = filepath.Join(wt.Path, rel)
+	if err := os.MkdirAll(filepath.Dir(wt.Path), 0700); err != nil {
+		return nil, fmt.Errorf("创建worktree目录失败: %v", err)
+	}
+	if _, err := runGit(root, "worktree", "add", "-b", wt.Branch, wt.Path, base); err != nil {
+		return nil, fmt.Errorf("创建worktree失败: %v", err)
+	}
+
+	s.current = &wt
+	if err := writeJSONFile(s.path, wt); err != nil {
+		return nil, fmt.Errorf("保存worktree记录失败: %v", err)
+	}
+	return &wt, nil
+}
+
+// commitIdentity 仓库未配置用户信息时使用claudewarp的身份提交
+func commitIdentity(root string) []string {
+	if email, _ := gitLine(root, "config", "user.email"); email != "" {
+		return nil
+	}
+	return checkpointIdentity
+}
+
+// finish 按选择处理会话结束后的worktree
+func (s *sessionWorktree) finish(action, session string) (*Worktree, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wt := s.current
+	if wt == nil || wt.Status != protocol.WorktreeActive {
+		return nil, fmt.Errorf("没有使用中的worktree")
+	}
+
+	var status string
+	switch action {
+	case protocol.WorktreeKeep:
+		status = protocol.WorktreeKept
+	case protocol.WorktreeDelete:
+		if err := removeWorktree(*wt, true); err != nil {
+			return nil, err
+		}
+		status = protocol.WorktreeRemoved
+	case protocol.WorktreeMerge:
+		if err := mergeWorktree(*wt, session); err != nil {
+			return nil, err
+		}
+		status = protocol.WorktreeMerged
+	default:
+		return nil, fmt.Errorf("未知的处理方式: %s", action)
+	}
+
+	now := time.Now()
+	finished := *wt
+	finished.Status, finished.FinishedAt = status, &now
+	s.current = &finished
+	if err := writeJSONFile(s.path, finished); err != nil {
+		return &finished, fmt.Errorf("保存worktree记录失败: %v", err)
+	}
+	return &finished, nil
+}
+
+// mergeWorktree 提交worktree中未提交的修改，合并回创建时的分支，然后删除worktree和分支
+func mergeWorktree(wt Worktree, session string) error {
+	status, err := runGit(wt.Path, "status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(status))) > 0 {
+		env := commitIdentity(wt.Path)
+		if _, err := runGitEnv(wt.Path, env, "add", "-A"); err != nil {
+			return err
+		}
+		if _, err := runGitEnv(wt.Path, env, "commit", "--no-verify", "-m", fmt.Sprintf("claudewarp: 会话 %s 未提交的修改", session)); err != nil {
+			return err
+		}
+	}
+
+	ahead, err := gitLine(wt.Repo, "rev-list", "--count", wt.Base+".."+wt.Branch)
+	if err != nil {
+		return err
+	}
+	if ahead != "0" {
+		if wt.BaseBranch == "" {
+			return fmt.Errorf("创建worktree时主仓库处于分离HEAD，无法确定合并目标，请选择保留后手动合并分支 %s", wt.Branch)
+		}
+		if current, _ := gitLine(wt.Repo, "symbolic-ref", "--short", "-q", "HEAD"); current != wt.BaseBranch {
+			return fmt.Errorf("主仓库当前分支为 %q，不是创建worktree时的 %q，请切换回去或选择保留", current, wt.BaseBranch)
+		}
+		// 合并会改动主仓库的工作目录，用户正在进行的修改不能被覆盖或混入合并
+		dirty, err := runGit(wt.Repo, "status", "--porcelain")
+		if err != nil {
+			return err
+		}
+		if len(strings.TrimSpace(string(dirty))) > 0 {
+			return fmt.Errorf("主仓库 %s 有未提交的修改，未执行合并；请提交或暂存后重试，或选择保留后手动合并分支 %s", wt.Repo, wt.Branch)
+		}
+		if conflicts := mergeConflicts(wt.Repo, wt.BaseBranch, wt.Branch); len(conflicts) > 0 {
+			return fmt.Errorf("合并会在 %s 产生冲突，未执行合并，请选择保留后手动合并分支 %s", strings.Join(conflicts, "、"), wt.Branch)
+		}
+		msg := fmt.Sprintf("Merge branch '%s' (claudewarp session %s)", wt.Branch, session)
+		if _, err := runGitEnv(wt.Repo, commitIdentity(wt.Repo), "merge", "--no-ff", "--no-edit", "-m", msg, wt.Branch); err != nil {
+			if _, abortErr := runGit(wt.Repo, "merge", "--abort"); abortErr != nil {
+				return fmt.Errorf("合并失败: %v；中止合并也失败，请检查主仓库 %s: %v", err, wt.Repo, abortErr)
+			}
+			return fmt.Errorf("合并失败，已中止合并，worktree保持不变: %v", err)
+		}
+	}
+	return removeWorktree(wt, false)
+}
+
+// mergeConflicts 用 git merge-tree 在不改动工作目录的情况下试合并，返回会冲突的文件。
+// git 2.38 之前不支持 --write-tree，此时返回nil，由实际合并时发现冲突
+func mergeConflicts(repo, base, branch string) []string {
+	out, err := runGit(repo, "merge-tree", "--write-tree", "--name-only", "--no-messages", base, branch)
+	if err == nil {
+		return nil
+	}
+	// 有冲突时退出码为1，输出第一行为合并结果的tree，之后是冲突文件
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) < 2 || !gitObjectIDPattern.MatchString(lines[0]) {
+		return nil
+	}
+	return lines[1:]
+}
+
+// gitObjectIDPattern git对象ID（SHA-1或SHA-256）
+var gitObjectIDPattern = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+
+// worktreeOrigin 返回worktree中的工作目录在主仓库中对应的路径
+func worktreeOrigin(wt Worktree) string {
+	rel, err := filepath.Rel(wt.Path, wt.Cwd)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return wt.Repo
+	}
+	return filepath.Join(wt.Repo, rel)
+}
+
+// leaveWorktree worktree处理完后把会话的工作目录改回主仓库，之后恢复会话不会进入已删除的worktree。
+// 调用方需持有resumeMux
+func (w *ClaudeWarp) leaveWorktree(wt Worktree) {
+	cwd := worktreeOrigin(wt)
+	w.childMux.Lock()
+	w.profile.Cwd = cwd
+	profile := w.profile
+	w.childMux.Unlock()
+
+	rec := w.claudeSessions.get()
+	if rec == nil || rec.Cwd == cwd {
+		return
+	}
+	rec.Cwd = cwd
+	// Claude按工作目录查找要恢复的对话，把记录复制到主仓库对应的目录
+	if dir := claudeProjectDir(profile, cwd); rec.Transcript != "" && dir != "" {
+		dst := filepath.Join(dir, filepath.Base(rec.Transcript))
+		if err := copyTranscript(rec.Transcript, dst); err != nil {
+			w.addMessage("error", fmt.Sprintf("复制对话记录失败，可能无法在主仓库恢复会话: %v", err))
+		} else {
+			rec.Transcript = dst
+		}
+	}
+	if _, err := w.claudeSessions.set(*rec); err != nil {
+		w.addMessage("error", err.Error())
+	}
+}
+
+// copyTranscript 复制对话记录文件
+func copyTranscript(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// removeWorktree 删除worktree目录和分支；force为false时只删除已合并的分支
+func removeWorktree(wt Worktree, force bool) error {
+	if _, err := runGit(wt.Repo, "worktree", "remove", "--force", wt.Path); err != nil {
+		return err
+	}
+	flag := "-d"
+	if force {
+		flag = "-D"
+	}
+	_, err := runGit(wt.Repo, "branch", flag, wt.Branch)
+	return err
+}
+
+// broadcastWorktree 向Web客户端推送worktree状态
+func (w *ClaudeWarp) broadcastWorktree() {
+	w.broadcastEvent(protocol.WorktreeEvent{Type: protocol.EventWorktree, Worktree: w.worktree.get()})
+}
+
+// handleWorktree 处理会话worktree：GET /api/worktree，
+// Claude退出后 POST /api/worktree {"action": "merge|keep|delete"}
+func (w *ClaudeWarp) handleWorktree(wr http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		data, _ := json.Marshal(w.worktree.get())
+		wr.Header().Set("Content-Type", "application/json")
+		wr.Write(data)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(wr, "仅支持GET和POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := w.requireController(wr, r)
+	if !ok {
+		return
+	}
+
+	var req protocol.WorktreeRequest
+	err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&req)
+	if err != nil || (req.Action != protocol.WorktreeMerge && req.Action != protocol.WorktreeKeep && req.Action != protocol.WorktreeDelete) {
+		http.Error(wr, "需要JSON请求体 {\"action\": \"merge|keep|delete\"}", http.StatusBadRequest)
+		return
+	}
+	// 与恢复会话互斥：处理期间不能有Claude在worktree中重新启动
+	w.resumeMux.Lock()
+	defer w.resumeMux.Unlock()
+	if state, _ := w.tracker.Current(); state != StateExited {
+		http.Error(wr, "Claude仍在worktree中运行，请在会话结束后处理", http.StatusConflict)
+		return
+	}
+
+	wt, err := w.worktree.finish(req.Action, w.config().SessionName())
+	if err != nil {
+		http.Error(wr, err.Error(), http.StatusConflict)
+		return
+	}
+	w.leaveWorktree(*wt)
+	labels := map[string]string{
+		protocol.WorktreeMerged:  "已合并到 " + wt.BaseBranch + " 并删除",
+		protocol.WorktreeKept:    "已保留",
+		protocol.WorktreeRemoved: "已删除",
+	}
+	w.addMessage("output", fmt.Sprintf("🌿 %s: worktree %s（分支 %s）%s", requestIdentity(user, r.RemoteAddr), wt.Path, wt.Branch, labels[wt.Status]))
+	w.broadcastWorktree()
+	if !w.config().KeepAlive {
+		// 未启用keep_alive时处理完worktree即结束
+		select {
+		case w.worktreeDone <- struct{}{}:
+		default:
+		}
+	}
+
+	data, _ := json.Marshal(wt)
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(data)
+}